@@ -1,5 +1,7 @@
 package library
 
+import "context"
+
 // Album represents an album resource object.
 type Album struct {
 	Type       string          `json:"type,omitempty"`
@@ -9,19 +11,36 @@ type Album struct {
 
 // AlbumAttributes represents information about the album resource object.
 type AlbumAttributes struct {
-	Name            string `json:"name,omitempty"`
-	Sort            string `json:"sort,omitempty"`
-	ArtistName      string `json:"artistName,omitempty"`
-	ArtistSort      string `json:"artistSort,omitempty"`
-	GenreName       string `json:"genreName,omitempty"`
-	ReleaseDate     string `json:"releaseDate,omitempty"`
-	AlbumArtist     string `json:"albumArtist,omitempty"`
-	AlbumArtistSort string `json:"albumArtistSort,omitempty"`
+	Name            string  `json:"name,omitempty"`
+	Sort            string  `json:"sort,omitempty"`
+	ArtistName      string  `json:"artistName,omitempty"`
+	ArtistSort      string  `json:"artistSort,omitempty"`
+	GenreName       string  `json:"genreName,omitempty"`
+	ReleaseDate     string  `json:"releaseDate,omitempty"`
+	AlbumArtist     string  `json:"albumArtist,omitempty"`
+	AlbumArtistSort string  `json:"albumArtistSort,omitempty"`
+	Rating          float64 `json:"rating,omitempty"`
+	Loved           bool    `json:"loved,omitempty"`
 }
 
 // AlbumService manages interactions with the album data source.
+// FilterAlbums reads the page of albums that a filter selects, and Albums and
+// AlbumsPage read those selected by parameters, as parsed by ParseAlbumFilter.
+// Each method has a Context variant, as those of SongService.
 type AlbumService interface {
 	Album(ID string) (*Album, error)
 	Albums(params map[string]string) ([]*Album, error)
+	AlbumsPage(params map[string]string) ([]*Album, *Page, error)
+	FilterAlbums(filter *AlbumFilter) ([]*Album, *Page, error)
 	CreateAlbum(attributes *AlbumAttributes) error
+	UpdateAlbum(ID string, attributes *AlbumAttributes) error
+	DeleteAlbum(ID string) error
+
+	AlbumContext(ctx context.Context, ID string) (*Album, error)
+	AlbumsContext(ctx context.Context, params map[string]string) ([]*Album, error)
+	AlbumsPageContext(ctx context.Context, params map[string]string) ([]*Album, *Page, error)
+	FilterAlbumsContext(ctx context.Context, filter *AlbumFilter) ([]*Album, *Page, error)
+	CreateAlbumContext(ctx context.Context, attributes *AlbumAttributes) error
+	UpdateAlbumContext(ctx context.Context, ID string, attributes *AlbumAttributes) error
+	DeleteAlbumContext(ctx context.Context, ID string) error
 }
@@ -1,5 +1,7 @@
 package library
 
+import "context"
+
 // Artist represents an artist resource object.
 type Artist struct {
 	Type       string           `json:"type,omitempty"`
@@ -9,13 +11,33 @@ type Artist struct {
 
 // ArtistAttributes represents information about the artist resource object.
 type ArtistAttributes struct {
-	Name string `json:"name,omitempty"`
-	Sort string `json:"sort,omitempty"`
+	Name   string  `json:"name,omitempty"`
+	Sort   string  `json:"sort,omitempty"`
+	Rating float64 `json:"rating,omitempty"`
+	Loved  bool    `json:"loved,omitempty"`
 }
 
 // ArtistService manages interactions with the artist data source.
+// FilterArtists reads the page of artists that a filter selects, and Artists
+// and ArtistsPage read those selected by parameters, as parsed by
+// ParseArtistFilter. Each method has a Context variant, as those of
+// SongService.
 type ArtistService interface {
 	Artist(ID string) (*Artist, error)
 	Artists(params map[string]string) ([]*Artist, error)
+	ArtistsPage(params map[string]string) ([]*Artist, *Page, error)
+	FilterArtists(filter *ArtistFilter) ([]*Artist, *Page, error)
 	CreateArtist(attributes *ArtistAttributes) error
+	UpdateArtist(ID string, attributes *ArtistAttributes) error
+	DeleteArtist(ID string) error
+	MergeArtists(targetID string, sourceIDs ...string) error
+
+	ArtistContext(ctx context.Context, ID string) (*Artist, error)
+	ArtistsContext(ctx context.Context, params map[string]string) ([]*Artist, error)
+	ArtistsPageContext(ctx context.Context, params map[string]string) ([]*Artist, *Page, error)
+	FilterArtistsContext(ctx context.Context, filter *ArtistFilter) ([]*Artist, *Page, error)
+	CreateArtistContext(ctx context.Context, attributes *ArtistAttributes) error
+	UpdateArtistContext(ctx context.Context, ID string, attributes *ArtistAttributes) error
+	DeleteArtistContext(ctx context.Context, ID string) error
+	MergeArtistsContext(ctx context.Context, targetID string, sourceIDs ...string) error
 }
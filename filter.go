@@ -0,0 +1,278 @@
+package library
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filter represents the criteria shared by the filters of songs, albums and
+// artists. MinRating and Loved select by the ratings of the acting user, and
+// Tags is a tag expression such as "workout AND NOT slow". Conditions compare
+// fields as the conditions of smart playlists do, and must all hold. Sort
+// lists the fields to order by, such as "artist,-releaseDate", each prefixed
+// with '-' for descending order. Limit, Offset and Cursor select a page, where
+// a zero Limit reads every resource and Cursor is the Next cursor of a Page.
+type Filter struct {
+	MinRating  float64
+	Loved      *bool
+	Tags       string
+	Conditions []Condition
+	Sort       string
+	Limit      int
+	Offset     int
+	Cursor     string
+}
+
+// filterOperators maps the operators of filter parameters onto the operators
+// of the conditions they are parsed into.
+var filterOperators = map[string]string{
+	"eq":        "is",
+	"ne":        "isNot",
+	"in":        "isAnyOf",
+	"nin":       "isNoneOf",
+	"lt":        "lessThan",
+	"lte":       "atMost",
+	"gt":        "moreThan",
+	"gte":       "atLeast",
+	"between":   "between",
+	"contains":  "contains",
+	"ncontains": "notContains",
+	"prefix":    "startsWith",
+	"suffix":    "endsWith",
+	"missing":   "isEmpty",
+}
+
+// SongFilter represents the criteria that select songs.
+type SongFilter struct {
+	ArtistID string
+	AlbumID  string
+	GenreID  string
+	Filter
+}
+
+// AlbumFilter represents the criteria that select albums.
+type AlbumFilter struct {
+	ArtistID string
+	GenreID  string
+	Filter
+}
+
+// ArtistFilter represents the criteria that select artists. AlbumID and
+// GenreID select the artists of the songs and albums of an album or genre.
+type ArtistFilter struct {
+	AlbumID string
+	GenreID string
+	Filter
+}
+
+// Validate returns an error if the filter selects nothing meaningful.
+func (f *Filter) Validate() error {
+	if f.MinRating < 0 || f.MinRating > 5 {
+		return fmt.Errorf("minimum rating %v is not between 0 and 5", f.MinRating)
+	}
+	if f.Limit < 0 {
+		return fmt.Errorf("limit %d is negative", f.Limit)
+	}
+	if f.Offset < 0 {
+		return fmt.Errorf("offset %d is negative", f.Offset)
+	}
+	return nil
+}
+
+// ParseSongFilter parses the parameters of a song query, whose names are those
+// of the fields of a SongFilter such as "artistID" or "minRating", and returns
+// an error for any parameter that is not. Conditions are given by parameters
+// named "filter[field][operator]", such as "filter[year][gte]=1990" or
+// "filter[genre][in]=Rock,Metal", where the operator is one of eq, ne, in,
+// nin, lt, lte, gt, gte, between, contains, ncontains, prefix, suffix and
+// missing, and is eq if omitted. The values of in, nin and between are
+// separated by commas, and missing takes true or false.
+func ParseSongFilter(params map[string]string) (*SongFilter, error) {
+	return ParseSongQuery(splitParams(params))
+}
+
+// ParseSongQuery parses a song query as ParseSongFilter does, but takes each
+// value of in, nin and between whole from a repeated parameter, as in
+// "filter[genre][in]=Rock&filter[genre][in]=Rhythm, Blues", so that values
+// may hold commas. Every other parameter takes a single value.
+func ParseSongQuery(query url.Values) (*SongFilter, error) {
+	f := &SongFilter{}
+	err := f.Filter.parse(query, "songs", map[string]*string{
+		"artistID": &f.ArtistID,
+		"albumID":  &f.AlbumID,
+		"genreID":  &f.GenreID})
+	return f, err
+}
+
+// ParseAlbumFilter parses the parameters of an album query as
+// ParseSongFilter does.
+func ParseAlbumFilter(params map[string]string) (*AlbumFilter, error) {
+	return ParseAlbumQuery(splitParams(params))
+}
+
+// ParseAlbumQuery parses an album query as ParseSongQuery does.
+func ParseAlbumQuery(query url.Values) (*AlbumFilter, error) {
+	f := &AlbumFilter{}
+	err := f.Filter.parse(query, "albums", map[string]*string{
+		"artistID": &f.ArtistID,
+		"genreID":  &f.GenreID})
+	return f, err
+}
+
+// ParseArtistFilter parses the parameters of an artist query as
+// ParseSongFilter does.
+func ParseArtistFilter(params map[string]string) (*ArtistFilter, error) {
+	return ParseArtistQuery(splitParams(params))
+}
+
+// ParseArtistQuery parses an artist query as ParseSongQuery does.
+func ParseArtistQuery(query url.Values) (*ArtistFilter, error) {
+	f := &ArtistFilter{}
+	err := f.Filter.parse(query, "artists", map[string]*string{
+		"albumID": &f.AlbumID,
+		"genreID": &f.GenreID})
+	return f, err
+}
+
+// listOperators lists the operators of filter parameters that take a list of
+// values.
+var listOperators = map[string]bool{"in": true, "nin": true, "between": true}
+
+// splitParams returns the given parameters as a query, splitting the values
+// of the parameters whose operators take a list on commas.
+func splitParams(params map[string]string) url.Values {
+	query := make(url.Values, len(params))
+	for name, value := range params {
+		parts := conditionName.FindStringSubmatch(name)
+		if parts == nil || !listOperators[parts[2]] {
+			query.Set(name, value)
+			continue
+		}
+		for _, v := range strings.Split(value, ",") {
+			query.Add(name, strings.TrimSpace(v))
+		}
+	}
+	return query
+}
+
+// parse parses the given parameters into the filter and the given IDs of the
+// filter of resources of the given type.
+func (f *Filter) parse(query url.Values, resourceType string, IDs map[string]*string) error {
+	// Parameters are parsed in order so that conditions are too.
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if strings.HasPrefix(name, "filter[") {
+			c, err := parseCondition(name, query[name])
+			if err != nil {
+				return err
+			}
+			f.Conditions = append(f.Conditions, c)
+			continue
+		}
+
+		if len(query[name]) != 1 {
+			return fmt.Errorf("%s filter %q takes one value, got %d", resourceType, name, len(query[name]))
+		}
+		value := query[name][0]
+		if ID, ok := IDs[name]; ok {
+			*ID = value
+			continue
+		}
+
+		var err error
+		switch name {
+		case "minRating":
+			if len(value) > 0 {
+				f.MinRating, err = strconv.ParseFloat(value, 64)
+			}
+		case "loved":
+			if len(value) > 0 {
+				var loved bool
+				loved, err = strconv.ParseBool(value)
+				f.Loved = &loved
+			}
+		case "tags":
+			f.Tags = value
+		case "sort":
+			f.Sort = value
+		case "limit":
+			if len(value) > 0 {
+				f.Limit, err = strconv.Atoi(value)
+			}
+		case "offset":
+			if len(value) > 0 {
+				f.Offset, err = strconv.Atoi(value)
+			}
+		case "cursor":
+			f.Cursor = value
+		default:
+			return fmt.Errorf("%s cannot be filtered by %q", resourceType, name)
+		}
+		if err != nil {
+			return fmt.Errorf("%s filter %q: %q is not valid", resourceType, name, value)
+		}
+	}
+	return f.Validate()
+}
+
+// conditionName matches the names of condition parameters, capturing the
+// field and the operator, if any.
+var conditionName = regexp.MustCompile(`^filter\[([^\[\]]+)\](?:\[([^\[\]]+)\])?$`)
+
+// parseCondition parses a condition from a parameter named
+// "filter[field][operator]" with the given values, of which only the
+// operators that take a list take more than one.
+func parseCondition(name string, values []string) (Condition, error) {
+	c := Condition{}
+
+	parts := conditionName.FindStringSubmatch(name)
+	if parts == nil {
+		return c, fmt.Errorf("filter %q is not of the form filter[field] or filter[field][operator]", name)
+	}
+	c.Field = parts[1]
+
+	op := "eq"
+	if len(parts[2]) > 0 {
+		op = parts[2]
+	}
+	c.Operator = filterOperators[op]
+	if len(c.Operator) == 0 {
+		return c, fmt.Errorf("filter %q: unknown operator %q", name, op)
+	}
+
+	if listOperators[op] {
+		c.Values = values
+		return c, nil
+	}
+	if len(values) != 1 {
+		return c, fmt.Errorf("filter %q takes one value, got %d", name, len(values))
+	}
+	value := values[0]
+
+	switch op {
+	case "missing":
+		missing := true
+		if len(value) > 0 {
+			var err error
+			missing, err = strconv.ParseBool(value)
+			if err != nil {
+				return c, fmt.Errorf("filter %q: %q is not true or false", name, value)
+			}
+		}
+		if !missing {
+			c.Operator = "isNotEmpty"
+		}
+	default:
+		c.Values = []string{value}
+	}
+	return c, nil
+}
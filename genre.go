@@ -1,5 +1,7 @@
 package library
 
+import "context"
+
 // Genre represents a genre resource object.
 type Genre struct {
 	Type       string          `json:"type,omitempty"`
@@ -12,9 +14,18 @@ type GenreAttributes struct {
 	Name string `json:"name,omitempty"`
 }
 
-// GenreService manages interactions with the genres data source.
+// GenreService manages interactions with the genres data source. Each method
+// has a Context variant, as those of SongService.
 type GenreService interface {
 	Genre(ID string) (*Genre, error)
 	Genres() ([]*Genre, error)
 	CreateGenre(attributes *GenreAttributes) error
+	UpdateGenre(ID string, attributes *GenreAttributes) error
+	DeleteGenre(ID string) error
+
+	GenreContext(ctx context.Context, ID string) (*Genre, error)
+	GenresContext(ctx context.Context) ([]*Genre, error)
+	CreateGenreContext(ctx context.Context, attributes *GenreAttributes) error
+	UpdateGenreContext(ctx context.Context, ID string, attributes *GenreAttributes) error
+	DeleteGenreContext(ctx context.Context, ID string) error
 }
@@ -1,7 +1,29 @@
 package library
 
-// Service manages interactions with the media library.
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when the resource to change does not exist.
+var ErrNotFound = errors.New("library: resource not found")
+
+// Service manages interactions with the media library. The Context variants
+// of its methods are cancelled along with the given context.
 type Service interface {
 	CreateLibrary() error
 	DeleteLibrary() error
+
+	CreateLibraryContext(ctx context.Context) error
+	DeleteLibraryContext(ctx context.Context) error
+}
+
+// Page describes a page of resources. Total is the number of resources that
+// meet the criteria across all pages, and Next is the opaque cursor that reads
+// the following page, or empty if the page is the last.
+type Page struct {
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	Next   string `json:"next,omitempty"`
 }
@@ -0,0 +1,78 @@
+package playlist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// readM3U reads the entries of an M3U or M3U8 playlist file. The duration,
+// artist and title of an entry are read from the #EXTINF line before it.
+func readM3U(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	info := Entry{Duration: -1}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if len(line) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			if strings.HasPrefix(line, "#EXTINF:") {
+				info = readExtInf(strings.TrimPrefix(line, "#EXTINF:"))
+			}
+			continue
+		}
+
+		info.Location = line
+		entries = append(entries, info)
+		info = Entry{Duration: -1}
+	}
+	return entries, scanner.Err()
+}
+
+// readExtInf reads the duration, artist and title from the given #EXTINF
+// value, which has the form "duration,Artist - Title".
+func readExtInf(value string) Entry {
+	e := Entry{Duration: -1}
+
+	i := strings.Index(value, ",")
+	if i < 0 {
+		return e
+	}
+
+	// The duration may be followed by attributes such as tvg-id="...".
+	fields := strings.Fields(value[:i])
+	if len(fields) > 0 {
+		d, err := strconv.ParseFloat(fields[0], 64)
+		if err == nil && d >= 0 {
+			e.Duration = int(d)
+		}
+	}
+
+	e.Title = strings.TrimSpace(value[i+1:])
+	if j := strings.Index(e.Title, " - "); j >= 0 {
+		e.Artist = e.Title[:j]
+		e.Title = e.Title[j+3:]
+	}
+	return e
+}
+
+// writeM3U writes the given entries as an extended M3U8 playlist file.
+func writeM3U(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	for _, e := range entries {
+		title := e.Title
+		if len(e.Artist) > 0 {
+			title = e.Artist + " - " + title
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n", e.Duration, title)
+		fmt.Fprintln(bw, e.Location)
+	}
+	return bw.Flush()
+}
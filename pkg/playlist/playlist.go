@@ -0,0 +1,133 @@
+// Package playlist reads and writes playlist files in the M3U8, PLS and XSPF
+// formats.
+package playlist
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// Format represents a playlist file format.
+type Format string
+
+// The supported playlist file formats. M3U files are read as M3U8.
+const (
+	M3U8 Format = "m3u8"
+	PLS  Format = "pls"
+	XSPF Format = "xspf"
+)
+
+// Entry represents a track listed by a playlist file. Duration is in seconds,
+// or -1 if unknown.
+type Entry struct {
+	Location string
+	Title    string
+	Artist   string
+	Duration int
+}
+
+// FormatOf returns the format of the playlist file at the given path, judged by
+// its extension.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m3u", ".m3u8":
+		return M3U8, nil
+	case ".pls":
+		return PLS, nil
+	case ".xspf":
+		return XSPF, nil
+	}
+	return "", fmt.Errorf("unknown playlist format of %s", path)
+}
+
+// Read reads the entries of a playlist file in the given format.
+func Read(r io.Reader, format Format) ([]Entry, error) {
+	switch format {
+	case M3U8:
+		return readM3U(r)
+	case PLS:
+		return readPLS(r)
+	case XSPF:
+		return readXSPF(r)
+	}
+	return nil, fmt.Errorf("unknown playlist format %q", format)
+}
+
+// Write writes the given entries as a playlist file in the given format.
+func Write(w io.Writer, format Format, entries []Entry) error {
+	switch format {
+	case M3U8:
+		return writeM3U(w, entries)
+	case PLS:
+		return writePLS(w, entries)
+	case XSPF:
+		return writeXSPF(w, entries)
+	}
+	return fmt.Errorf("unknown playlist format %q", format)
+}
+
+// Entries returns an entry for each of the given songs. If dir is not empty,
+// the locations of songs beneath it are written relative to it so that the
+// playlist file can be moved along with the songs.
+func Entries(songs []*library.Song, dir string) []Entry {
+	entries := make([]Entry, 0, len(songs))
+	for _, s := range songs {
+		duration := -1
+		if s.Attributes.DurationInMillis > 0 {
+			duration = s.Attributes.DurationInMillis / 1000
+		}
+
+		location := s.Attributes.FilePath
+		if len(dir) > 0 {
+			rel, err := filepath.Rel(dir, location)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				location = rel
+			}
+		}
+
+		entries = append(entries, Entry{
+			Location: location,
+			Title:    s.Attributes.Name,
+			Artist:   s.Attributes.ArtistName,
+			Duration: duration})
+	}
+	return entries
+}
+
+// Resolve returns the absolute path of the file at the given location, which
+// is either a path or a file URI. Relative locations are resolved against the
+// given directory.
+func Resolve(location, dir string) (string, error) {
+	if strings.HasPrefix(strings.ToLower(location), "file:") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return "", err
+		}
+		if len(u.Host) > 0 && u.Host != "localhost" {
+			return "", fmt.Errorf("%s is on another host", location)
+		}
+		location = filepath.FromSlash(u.Path)
+	} else if u, err := url.Parse(location); err == nil && len(u.Scheme) > 1 {
+		return "", fmt.Errorf("%s is not a file", location)
+	}
+
+	if !filepath.IsAbs(location) {
+		location = filepath.Join(dir, filepath.FromSlash(location))
+	}
+	return filepath.Clean(location), nil
+}
+
+// uri returns the given location as a URI, as XSPF requires.
+func uri(location string) string {
+	if filepath.IsAbs(location) {
+		u := url.URL{Scheme: "file", Path: filepath.ToSlash(location)}
+		return u.String()
+	}
+	u := url.URL{Path: filepath.ToSlash(location)}
+	return u.String()
+}
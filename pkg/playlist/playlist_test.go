@@ -0,0 +1,269 @@
+package playlist
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// TestRead checks that the entries of playlist files are read in order along
+// with their titles, artists and durations.
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		file   string
+		want   []Entry
+	}{
+		{"m3u8", M3U8, "\uFEFF#EXTM3U\n" +
+			"# A comment\n" +
+			"#EXTINF:215,Ann - One\n" +
+			"/music/1.mp3\n" +
+			"\n" +
+			"#EXTINF:-1 tvg-id=\"x\",Two\n" +
+			"2.mp3\n" +
+			"#EXTVLCOPT:network-caching=1000\n" +
+			"sub/3.mp3\n", []Entry{
+			{Location: "/music/1.mp3", Title: "One", Artist: "Ann", Duration: 215},
+			{Location: "2.mp3", Title: "Two", Duration: -1},
+			{Location: "sub/3.mp3", Duration: -1},
+		}},
+		{"plain m3u", M3U8, "1.mp3\r\n2.mp3\r\n", []Entry{
+			{Location: "1.mp3", Duration: -1},
+			{Location: "2.mp3", Duration: -1},
+		}},
+		{"pls", PLS, "[playlist]\n" +
+			"; A comment\n" +
+			"File1=/music/1.mp3\n" +
+			"Title1=Ann - One\n" +
+			"Length1=215\n" +
+			"File2 = 2.mp3\n" +
+			"Length2=-1\n" +
+			"NumberOfEntries=2\n" +
+			"Version=2\n", []Entry{
+			{Location: "/music/1.mp3", Title: "Ann - One", Duration: 215},
+			{Location: "2.mp3", Duration: -1},
+		}},
+		{"pls with too many entries counted", PLS, "[playlist]\n" +
+			"File1=1.mp3\n" +
+			"NumberOfEntries=5\n", []Entry{
+			{Location: "1.mp3", Duration: -1},
+		}},
+		{"pls with too few entries counted", PLS, "[playlist]\n" +
+			"File1=1.mp3\n" +
+			"File2=2.mp3\n" +
+			"File3=3.mp3\n" +
+			"NumberOfEntries=1\n", []Entry{
+			{Location: "1.mp3", Duration: -1},
+			{Location: "2.mp3", Duration: -1},
+			{Location: "3.mp3", Duration: -1},
+		}},
+		{"pls out of order with gaps", PLS, "[playlist]\n" +
+			"File10=10.mp3\n" +
+			"Title4=No file\n" +
+			"File2=2.mp3\n" +
+			"NumberOfEntries=3\n", []Entry{
+			{Location: "2.mp3", Duration: -1},
+			{Location: "10.mp3", Duration: -1},
+		}},
+		{"xspf", XSPF, `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <!-- A comment -->
+  <trackList>
+    <track>
+      <location>file:///music/My%20Song.mp3</location>
+      <title>One</title>
+      <creator>Ann</creator>
+      <duration>215500</duration>
+    </track>
+    <track>
+      <title>No location</title>
+    </track>
+    <track>
+      <location>sub/Two%20%26%20Three.mp3</location>
+    </track>
+  </trackList>
+</playlist>`, []Entry{
+			{Location: "file:///music/My%20Song.mp3", Title: "One", Artist: "Ann", Duration: 215},
+			{Location: "sub/Two & Three.mp3", Duration: -1},
+		}},
+	}
+
+	for _, tt := range tests {
+		entries, err := Read(strings.NewReader(tt.file), tt.format)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(entries, tt.want) {
+			t.Errorf("%s: read %+v, want %+v", tt.name, entries, tt.want)
+		}
+	}
+
+	_, err := Read(strings.NewReader("<playlist>"), XSPF)
+	if err == nil {
+		t.Error("Read of malformed XSPF returned no error")
+	}
+	_, err = Read(strings.NewReader(""), "wpl")
+	if err == nil {
+		t.Error("Read of an unknown format returned no error")
+	}
+}
+
+// TestWrite checks that entries are written in each format, and that every
+// format reads back the locations and durations it wrote.
+func TestWrite(t *testing.T) {
+	entries := []Entry{
+		{Location: "/music/My Song.mp3", Title: "One", Artist: "Ann", Duration: 215},
+		{Location: filepath.Join("sub", "Two & Three.mp3"), Title: "Two", Duration: -1},
+	}
+	want := map[Format]string{
+		M3U8: "#EXTM3U\n" +
+			"#EXTINF:215,Ann - One\n" +
+			"/music/My Song.mp3\n" +
+			"#EXTINF:-1,Two\n" +
+			"sub/Two & Three.mp3\n",
+		PLS: "[playlist]\n" +
+			"File1=/music/My Song.mp3\n" +
+			"Title1=Ann - One\n" +
+			"Length1=215\n" +
+			"File2=sub/Two & Three.mp3\n" +
+			"Title2=Two\n" +
+			"Length2=-1\n" +
+			"NumberOfEntries=2\n" +
+			"Version=2\n",
+		XSPF: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+			`<playlist xmlns="http://xspf.org/ns/0/" version="1">` + "\n" +
+			"  <trackList>\n" +
+			"    <track>\n" +
+			"      <location>file:///music/My%20Song.mp3</location>\n" +
+			"      <title>One</title>\n" +
+			"      <creator>Ann</creator>\n" +
+			"      <duration>215000</duration>\n" +
+			"    </track>\n" +
+			"    <track>\n" +
+			"      <location>sub/Two%20&amp;%20Three.mp3</location>\n" +
+			"      <title>Two</title>\n" +
+			"    </track>\n" +
+			"  </trackList>\n" +
+			"</playlist>\n",
+	}
+
+	for format, file := range want {
+		var b bytes.Buffer
+		err := Write(&b, format, entries)
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if b.String() != file {
+			t.Errorf("%s: wrote\n%s\nwant\n%s", format, b.String(), file)
+		}
+
+		read, err := Read(&b, format)
+		if err != nil {
+			t.Errorf("%s: reading back: %v", format, err)
+			continue
+		}
+		if len(read) != len(entries) {
+			t.Errorf("%s: read back %d entries, want %d", format, len(read), len(entries))
+			continue
+		}
+		for i, e := range read {
+			location, err := Resolve(e.Location, "/playlists")
+			want, _ := Resolve(entries[i].Location, "/playlists")
+			if err != nil || location != want || e.Duration != entries[i].Duration {
+				t.Errorf("%s: read back entry %+v (%v), want %s lasting %d", format, e, err, want, entries[i].Duration)
+			}
+		}
+	}
+}
+
+// TestEntries checks that songs beneath the directory of a playlist file are
+// written relative to it, and other songs by their absolute paths.
+func TestEntries(t *testing.T) {
+	songs := []*library.Song{
+		{Attributes: library.SongAttributes{FilePath: "/music/playlists/1.mp3", Name: "One", ArtistName: "Ann", DurationInMillis: 215900}},
+		{Attributes: library.SongAttributes{FilePath: "/music/playlists/sub/2.mp3", Name: "Two"}},
+		{Attributes: library.SongAttributes{FilePath: "/music/3.mp3", Name: "Three"}},
+		{Attributes: library.SongAttributes{FilePath: "/music/playlists..x/4.mp3", Name: "Four"}},
+	}
+
+	want := []Entry{
+		{Location: "1.mp3", Title: "One", Artist: "Ann", Duration: 215},
+		{Location: filepath.Join("sub", "2.mp3"), Title: "Two", Duration: -1},
+		{Location: "/music/3.mp3", Title: "Three", Duration: -1},
+		{Location: "/music/playlists..x/4.mp3", Title: "Four", Duration: -1},
+	}
+	if entries := Entries(songs, "/music/playlists"); !reflect.DeepEqual(entries, want) {
+		t.Errorf("Entries returned %+v, want %+v", entries, want)
+	}
+
+	entries := Entries(songs, "")
+	for i, e := range entries {
+		if e.Location != songs[i].Attributes.FilePath {
+			t.Errorf("Entries without a directory wrote %s, want %s", e.Location, songs[i].Attributes.FilePath)
+		}
+	}
+}
+
+// TestResolve checks that relative, absolute and file URI locations resolve to
+// absolute paths, and that locations of files on other hosts do not.
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		location string
+		want     string
+		wantErr  bool
+	}{
+		{"1.mp3", "/playlists/1.mp3", false},
+		{"sub/../2.mp3", "/playlists/2.mp3", false},
+		{"../music/3.mp3", "/music/3.mp3", false},
+		{"My%20Song.mp3", "/playlists/My%20Song.mp3", false},
+		{"/music/4.mp3", "/music/4.mp3", false},
+		{"/music/./sub//5.mp3", "/music/sub/5.mp3", false},
+		{"file:///music/My%20Song.mp3", "/music/My Song.mp3", false},
+		{"FILE:///music/%C3%A9t%C3%A9.mp3", "/music/été.mp3", false},
+		{"file://localhost/music/6.mp3", "/music/6.mp3", false},
+		{"file:/music/7.mp3", "/music/7.mp3", false},
+		{"file://nas/music/8.mp3", "", true},
+		{"file:///music/%zz.mp3", "", true},
+		{"http://example.com/9.mp3", "", true},
+		{"smb://nas/music/10.mp3", "", true},
+	}
+
+	for _, tt := range tests {
+		path, err := Resolve(tt.location, "/playlists")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Resolve(%q) = %q, want an error", tt.location, path)
+			}
+			continue
+		}
+		if err != nil || path != tt.want {
+			t.Errorf("Resolve(%q) = %q (%v), want %q", tt.location, path, err, tt.want)
+		}
+	}
+}
+
+// TestFormatOf checks that formats are judged by extension regardless of case.
+func TestFormatOf(t *testing.T) {
+	for path, want := range map[string]Format{
+		"a.m3u":  M3U8,
+		"a.M3U8": M3U8,
+		"a.pls":  PLS,
+		"a.Xspf": XSPF,
+	} {
+		format, err := FormatOf(path)
+		if err != nil || format != want {
+			t.Errorf("FormatOf(%q) = %q (%v), want %q", path, format, err, want)
+		}
+	}
+	_, err := FormatOf("a.wpl")
+	if err == nil {
+		t.Error("FormatOf of an unknown extension returned no error")
+	}
+}
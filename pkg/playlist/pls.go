@@ -0,0 +1,94 @@
+package playlist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// readPLS reads the entries of a PLS playlist file, ordered by their number.
+func readPLS(r io.Reader) ([]Entry, error) {
+	numbered := make(map[int]*Entry)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+
+		var name string
+		for _, prefix := range []string{"File", "Title", "Length"} {
+			if strings.HasPrefix(key, prefix) {
+				name = prefix
+				break
+			}
+		}
+		if len(name) == 0 {
+			continue
+		}
+
+		n, err := strconv.Atoi(strings.TrimPrefix(key, name))
+		if err != nil {
+			continue
+		}
+
+		e, ok := numbered[n]
+		if !ok {
+			e = &Entry{Duration: -1}
+			numbered[n] = e
+		}
+
+		switch name {
+		case "File":
+			e.Location = value
+		case "Title":
+			e.Title = value
+		case "Length":
+			d, err := strconv.Atoi(value)
+			if err == nil && d >= 0 {
+				e.Duration = d
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var numbers []int
+	for n, e := range numbered {
+		if len(e.Location) > 0 {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+
+	entries := make([]Entry, 0, len(numbers))
+	for _, n := range numbers {
+		entries = append(entries, *numbered[n])
+	}
+	return entries, nil
+}
+
+// writePLS writes the given entries as a PLS playlist file.
+func writePLS(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "[playlist]")
+	for i, e := range entries {
+		title := e.Title
+		if len(e.Artist) > 0 {
+			title = e.Artist + " - " + title
+		}
+		fmt.Fprintf(bw, "File%d=%s\n", i+1, e.Location)
+		fmt.Fprintf(bw, "Title%d=%s\n", i+1, title)
+		fmt.Fprintf(bw, "Length%d=%d\n", i+1, e.Duration)
+	}
+	fmt.Fprintf(bw, "NumberOfEntries=%d\n", len(entries))
+	fmt.Fprintln(bw, "Version=2")
+	return bw.Flush()
+}
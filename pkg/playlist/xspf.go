@@ -0,0 +1,79 @@
+package playlist
+
+import (
+	"encoding/xml"
+	"io"
+	"net/url"
+)
+
+// xspfPlaylist represents the root element of an XSPF playlist file.
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version string      `xml:"version,attr"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+// xspfTrack represents a track element of an XSPF playlist file. Duration is
+// in milliseconds.
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Duration int    `xml:"duration,omitempty"`
+}
+
+// readXSPF reads the entries of an XSPF playlist file.
+func readXSPF(r io.Reader) ([]Entry, error) {
+	var p xspfPlaylist
+	err := xml.NewDecoder(r).Decode(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(p.Tracks))
+	for _, t := range p.Tracks {
+		if len(t.Location) == 0 {
+			continue
+		}
+
+		// Locations are URIs, so relative locations are unescaped to paths.
+		location := t.Location
+		u, err := url.Parse(location)
+		if err == nil && len(u.Scheme) == 0 {
+			location = u.Path
+		}
+
+		e := Entry{Location: location, Title: t.Title, Artist: t.Creator, Duration: -1}
+		if t.Duration > 0 {
+			e.Duration = t.Duration / 1000
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// writeXSPF writes the given entries as an XSPF playlist file.
+func writeXSPF(w io.Writer, entries []Entry) error {
+	p := xspfPlaylist{Version: "1"}
+	for _, e := range entries {
+		t := xspfTrack{Location: uri(e.Location), Title: e.Title, Creator: e.Artist}
+		if e.Duration > 0 {
+			t.Duration = e.Duration * 1000
+		}
+		p.Tracks = append(p.Tracks, t)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(p)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -50,7 +50,8 @@ func (service *AlbumDiscogService) CreateAlbumDiscog(attributes *library.AlbumAt
 		service.insert = stmt
 	}
 
-	_, err := service.insert.Exec(
+	_, err := service.insert.ExecContext(
+		service.session.ctx,
 		attributes.ArtistName, attributes.ArtistSort,
 		attributes.Name,
 		attributes.Sort,
@@ -90,6 +91,47 @@ func (service *AlbumDiscogService) prepareInsert() (*sql.Stmt, error) {
 	return service.session.tx.Prepare(insert)
 }
 
+// updateArtist links the album with the given ID to its current artist.
+func (service *AlbumDiscogService) updateArtist(albumID string) error {
+	update :=
+		`UPDATE OR REPLACE album_discographies 
+		               SET artist_id = (SELECT artist_id 
+		                                  FROM albums 
+		                                 WHERE album_id = ?) 
+		             WHERE album_id = ?`
+	_, err := service.session.tx.Exec(update, albumID, albumID)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// deleteAlbumDiscogs deletes the records that link the album with the given ID.
+func (service *AlbumDiscogService) deleteAlbumDiscogs(albumID string) error {
+	_, err := service.session.tx.Exec(`DELETE FROM album_discographies WHERE album_id = ?`, albumID)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// prune deletes records for albums that no longer have any songs.
+func (service *AlbumDiscogService) prune() (int64, error) {
+	prune :=
+		`DELETE FROM album_discographies 
+		       WHERE album_id NOT IN (SELECT album_id 
+		                                FROM song_discographies 
+		                               WHERE album_id IS NOT NULL)`
+	result, err := service.session.tx.Exec(prune)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // Close closes all open statements.
 func (service *AlbumDiscogService) Close() error {
 	if service.insert != nil {
@@ -98,6 +140,7 @@ func (service *AlbumDiscogService) Close() error {
 			service.session.Logger.Println(err)
 			return err
 		}
+		service.insert = nil
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package sqlite
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 
 	"github.com/jeremybouzigard/library"
@@ -56,7 +57,8 @@ func (service *AlbumService) CreateAlbum(attributes *library.AlbumAttributes) er
 		service.insert = stmt
 	}
 
-	_, err := service.insert.Exec(
+	_, err := service.insert.ExecContext(
+		service.session.ctx,
 		attributes.Name,
 		attributes.ArtistName, attributes.ArtistSort,
 		attributes.GenreName,
@@ -115,42 +117,252 @@ func (service *AlbumService) prepareInsert() (*sql.Stmt, error) {
 	return service.session.tx.Prepare(insert)
 }
 
-// Album queries the 'albums' table for an album with the given ID and returns
-// the result along with any error.
-func (service *AlbumService) Album(ID string) (*library.Album, error) {
-	var a library.Album
+// UpdateAlbum updates the album with the given ID with the given attributes.
+// Empty attributes are left unchanged. A new genre is applied to the songs of
+// the album as well. The artist and genre named by the attributes are created
+// if they do not exist, and any artists and genres left without songs or
+// albums are deleted.
+func (service *AlbumService) UpdateAlbum(ID string, attributes *library.AlbumAttributes) error {
+	return service.session.inTx(func() error {
+		if len(attributes.GenreName) > 0 {
+			err := service.session.genreService.CreateGenre(&library.GenreAttributes{
+				Name: attributes.GenreName})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(attributes.ArtistName) > 0 {
+			err := service.session.artistService.CreateArtist(&library.ArtistAttributes{
+				Name: attributes.ArtistName,
+				Sort: attributes.ArtistSort})
+			if err != nil {
+				return err
+			}
+		}
+
+		update :=
+			`UPDATE albums 
+			    SET album_name = COALESCE(NULLIF(?, ''), album_name), 
+			        album_sort = COALESCE(NULLIF(?, ''), album_sort), 
+			        artist_id = COALESCE((SELECT artist_id 
+			                                FROM artists 
+			                               WHERE artist_name = NULLIF(?, '') 
+			                                 AND artist_sort = ?), artist_id), 
+			        genre_id = COALESCE((SELECT genre_id 
+			                               FROM genres 
+			                              WHERE genre_name = NULLIF(?, '')), genre_id), 
+			        release_date = COALESCE(NULLIF(?, ''), release_date), 
+			        album_artist = COALESCE(NULLIF(?, ''), album_artist), 
+			        album_artist_sort = COALESCE(NULLIF(?, ''), album_artist_sort) 
+			  WHERE album_id = ?`
+		result, err := service.session.tx.Exec(update,
+			attributes.Name,
+			attributes.Sort,
+			attributes.ArtistName, attributes.ArtistSort,
+			attributes.GenreName,
+			attributes.ReleaseDate,
+			attributes.AlbumArtist,
+			attributes.AlbumArtistSort,
+			ID)
+		if err == nil {
+			err = found(result)
+		}
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+
+		if len(attributes.GenreName) > 0 {
+			update :=
+				`UPDATE songs 
+				    SET genre_id = (SELECT genre_id 
+				                      FROM albums 
+				                     WHERE album_id = ?) 
+				  WHERE song_id IN (SELECT song_id 
+				                      FROM song_discographies 
+				                     WHERE album_id = ?)`
+			_, err := service.session.tx.Exec(update, ID, ID)
+			if err != nil {
+				service.session.Logger.Println(err)
+				return err
+			}
+		}
+
+		err = service.session.AlbumDiscogService.updateArtist(ID)
+		if err != nil {
+			return err
+		}
+		return service.session.prune(&ScanReport{})
+	})
+}
+
+// DeleteAlbum deletes the album with the given ID, along with any artists and
+// genres left without songs or albums. The songs of the album are kept but no
+// longer belong to an album.
+func (service *AlbumService) DeleteAlbum(ID string) error {
+	return service.session.inTx(func() error {
+		err := service.deleteAlbum(ID)
+		if err != nil {
+			return err
+		}
+		return service.session.prune(&ScanReport{})
+	})
+}
+
+// mergeAlbums merges the albums of the artist with the given ID that a scan
+// would take to be the same album, having the same name, sort name, release
+// date and genre, into the first of them. The songs, ratings and tags of the
+// other albums are moved to it, keeping the ratings of users who rated it
+// already, and the other albums are deleted.
+func (service *AlbumService) mergeAlbums(artistID string) error {
 	query :=
-		`SELECT
-			albums.album_id,
-			albums.album_name,
-			albums.album_sort,
-			artists.artist_name,
-			artists.artist_sort,
-			genres.genre_name,
-			albums.release_date
-		FROM
-			album_discographies
-			INNER JOIN artists ON album_discographies.artist_id = artists.artist_id
-			INNER JOIN albums ON album_discographies.album_id = albums.album_id
-			INNER JOIN genres ON albums.genre_id = genres.genre_id
-		WHERE 
-			albums.album_id = ?`
-	err := service.session.db.QueryRow(query, ID).Scan(
+		`SELECT album_id, first_id
+		   FROM (SELECT album_id,
+		                (SELECT MIN(same.album_id)
+		                   FROM albums AS same
+		                  WHERE same.artist_id = albums.artist_id
+		                    AND same.album_name = albums.album_name
+		                    AND same.album_sort IS albums.album_sort
+		                    AND same.release_date IS albums.release_date
+		                    AND same.genre_id IS albums.genre_id) AS first_id
+		           FROM albums
+		          WHERE artist_id = ?)
+		  WHERE album_id <> first_id`
+	rows, err := service.session.tx.Query(query, artistID)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	var merges [][2]string
+	for rows.Next() {
+		var m [2]string
+		err := rows.Scan(&m[0], &m[1])
+		if err != nil {
+			rows.Close()
+			service.session.Logger.Println(err)
+			return err
+		}
+		merges = append(merges, m)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+
+	for _, m := range merges {
+		updates := []string{
+			`UPDATE song_discographies SET album_id = ? WHERE album_id = ?`,
+			`UPDATE OR IGNORE album_discographies SET album_id = ? WHERE album_id = ?`,
+			`UPDATE OR IGNORE ratings SET resource_id = ? WHERE resource_type = 'albums' AND resource_id = ?`,
+			`UPDATE OR IGNORE taggings SET resource_id = ? WHERE resource_type = 'albums' AND resource_id = ?`,
+		}
+		for _, update := range updates {
+			_, err := service.session.tx.Exec(update, m[1], m[0])
+			if err != nil {
+				service.session.Logger.Println(err)
+				return err
+			}
+		}
+
+		deletes := []string{
+			`DELETE FROM album_discographies WHERE album_id = ?`,
+			`DELETE FROM ratings WHERE resource_type = 'albums' AND resource_id = ?`,
+			`DELETE FROM taggings WHERE resource_type = 'albums' AND resource_id = ?`,
+			`DELETE FROM albums WHERE album_id = ?`,
+		}
+		for _, d := range deletes {
+			_, err := service.session.tx.Exec(d, m[0])
+			if err != nil {
+				service.session.Logger.Println(err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteAlbum deletes the album with the given ID along with the records that
+// link it to its artists and songs.
+func (service *AlbumService) deleteAlbum(ID string) error {
+	err := service.session.AlbumDiscogService.deleteAlbumDiscogs(ID)
+	if err != nil {
+		return err
+	}
+
+	err = service.session.SongDiscogService.clearAlbum(ID)
+	if err != nil {
+		return err
+	}
+
+	result, err := service.session.tx.Exec(`DELETE FROM albums WHERE album_id = ?`, ID)
+	if err == nil {
+		err = found(result)
+	}
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// albumColumns lists the columns read by scanAlbum.
+const albumColumns = `
+		  albums.album_id,
+		  albums.album_name,
+		  albums.album_sort,
+		  artists.artist_name,
+		  artists.artist_sort,
+		  IFNULL(genres.genre_name, ''),
+		  albums.release_date,
+		  IFNULL(ratings.rating, 0),
+		  IFNULL(ratings.loved, 0)`
+
+// albumTables joins the tables that albumColumns are read from. The ratings
+// joined are those of the user given by the first argument of queries.
+const albumTables = `
+		  album_discographies
+		  INNER JOIN artists ON album_discographies.artist_id = artists.artist_id
+		  INNER JOIN albums ON album_discographies.album_id = albums.album_id
+		  LEFT JOIN genres ON albums.genre_id = genres.genre_id
+		  LEFT JOIN ratings ON ratings.user_id = ?
+		                   AND ratings.resource_type = 'albums'
+		                   AND ratings.resource_id = albums.album_id`
+
+// scanAlbum reads an album from a row that selects albumColumns.
+func scanAlbum(row rowScanner) (*library.Album, error) {
+	var a library.Album
+	err := row.Scan(
 		&a.ID,
 		&a.Attributes.Name,
 		&a.Attributes.Sort,
 		&a.Attributes.ArtistName,
 		&a.Attributes.ArtistSort,
 		&a.Attributes.GenreName,
-		&a.Attributes.ReleaseDate)
+		&a.Attributes.ReleaseDate,
+		&a.Attributes.Rating,
+		&a.Attributes.Loved)
+	a.Type = "albums"
+	return &a, err
+}
+
+// Album queries the 'albums' table for an album with the given ID and returns
+// the result along with any error.
+func (service *AlbumService) Album(ID string) (*library.Album, error) {
+	query := `SELECT` + albumColumns + ` FROM` + albumTables + `
+		WHERE 
+		  albums.album_id = ?`
+	a, err := scanAlbum(service.session.db.QueryRow(query, service.session.userID(), ID))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return &a, nil
+			return a, nil
 		}
 		service.session.Logger.Println(err)
-		return &a, err
+		return a, err
 	}
-	return &a, nil
+	return a, nil
 }
 
 // Albums queries the 'albums' table for all albums that meet the given criteria
@@ -163,47 +375,165 @@ func (service *AlbumService) Albums(queries map[string]string) ([]*library.Album
 		service.session.Logger.Println(err)
 		return results, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var a library.Album
-		err := rows.Scan(
-			&a.ID,
-			&a.Attributes.Name,
-			&a.Attributes.Sort,
-			&a.Attributes.ArtistName,
-			&a.Attributes.ArtistSort,
-			&a.Attributes.GenreName,
-			&a.Attributes.ReleaseDate)
-		a.Type = "albums"
+		a, err := scanAlbum(rows)
 		if err != nil {
 			service.session.Logger.Println(err)
 			return results, err
 		}
-		results = append(results, &a)
+		results = append(results, a)
+	}
+	if err := rows.Err(); err != nil {
+		service.session.Logger.Println(err)
+		return results, err
 	}
 
 	return results, nil
 }
 
-// Query executes a query for albums that meet the given predicate criteria and
-// returns the results along with any error.
+// AlbumsPage queries the 'albums' table for a page of the albums that meet the
+// given criteria, as Query reads them, and returns the result along with the
+// page and any error.
+func (service *AlbumService) AlbumsPage(queries map[string]string) ([]*library.Album, *library.Page, error) {
+	f, err := library.ParseAlbumFilter(queries)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return nil, nil, err
+	}
+	return service.FilterAlbums(f)
+}
+
+// FilterAlbums queries the 'albums' table for the page of albums that the given
+// filter selects and returns the result along with the page and any error.
+func (service *AlbumService) FilterAlbums(f *library.AlbumFilter) ([]*library.Album, *library.Page, error) {
+	var results []*library.Album
+
+	p, c, err := service.filter(f)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, nil, err
+	}
+
+	total, err := countRows(service.session.db, albumTables+c.where(), service.userArgs(c.args))
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, nil, err
+	}
+
+	p.filter(c)
+	query := bytes.NewBufferString(`SELECT` + albumColumns + p.columns() + ` FROM` + albumTables + c.where())
+	args := p.order(query, c.args, 1)
+	rows, err := service.session.db.Query(query.String(), service.userArgs(args)...)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAlbum(p.scanner(rows))
+		if err != nil {
+			service.session.Logger.Println(err)
+			return results, nil, err
+		}
+		if p.more() {
+			break
+		}
+		results = append(results, a)
+	}
+	if err := rows.Err(); err != nil {
+		service.session.Logger.Println(err)
+		return results, nil, err
+	}
+
+	page, err := p.page(total)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, nil, err
+	}
+	return results, page, nil
+}
+
+// albumFields maps the fields that albums may be sorted and filtered by onto
+// the expressions they are read from.
+var albumFields = map[string]ruleField{
+	"name":        {`albums.album_name`, textField},
+	"sortName":    {`IFNULL(NULLIF(albums.album_sort, ''), albums.album_name)`, textField},
+	"artist":      {`IFNULL(artists.artist_name, '')`, textField},
+	"artistSort":  {`IFNULL(NULLIF(artists.artist_sort, ''), artists.artist_name)`, textField},
+	"genre":       {`IFNULL(genres.genre_name, '')`, textField},
+	"year":        {`CAST(substr(albums.release_date, 1, 4) AS INTEGER)`, numberField},
+	"releaseDate": {`albums.release_date`, dateField},
+	"dateAdded":   {`(SELECT MIN(songs.date_added) FROM song_discographies AS sd INNER JOIN songs ON sd.song_id = songs.song_id WHERE sd.album_id = albums.album_id)`, dateField},
+	"rating":      {`IFNULL(ratings.rating, 0)`, numberField},
+	"loved":       {`IFNULL(ratings.loved, 0)`, numberField},
+}
+
+// Query executes a query for albums that meet the given predicate criteria,
+// which are parsed by library.ParseAlbumFilter, and returns the results along
+// with any error.
 func (service *AlbumService) Query(predicates map[string]string) (*sql.Rows, error) {
-	query := bytes.NewBufferString(
-		`SELECT
-		  albums.album_id,
-		  albums.album_name,
-		  albums.album_sort,
-		  artists.artist_name,
-		  artists.artist_sort,
-		  genres.genre_name,
-		  albums.release_date
-		FROM
-		  album_discographies
-		  INNER JOIN artists ON album_discographies.artist_id = artists.artist_id
-		  INNER JOIN albums ON album_discographies.album_id = albums.album_id
-		  INNER JOIN genres ON albums.genre_id = genres.genre_id`)
-	query, args := Where(query, predicates)
-	return service.session.db.Query(query.String(), args...)
+	f, err := library.ParseAlbumFilter(predicates)
+	if err != nil {
+		return nil, err
+	}
+
+	p, c, err := service.filter(f)
+	if err != nil {
+		return nil, err
+	}
+
+	p.filter(c)
+	query := bytes.NewBufferString(`SELECT` + albumColumns + ` FROM` + albumTables + c.where())
+	args := p.order(query, c.args, 0)
+	return service.session.db.Query(query.String(), service.userArgs(args)...)
+}
+
+// filter returns the pager and the conditions of the given filter, which are
+// read from albumTables.
+func (service *AlbumService) filter(f *library.AlbumFilter) (*pager, *conditions, error) {
+	err := f.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := newPager(&f.Filter, albumFields, "albums.album_id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &conditions{}
+	if len(f.ArtistID) > 0 {
+		c.add(`artists.artist_id = ?`, f.ArtistID)
+	}
+	if len(f.GenreID) > 0 {
+		c.add(`albums.genre_id = ?`, f.GenreID)
+	}
+	return p, c, c.filter(&f.Filter, "albums", albumFields)
+}
+
+// userArgs returns the argument of albumTables for the acting user followed
+// by the given arguments.
+func (service *AlbumService) userArgs(args []interface{}) []interface{} {
+	return append([]interface{}{service.session.userID()}, args...)
+}
+
+// prune deletes albums that no longer have any songs and returns the number of
+// albums deleted.
+func (service *AlbumService) prune() (int64, error) {
+	prune :=
+		`DELETE FROM albums 
+		       WHERE album_id NOT IN (SELECT album_id 
+		                                FROM song_discographies 
+		                               WHERE album_id IS NOT NULL)`
+	result, err := service.session.tx.Exec(prune)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 // Close closes all open statements.
@@ -214,6 +544,42 @@ func (service *AlbumService) Close() error {
 			service.session.Logger.Println(err)
 			return err
 		}
+		service.insert = nil
 	}
 	return nil
 }
+
+// AlbumContext calls Album within the given context.
+func (service *AlbumService) AlbumContext(ctx context.Context, ID string) (*library.Album, error) {
+	return service.session.bind(ctx).albumService.Album(ID)
+}
+
+// AlbumsContext calls Albums within the given context.
+func (service *AlbumService) AlbumsContext(ctx context.Context, queries map[string]string) ([]*library.Album, error) {
+	return service.session.bind(ctx).albumService.Albums(queries)
+}
+
+// AlbumsPageContext calls AlbumsPage within the given context.
+func (service *AlbumService) AlbumsPageContext(ctx context.Context, queries map[string]string) ([]*library.Album, *library.Page, error) {
+	return service.session.bind(ctx).albumService.AlbumsPage(queries)
+}
+
+// FilterAlbumsContext calls FilterAlbums within the given context.
+func (service *AlbumService) FilterAlbumsContext(ctx context.Context, f *library.AlbumFilter) ([]*library.Album, *library.Page, error) {
+	return service.session.bind(ctx).albumService.FilterAlbums(f)
+}
+
+// CreateAlbumContext calls CreateAlbum within the given context.
+func (service *AlbumService) CreateAlbumContext(ctx context.Context, attributes *library.AlbumAttributes) error {
+	return service.session.bind(ctx).albumService.CreateAlbum(attributes)
+}
+
+// UpdateAlbumContext calls UpdateAlbum within the given context.
+func (service *AlbumService) UpdateAlbumContext(ctx context.Context, ID string, attributes *library.AlbumAttributes) error {
+	return service.session.bind(ctx).albumService.UpdateAlbum(ID, attributes)
+}
+
+// DeleteAlbumContext calls DeleteAlbum within the given context.
+func (service *AlbumService) DeleteAlbumContext(ctx context.Context, ID string) error {
+	return service.session.bind(ctx).albumService.DeleteAlbum(ID)
+}
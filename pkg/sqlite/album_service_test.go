@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// TestUpdateAlbum checks that a new genre of an album is applied to its songs
+// and that the genre left without songs or albums is deleted.
+func TestUpdateAlbum(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	ID := queryTestID(t, ls, `SELECT album_id FROM albums WHERE album_name = 'First'`)
+
+	err := ls.Session.AlbumService().UpdateAlbum(ID, &library.AlbumAttributes{Name: "First (Deluxe)", GenreName: "Pop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := ls.Session.AlbumService().Album(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Attributes.Name != "First (Deluxe)" || a.Attributes.GenreName != "Pop" || a.Attributes.ArtistName != "Ann" {
+		t.Errorf("updated album has attributes %+v, want First (Deluxe) by Ann in Pop", a.Attributes)
+	}
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM songs INNER JOIN genres USING (genre_id) WHERE genre_name = 'Pop'`: 2,
+		`SELECT COUNT(*) FROM genres WHERE genre_name = 'Rock'`:                                  0,
+	} {
+		if n := queryTestInt(t, ls, query); n != want {
+			t.Errorf("%s = %d, want %d", query, n, want)
+		}
+	}
+
+	err = ls.Session.AlbumService().UpdateAlbum("999", &library.AlbumAttributes{Name: "None"})
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("UpdateAlbum of an unknown album returned %v, want ErrNotFound", err)
+	}
+}
+
+// TestDeleteAlbum checks that deleting an album removes it from the
+// discographies and keeps its songs without an album.
+func TestDeleteAlbum(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	ID := queryTestID(t, ls, `SELECT album_id FROM albums WHERE album_name = 'First'`)
+
+	err := ls.Session.AlbumService().DeleteAlbum(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM albums`:                                     1,
+		`SELECT COUNT(*) FROM album_discographies WHERE album_id = ` + ID: 0,
+		`SELECT COUNT(*) FROM song_discographies WHERE album_id = ` + ID:  0,
+		`SELECT COUNT(*) FROM song_discographies WHERE album_id IS NULL`:  2,
+		`SELECT COUNT(*) FROM songs`:                                      3,
+		`SELECT COUNT(*) FROM artists WHERE artist_name = 'Ann'`:          1,
+	} {
+		if n := queryTestInt(t, ls, query); n != want {
+			t.Errorf("%s = %d, want %d", query, n, want)
+		}
+	}
+
+	err = ls.Session.AlbumService().DeleteAlbum(ID)
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("DeleteAlbum of a deleted album returned %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// ArtistAliasService manages the alternative names under which artists are
+// tagged, so that files tagged with an alias are added to the canonical
+// artist.
+type ArtistAliasService struct {
+	session *Session
+	insert  *sql.Stmt
+	resolve *sql.Stmt
+}
+
+// NewArtistAliasService returns a new instance of an ArtistAliasService that
+// operates within the given session.
+func NewArtistAliasService(s *Session) ArtistAliasService {
+	service := ArtistAliasService{session: s}
+	return service
+}
+
+// CreateTable creates the 'artist_aliases' table and returns any errors.
+func (service *ArtistAliasService) CreateTable() (sql.Result, error) {
+	create :=
+		`CREATE TABLE IF NOT EXISTS artist_aliases (
+			alias_name TEXT    NOT NULL,
+			alias_sort TEXT    NOT NULL,
+			artist_id  INTEGER NOT NULL,
+			PRIMARY KEY('alias_name','alias_sort'),
+			FOREIGN KEY('artist_id') REFERENCES artists('artist_id')
+		)`
+	return service.session.tx.Exec(create)
+}
+
+// DropTable drops the 'artist_aliases' table and returns any errors.
+func (service *ArtistAliasService) DropTable() (sql.Result, error) {
+	drop := `DROP TABLE IF EXISTS artist_aliases`
+	return service.session.tx.Exec(drop)
+}
+
+// createAlias records the name of the artist with the given source ID as an
+// alias of the artist with the given target ID.
+func (service *ArtistAliasService) createAlias(targetID, sourceID string) error {
+	if service.insert == nil {
+		insert :=
+			`INSERT OR REPLACE INTO artist_aliases
+			                        (alias_name,
+			                         alias_sort,
+			                         artist_id)
+			                 SELECT artist_name,
+			                        IFNULL(artist_sort, ''),
+			                        ?
+			                   FROM artists
+			                  WHERE artist_id = ?`
+		stmt, err := service.session.tx.Prepare(insert)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		service.insert = stmt
+	}
+
+	result, err := service.insert.ExecContext(service.session.ctx, targetID, sourceID)
+	if err == nil {
+		err = found(result)
+	}
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// repoint moves the aliases of the artist with the given source ID to the
+// artist with the given target ID.
+func (service *ArtistAliasService) repoint(targetID, sourceID string) error {
+	update := `UPDATE artist_aliases SET artist_id = ? WHERE artist_id = ?`
+	_, err := service.session.tx.Exec(update, targetID, sourceID)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// Resolve replaces the given artist name and sort with those of the canonical
+// artist if they are an alias, and reports whether they were replaced.
+func (service *ArtistAliasService) Resolve(attributes *library.ArtistAttributes) (bool, error) {
+	if service.resolve == nil {
+		query :=
+			`SELECT artists.artist_name,
+			        IFNULL(artists.artist_sort, '')
+			   FROM artist_aliases
+			        INNER JOIN artists ON artist_aliases.artist_id = artists.artist_id
+			  WHERE artist_aliases.alias_name = ?
+			    AND artist_aliases.alias_sort = ?`
+		stmt, err := service.session.tx.Prepare(query)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return false, err
+		}
+		service.resolve = stmt
+	}
+
+	var name, sort string
+	err := service.resolve.QueryRowContext(service.session.ctx, attributes.Name, attributes.Sort).Scan(&name, &sort)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		service.session.Logger.Println(err)
+		return false, err
+	}
+
+	attributes.Name = name
+	attributes.Sort = sort
+	return true, nil
+}
+
+// prune deletes aliases of artists that no longer exist.
+func (service *ArtistAliasService) prune() (int64, error) {
+	prune :=
+		`DELETE FROM artist_aliases
+		       WHERE artist_id NOT IN (SELECT artist_id FROM artists)`
+	result, err := service.session.tx.Exec(prune)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Close closes all open statements.
+func (service *ArtistAliasService) Close() error {
+	if service.insert != nil {
+		err := service.insert.Close()
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		service.insert = nil
+	}
+
+	if service.resolve != nil {
+		err := service.resolve.Close()
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		service.resolve = nil
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package sqlite
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 
 	"github.com/jeremybouzigard/library"
@@ -48,7 +49,8 @@ func (service *ArtistService) CreateArtist(attributes *library.ArtistAttributes)
 		service.insert = stmt
 	}
 
-	_, err := service.insert.Exec(
+	_, err := service.insert.ExecContext(
+		service.session.ctx,
 		attributes.Name, attributes.Sort,
 		attributes.Name, attributes.Sort)
 
@@ -74,31 +76,189 @@ func (service *ArtistService) prepareInsert() (*sql.Stmt, error) {
 	return service.session.tx.Prepare(insert)
 }
 
+// UpdateArtist updates the artist with the given ID with the given attributes.
+// Empty attributes are left unchanged.
+func (service *ArtistService) UpdateArtist(ID string, attributes *library.ArtistAttributes) error {
+	return service.session.inTx(func() error {
+		update :=
+			`UPDATE artists 
+			    SET artist_name = COALESCE(NULLIF(?, ''), artist_name), 
+			        artist_sort = COALESCE(NULLIF(?, ''), artist_sort) 
+			  WHERE artist_id = ?`
+		result, err := service.session.tx.Exec(update,
+			attributes.Name,
+			attributes.Sort,
+			ID)
+		if err == nil {
+			err = found(result)
+		}
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		return nil
+	})
+}
+
+// DeleteArtist deletes the artist with the given ID along with their songs and
+// albums, and any genres left without songs or albums. The files of the songs
+// are left untouched, so the songs are added again by the next scan that finds
+// their files.
+func (service *ArtistService) DeleteArtist(ID string) error {
+	return service.session.inTx(func() error {
+		songs, err := service.session.ids(
+			`SELECT song_id FROM songs WHERE artist_id = ? 
+			  UNION 
+			 SELECT song_id FROM song_discographies WHERE artist_id = ?`, ID, ID)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		for _, songID := range songs {
+			err := service.session.songService.deleteSong(songID)
+			if err != nil {
+				return err
+			}
+		}
+
+		albums, err := service.session.ids(
+			`SELECT album_id FROM albums WHERE artist_id = ? 
+			  UNION 
+			 SELECT album_id FROM album_discographies WHERE artist_id = ?`, ID, ID)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		for _, albumID := range albums {
+			err := service.session.albumService.deleteAlbum(albumID)
+			if err != nil {
+				return err
+			}
+		}
+
+		result, err := service.session.tx.Exec(`DELETE FROM artists WHERE artist_id = ?`, ID)
+		if err == nil {
+			err = found(result)
+		}
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		return service.session.prune(&ScanReport{})
+	})
+}
+
+// MergeArtists merges the artists with the given source IDs into the artist
+// with the given target ID. The songs, albums, aliases and tags of the source
+// artists are moved to the target artist, as are their ratings for each user
+// who has not rated the target artist. The names of the source artists are
+// recorded as aliases of the target artist so that future scans of files
+// tagged with them add to the target artist, and the source artists are
+// deleted. Albums of the target artist that a scan would then take to be the
+// same album, having the same name, sort name, release date and genre, are
+// merged into one along with their songs, ratings and tags.
+func (service *ArtistService) MergeArtists(targetID string, sourceIDs ...string) error {
+	return service.session.inTx(func() error {
+		target, err := service.Artist(targetID)
+		if err != nil {
+			return err
+		}
+		if target == nil {
+			return library.ErrNotFound
+		}
+
+		for _, sourceID := range sourceIDs {
+			if sourceID == targetID {
+				continue
+			}
+
+			err := service.session.ArtistAliasService.createAlias(targetID, sourceID)
+			if err != nil {
+				return err
+			}
+
+			err = service.session.ArtistAliasService.repoint(targetID, sourceID)
+			if err != nil {
+				return err
+			}
+
+			updates := []string{
+				`UPDATE songs SET artist_id = ? WHERE artist_id = ?`,
+				`UPDATE albums SET artist_id = ? WHERE artist_id = ?`,
+				`UPDATE OR REPLACE album_discographies SET artist_id = ? WHERE artist_id = ?`,
+				`UPDATE OR REPLACE song_discographies SET artist_id = ? WHERE artist_id = ?`,
+				`UPDATE OR IGNORE ratings SET resource_id = ? WHERE resource_type = 'artists' AND resource_id = ?`,
+				`UPDATE OR IGNORE taggings SET resource_id = ? WHERE resource_type = 'artists' AND resource_id = ?`,
+			}
+			for _, update := range updates {
+				_, err := service.session.tx.Exec(update, targetID, sourceID)
+				if err != nil {
+					service.session.Logger.Println(err)
+					return err
+				}
+			}
+
+			deletes := []string{
+				`DELETE FROM ratings WHERE resource_type = 'artists' AND resource_id = ?`,
+				`DELETE FROM taggings WHERE resource_type = 'artists' AND resource_id = ?`,
+				`DELETE FROM artists WHERE artist_id = ?`,
+			}
+			for _, d := range deletes {
+				_, err := service.session.tx.Exec(d, sourceID)
+				if err != nil {
+					service.session.Logger.Println(err)
+					return err
+				}
+			}
+		}
+		return service.session.albumService.mergeAlbums(targetID)
+	})
+}
+
+// artistColumns lists the columns read by scanArtist.
+const artistColumns = `
+		  artists.artist_id,
+		  artists.artist_name,
+		  artists.artist_sort,
+		  IFNULL(ratings.rating, 0),
+		  IFNULL(ratings.loved, 0)`
+
+// artistTables joins the tables that artistColumns are read from. The ratings
+// joined are those of the user given by the first argument of queries.
+const artistTables = `
+		  artists
+		  LEFT JOIN ratings ON ratings.user_id = ?
+		                   AND ratings.resource_type = 'artists'
+		                   AND ratings.resource_id = artists.artist_id`
+
+// scanArtist reads an artist from a row that selects artistColumns.
+func scanArtist(row rowScanner) (*library.Artist, error) {
+	var a library.Artist
+	err := row.Scan(
+		&a.ID,
+		&a.Attributes.Name,
+		&a.Attributes.Sort,
+		&a.Attributes.Rating,
+		&a.Attributes.Loved)
+	a.Type = "artists"
+	return &a, err
+}
+
 // Artist queries the 'artists' table for an artist with the given ID and
 // returns the result along with any error.
 func (service *ArtistService) Artist(ID string) (*library.Artist, error) {
-	var a library.Artist
-	query :=
-		`SELECT
-			artist_id,
-			artist_name,
-			artist_sort
-		FROM
-			artists
+	query := `SELECT` + artistColumns + ` FROM` + artistTables + `
 		WHERE 
-			artist_id = ?`
-	err := service.session.db.QueryRow(query, ID).Scan(
-		&a.ID,
-		&a.Attributes.Name,
-		&a.Attributes.Sort)
+		  artists.artist_id = ?`
+	a, err := scanArtist(service.session.db.QueryRow(query, service.session.userID(), ID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		service.session.Logger.Println(err)
-		return &a, err
+		return a, err
 	}
-	return &a, nil
+	return a, nil
 }
 
 // Artists queries the 'artists' table for all artists that meet the given
@@ -111,19 +271,19 @@ func (service *ArtistService) Artists(queries map[string]string) ([]*library.Art
 		service.session.Logger.Println(err)
 		return results, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var a library.Artist
-		err := rows.Scan(
-			&a.ID,
-			&a.Attributes.Name,
-			&a.Attributes.Sort)
-		a.Type = "artists"
+		a, err := scanArtist(rows)
 		if err != nil {
 			service.session.Logger.Println(err)
 			return results, err
 		}
-		results = append(results, &a)
+		results = append(results, a)
+	}
+	if err := rows.Err(); err != nil {
+		service.session.Logger.Println(err)
+		return results, err
 	}
 
 	if len(results) < 1 {
@@ -133,18 +293,150 @@ func (service *ArtistService) Artists(queries map[string]string) ([]*library.Art
 	return results, nil
 }
 
-// Query executes a query for artists that meet the given predicate criteria and
-// returns the results along with any error.
+// ArtistsPage queries the 'artists' table for a page of the artists that meet
+// the given criteria, as Query reads them, and returns the result along with
+// the page and any error.
+func (service *ArtistService) ArtistsPage(queries map[string]string) ([]*library.Artist, *library.Page, error) {
+	f, err := library.ParseArtistFilter(queries)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return nil, nil, err
+	}
+	return service.FilterArtists(f)
+}
+
+// FilterArtists queries the 'artists' table for the page of artists that the
+// given filter selects and returns the result along with the page and any
+// error.
+func (service *ArtistService) FilterArtists(f *library.ArtistFilter) ([]*library.Artist, *library.Page, error) {
+	var results []*library.Artist
+
+	p, c, err := service.filter(f)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, nil, err
+	}
+
+	total, err := countRows(service.session.db, artistTables+c.where(), service.userArgs(c.args))
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, nil, err
+	}
+
+	p.filter(c)
+	query := bytes.NewBufferString(`SELECT` + artistColumns + p.columns() + ` FROM` + artistTables + c.where())
+	args := p.order(query, c.args, 1)
+	rows, err := service.session.db.Query(query.String(), service.userArgs(args)...)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanArtist(p.scanner(rows))
+		if err != nil {
+			service.session.Logger.Println(err)
+			return results, nil, err
+		}
+		if p.more() {
+			break
+		}
+		results = append(results, a)
+	}
+	if err := rows.Err(); err != nil {
+		service.session.Logger.Println(err)
+		return results, nil, err
+	}
+
+	page, err := p.page(total)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, nil, err
+	}
+	return results, page, nil
+}
+
+// artistFields maps the fields that artists may be sorted and filtered by onto
+// the expressions they are read from.
+var artistFields = map[string]ruleField{
+	"name":     {`artists.artist_name`, textField},
+	"sortName": {`IFNULL(NULLIF(artists.artist_sort, ''), artists.artist_name)`, textField},
+	"rating":   {`IFNULL(ratings.rating, 0)`, numberField},
+	"loved":    {`IFNULL(ratings.loved, 0)`, numberField},
+}
+
+// Query executes a query for artists that meet the given predicate criteria,
+// which are parsed by library.ParseArtistFilter, and returns the results along
+// with any error.
 func (service *ArtistService) Query(predicates map[string]string) (*sql.Rows, error) {
-	query := bytes.NewBufferString(
-		`SELECT
-		  artist_id,
-		  artist_name,
-		  artist_sort
-		FROM
-		  artists`)
-	query, args := Where(query, predicates)
-	return service.session.db.Query(query.String(), args...)
+	f, err := library.ParseArtistFilter(predicates)
+	if err != nil {
+		return nil, err
+	}
+
+	p, c, err := service.filter(f)
+	if err != nil {
+		return nil, err
+	}
+
+	p.filter(c)
+	query := bytes.NewBufferString(`SELECT` + artistColumns + ` FROM` + artistTables + c.where())
+	args := p.order(query, c.args, 0)
+	return service.session.db.Query(query.String(), service.userArgs(args)...)
+}
+
+// filter returns the pager and the conditions of the given filter, which are
+// read from artistTables.
+func (service *ArtistService) filter(f *library.ArtistFilter) (*pager, *conditions, error) {
+	err := f.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := newPager(&f.Filter, artistFields, "artists.artist_id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &conditions{}
+	if len(f.AlbumID) > 0 {
+		albumArtists :=
+			`artists.artist_id IN (SELECT artist_id FROM album_discographies WHERE album_id = ?
+			                       UNION
+			                       SELECT artist_id FROM song_discographies WHERE album_id = ?)`
+		c.add(albumArtists, f.AlbumID, f.AlbumID)
+	}
+	if len(f.GenreID) > 0 {
+		genreArtists :=
+			`artists.artist_id IN (SELECT artist_id FROM albums WHERE genre_id = ?
+			                       UNION
+			                       SELECT artist_id FROM songs WHERE genre_id = ?)`
+		c.add(genreArtists, f.GenreID, f.GenreID)
+	}
+	return p, c, c.filter(&f.Filter, "artists", artistFields)
+}
+
+// userArgs returns the argument of artistTables for the acting user followed
+// by the given arguments.
+func (service *ArtistService) userArgs(args []interface{}) []interface{} {
+	return append([]interface{}{service.session.userID()}, args...)
+}
+
+// prune deletes artists that no longer have any songs or albums and returns
+// the number of artists deleted.
+func (service *ArtistService) prune() (int64, error) {
+	prune :=
+		`DELETE FROM artists 
+		       WHERE artist_id NOT IN (SELECT artist_id FROM songs) 
+		         AND artist_id NOT IN (SELECT artist_id FROM albums) 
+		         AND artist_id NOT IN (SELECT artist_id FROM song_discographies)`
+	result, err := service.session.tx.Exec(prune)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 // Close closes all open statements.
@@ -155,7 +447,48 @@ func (service *ArtistService) Close() error {
 			service.session.Logger.Println(err)
 			return err
 		}
+		service.insert = nil
 	}
 
 	return nil
 }
+
+// ArtistContext calls Artist within the given context.
+func (service *ArtistService) ArtistContext(ctx context.Context, ID string) (*library.Artist, error) {
+	return service.session.bind(ctx).artistService.Artist(ID)
+}
+
+// ArtistsContext calls Artists within the given context.
+func (service *ArtistService) ArtistsContext(ctx context.Context, queries map[string]string) ([]*library.Artist, error) {
+	return service.session.bind(ctx).artistService.Artists(queries)
+}
+
+// ArtistsPageContext calls ArtistsPage within the given context.
+func (service *ArtistService) ArtistsPageContext(ctx context.Context, queries map[string]string) ([]*library.Artist, *library.Page, error) {
+	return service.session.bind(ctx).artistService.ArtistsPage(queries)
+}
+
+// FilterArtistsContext calls FilterArtists within the given context.
+func (service *ArtistService) FilterArtistsContext(ctx context.Context, f *library.ArtistFilter) ([]*library.Artist, *library.Page, error) {
+	return service.session.bind(ctx).artistService.FilterArtists(f)
+}
+
+// CreateArtistContext calls CreateArtist within the given context.
+func (service *ArtistService) CreateArtistContext(ctx context.Context, attributes *library.ArtistAttributes) error {
+	return service.session.bind(ctx).artistService.CreateArtist(attributes)
+}
+
+// UpdateArtistContext calls UpdateArtist within the given context.
+func (service *ArtistService) UpdateArtistContext(ctx context.Context, ID string, attributes *library.ArtistAttributes) error {
+	return service.session.bind(ctx).artistService.UpdateArtist(ID, attributes)
+}
+
+// DeleteArtistContext calls DeleteArtist within the given context.
+func (service *ArtistService) DeleteArtistContext(ctx context.Context, ID string) error {
+	return service.session.bind(ctx).artistService.DeleteArtist(ID)
+}
+
+// MergeArtistsContext calls MergeArtists within the given context.
+func (service *ArtistService) MergeArtistsContext(ctx context.Context, targetID string, sourceIDs ...string) error {
+	return service.session.bind(ctx).artistService.MergeArtists(targetID, sourceIDs...)
+}
@@ -0,0 +1,339 @@
+package sqlite
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// scanTestArtists scans a file for each of the given artists and returns the
+// IDs of the artists in the same order.
+func scanTestArtists(t *testing.T, ls *Service, dir string, names ...string) []string {
+	t.Helper()
+
+	for _, name := range names {
+		writeTestFile(t, filepath.Join(dir, name+".mp3"), "title", name, "artist", name)
+	}
+	_, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var IDs []string
+	for _, name := range names {
+		artists, err := ls.Session.ArtistService().Artists(map[string]string{"filter[name]": name})
+		if err != nil || len(artists) != 1 {
+			t.Fatalf("Artists found %d artists named %s (%v), want 1", len(artists), name, err)
+		}
+		IDs = append(IDs, artists[0].ID)
+	}
+	return IDs
+}
+
+// TestMergeArtistsRatings checks that a merged artist keeps its own rating over
+// those of the artists merged into it.
+func TestMergeArtistsRatings(t *testing.T) {
+	dir := t.TempDir()
+	ls := openTestService(t)
+	IDs := scanTestArtists(t, ls, dir, "Ann", "Anne", "Annie")
+	target, loved, rated := IDs[0], IDs[1], IDs[2]
+
+	ratings := ls.Session.RatingService()
+	for _, err := range []error{
+		ratings.Rate("artists", target, 3),
+		ratings.Love("artists", loved, true),
+		ratings.Rate("artists", rated, 5),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := ls.Session.ArtistService().MergeArtists(target, loved, rated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := ls.Session.ArtistService().Artist(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Attributes.Rating != 3 {
+		t.Errorf("merged artist has rating %v, want its own rating 3", a.Attributes.Rating)
+	}
+
+	var n int
+	err = ls.Session.db.QueryRow(`SELECT COUNT(*) FROM ratings WHERE resource_type = 'artists'`).Scan(&n)
+	if err != nil || n != 1 {
+		t.Errorf("ratings has %d artist rows (%v), want 1", n, err)
+	}
+}
+
+// TestMergeArtistsLoved checks that a merged artist is loved if an artist
+// merged into it was.
+func TestMergeArtistsLoved(t *testing.T) {
+	dir := t.TempDir()
+	ls := openTestService(t)
+	IDs := scanTestArtists(t, ls, dir, "Ann", "Anne")
+
+	err := ls.Session.RatingService().Love("artists", IDs[1], true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ls.Session.ArtistService().MergeArtists(IDs[0], IDs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := ls.Session.ArtistService().Artist(IDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Attributes.Loved {
+		t.Error("merged artist is not loved, want the loved flag of the source artist")
+	}
+}
+
+// TestMergeArtistsTags checks that a merged artist takes the tags of the
+// artists merged into it, once each.
+func TestMergeArtistsTags(t *testing.T) {
+	dir := t.TempDir()
+	ls := openTestService(t)
+	IDs := scanTestArtists(t, ls, dir, "Ann", "Anne")
+
+	tags := ls.Session.TagService()
+	for _, err := range []error{
+		tags.AddTag("artists", IDs[0], "shared"),
+		tags.AddTag("artists", IDs[1], "shared"),
+		tags.AddTag("artists", IDs[1], "source"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := ls.Session.ArtistService().MergeArtists(IDs[0], IDs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := tags.ResourceTags("artists", IDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged) != 2 {
+		t.Errorf("merged artist has %d tags, want 2", len(merged))
+	}
+
+	var n int
+	err = ls.Session.db.QueryRow(`SELECT COUNT(*) FROM taggings WHERE resource_type = 'artists'`).Scan(&n)
+	if err != nil || n != 2 {
+		t.Errorf("taggings has %d artist rows (%v), want 2", n, err)
+	}
+}
+
+// TestUpdateArtist checks that an update changes only the given attributes of
+// an artist.
+func TestUpdateArtist(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	ID := queryTestID(t, ls, `SELECT artist_id FROM artists WHERE artist_name = 'Ann'`)
+
+	err := ls.Session.ArtistService().UpdateArtist(ID, &library.ArtistAttributes{Sort: "Ann, The"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := ls.Session.ArtistService().Artist(ID)
+	if err != nil || a.Attributes.Name != "Ann" || a.Attributes.Sort != "Ann, The" {
+		t.Errorf("Artist(%s) returned %+v (%v), want Ann sorted as Ann, The", ID, a, err)
+	}
+
+	err = ls.Session.ArtistService().UpdateArtist("999", &library.ArtistAttributes{Name: "None"})
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("UpdateArtist of an unknown artist returned %v, want ErrNotFound", err)
+	}
+}
+
+// TestDeleteArtist checks that deleting an artist deletes their songs and
+// albums along with the genre left without songs or albums.
+func TestDeleteArtist(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	ID := queryTestID(t, ls, `SELECT artist_id FROM artists WHERE artist_name = 'Bob'`)
+
+	err := ls.Session.ArtistService().DeleteArtist(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM artists`:             1,
+		`SELECT COUNT(*) FROM songs`:               2,
+		`SELECT COUNT(*) FROM albums`:              1,
+		`SELECT COUNT(*) FROM genres`:              1,
+		`SELECT COUNT(*) FROM song_discographies`:  2,
+		`SELECT COUNT(*) FROM album_discographies`: 1,
+	} {
+		if n := queryTestInt(t, ls, query); n != want {
+			t.Errorf("%s = %d, want %d", query, n, want)
+		}
+	}
+
+	err = ls.Session.ArtistService().DeleteArtist(ID)
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("DeleteArtist of a deleted artist returned %v, want ErrNotFound", err)
+	}
+}
+
+// TestMergeArtistsAliases checks that scans add files tagged with the names of
+// merged artists to the target artist, including after the target is merged
+// into another artist in turn.
+func TestMergeArtistsAliases(t *testing.T) {
+	dir := t.TempDir()
+	ls := openTestService(t)
+	IDs := scanTestArtists(t, ls, dir, "Ann", "Anne", "Annie")
+
+	err := ls.Session.ArtistService().MergeArtists(IDs[0], IDs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "new.mp3"), "title", "New", "artist", "Anne")
+	_, err = ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM artists WHERE artist_name = 'Anne'`: 0,
+		`SELECT COUNT(*) FROM songs WHERE artist_id = ` + IDs[0]:  3,
+	} {
+		if n := queryTestInt(t, ls, query); n != want {
+			t.Errorf("%s = %d, want %d", query, n, want)
+		}
+	}
+
+	err = ls.Session.ArtistService().MergeArtists(IDs[2], IDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "newer.mp3"), "title", "Newer", "artist", "Anne")
+	_, err = ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM artists`:                                    1,
+		`SELECT COUNT(*) FROM songs WHERE artist_id = ` + IDs[2]:          5,
+		`SELECT COUNT(*) FROM artist_aliases WHERE artist_id = ` + IDs[2]: 2,
+	} {
+		if n := queryTestInt(t, ls, query); n != want {
+			t.Errorf("%s = %d, want %d", query, n, want)
+		}
+	}
+
+	err = ls.Session.ArtistService().MergeArtists("999", IDs[2])
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("MergeArtists into an unknown artist returned %v, want ErrNotFound", err)
+	}
+}
+
+// TestMergeArtistsAlbums checks that merging artists merges the albums that a
+// scan would take to be the same album, along with their songs, ratings and
+// tags, and leaves albums that differ apart.
+func TestMergeArtistsAlbums(t *testing.T) {
+	ls := openTestService(t)
+	for _, f := range [][]string{
+		{"1", "Ann", "First", "Rock"},
+		{"2", "Ann", "First", "Rock"},
+		{"3", "Anne", "Draft", "Rock"},
+		{"4", "Anne", "Demo", "Jazz"},
+		{"5", "Anne", "Second", "Rock"},
+	} {
+		addTestSong(t, ls,
+			&library.SongAttributes{FilePath: "/music/" + f[0] + ".mp3", Name: f[0], ArtistName: f[1], GenreName: f[3]},
+			&library.AlbumAttributes{Name: f[2], ReleaseDate: "1999"})
+	}
+	alice := ls.Session.WithUser(createTestUsers(t, ls, "Alice")[0])
+
+	album := func(name string) string {
+		return queryTestID(t, ls, `SELECT album_id FROM albums WHERE album_name = ?`, name)
+	}
+	target, source, jazz := album("First"), album("Draft"), album("Demo")
+	for _, err := range []error{
+		ls.Session.AlbumService().UpdateAlbum(source, &library.AlbumAttributes{Name: "First"}),
+		ls.Session.AlbumService().UpdateAlbum(jazz, &library.AlbumAttributes{Name: "First"}),
+		ls.Session.RatingService().Rate("albums", target, 3),
+		ls.Session.RatingService().Rate("albums", source, 5),
+		ls.Session.RatingService().Love("albums", source, true),
+		alice.RatingService().Rate("albums", source, 4),
+		ls.Session.TagService().AddTag("albums", target, "shared"),
+		ls.Session.TagService().AddTag("albums", source, "shared"),
+		ls.Session.TagService().AddTag("albums", source, "source"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ann := queryTestID(t, ls, `SELECT artist_id FROM artists WHERE artist_name = 'Ann'`)
+	anne := queryTestID(t, ls, `SELECT artist_id FROM artists WHERE artist_name = 'Anne'`)
+	err := ls.Session.ArtistService().MergeArtists(ann, anne)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := queryTestInt(t, ls, `SELECT COUNT(*) FROM albums`); n != 3 {
+		t.Errorf("library has %d albums, want First, First on Jazz and Second", n)
+	}
+	if n := queryTestInt(t, ls, `SELECT COUNT(*) FROM albums WHERE album_id = ?`, source); n != 0 {
+		t.Error("merged album still exists")
+	}
+	for album, want := range map[string]int{target: 3, jazz: 1} {
+		if n := queryTestInt(t, ls, `SELECT COUNT(*) FROM song_discographies WHERE album_id = ?`, album); n != want {
+			t.Errorf("album %s has %d songs, want %d", album, n, want)
+		}
+	}
+	if n := queryTestInt(t, ls, `SELECT COUNT(*) FROM album_discographies WHERE album_id = ?`, target); n != 1 {
+		t.Errorf("merged album has %d discographies, want 1", n)
+	}
+
+	for name, tt := range map[string]struct {
+		session *Session
+		rating  float64
+		loved   bool
+	}{
+		"no user": {ls.Session, 3, false},
+		"Alice":   {alice, 4, false},
+	} {
+		a, err := tt.session.AlbumService().Album(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Attributes.Rating != tt.rating || a.Attributes.Loved != tt.loved {
+			t.Errorf("%s sees the merged album rated %v and loved %v, want %v and %v",
+				name, a.Attributes.Rating, a.Attributes.Loved, tt.rating, tt.loved)
+		}
+	}
+
+	tags, err := ls.Session.TagService().ResourceTags("albums", target)
+	if err != nil || len(tags) != 2 {
+		t.Errorf("merged album has %d tags (%v), want 2", len(tags), err)
+	}
+	for _, table := range []string{"ratings", "taggings"} {
+		if n := queryTestInt(t, ls, `SELECT COUNT(*) FROM `+table+` WHERE resource_type = 'albums' AND resource_id = ?`, source); n != 0 {
+			t.Errorf("%s holds %d rows of the merged album, want none", table, n)
+		}
+	}
+}
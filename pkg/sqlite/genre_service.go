@@ -1,6 +1,7 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/jeremybouzigard/library"
@@ -47,7 +48,7 @@ func (service *GenreService) CreateGenre(attributes *library.GenreAttributes) er
 		service.insert = stmt
 	}
 
-	_, err := service.insert.Exec(attributes.Name, attributes.Name)
+	_, err := service.insert.ExecContext(service.session.ctx, attributes.Name, attributes.Name)
 	if err != nil {
 		service.session.Logger.Println(err)
 		return err
@@ -66,6 +67,54 @@ func (service *GenreService) prepareInsert() (*sql.Stmt, error) {
 	return service.session.tx.Prepare(insert)
 }
 
+// UpdateGenre updates the genre with the given ID with the given attributes.
+// Empty attributes are left unchanged.
+func (service *GenreService) UpdateGenre(ID string, attributes *library.GenreAttributes) error {
+	return service.session.inTx(func() error {
+		update :=
+			`UPDATE genres 
+			    SET genre_name = COALESCE(NULLIF(?, ''), genre_name) 
+			  WHERE genre_id = ?`
+		result, err := service.session.tx.Exec(update, attributes.Name, ID)
+		if err == nil {
+			err = found(result)
+		}
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		return nil
+	})
+}
+
+// DeleteGenre deletes the genre with the given ID. Its songs and albums are
+// kept but no longer have a genre.
+func (service *GenreService) DeleteGenre(ID string) error {
+	return service.session.inTx(func() error {
+		_, err := service.session.tx.Exec(`UPDATE songs SET genre_id = NULL WHERE genre_id = ?`, ID)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+
+		_, err = service.session.tx.Exec(`UPDATE albums SET genre_id = NULL WHERE genre_id = ?`, ID)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+
+		result, err := service.session.tx.Exec(`DELETE FROM genres WHERE genre_id = ?`, ID)
+		if err == nil {
+			err = found(result)
+		}
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		return nil
+	})
+}
+
 // Genre queries the 'genres' table for a genre with the given ID and returns
 // the result along with any error.
 func (service *GenreService) Genre(ID string) (*library.Genre, error) {
@@ -96,6 +145,7 @@ func (service *GenreService) Genres() ([]*library.Genre, error) {
 		service.session.Logger.Println(err)
 		return results, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var res library.Genre
@@ -109,9 +159,32 @@ func (service *GenreService) Genres() ([]*library.Genre, error) {
 		}
 		results = append(results, &res)
 	}
+	if err := rows.Err(); err != nil {
+		service.session.Logger.Println(err)
+		return results, err
+	}
 	return results, nil
 }
 
+// prune deletes genres that no longer have any songs or albums and returns the
+// number of genres deleted.
+func (service *GenreService) prune() (int64, error) {
+	prune :=
+		`DELETE FROM genres 
+		       WHERE genre_id NOT IN (SELECT genre_id 
+		                                FROM songs 
+		                               WHERE genre_id IS NOT NULL) 
+		         AND genre_id NOT IN (SELECT genre_id 
+		                                FROM albums 
+		                               WHERE genre_id IS NOT NULL)`
+	result, err := service.session.tx.Exec(prune)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // Close closes all open statements.
 func (service *GenreService) Close() error {
 	if service.insert != nil {
@@ -120,15 +193,42 @@ func (service *GenreService) Close() error {
 			service.session.Logger.Println(err)
 			return err
 		}
+		service.insert = nil
 	}
 
 	if service.Select != nil {
-		err := service.insert.Close()
+		err := service.Select.Close()
 		if err != nil {
 			service.session.Logger.Println(err)
 			return err
 		}
+		service.Select = nil
 	}
 
 	return nil
 }
+
+// GenreContext calls Genre within the given context.
+func (service *GenreService) GenreContext(ctx context.Context, ID string) (*library.Genre, error) {
+	return service.session.bind(ctx).genreService.Genre(ID)
+}
+
+// GenresContext calls Genres within the given context.
+func (service *GenreService) GenresContext(ctx context.Context) ([]*library.Genre, error) {
+	return service.session.bind(ctx).genreService.Genres()
+}
+
+// CreateGenreContext calls CreateGenre within the given context.
+func (service *GenreService) CreateGenreContext(ctx context.Context, attributes *library.GenreAttributes) error {
+	return service.session.bind(ctx).genreService.CreateGenre(attributes)
+}
+
+// UpdateGenreContext calls UpdateGenre within the given context.
+func (service *GenreService) UpdateGenreContext(ctx context.Context, ID string, attributes *library.GenreAttributes) error {
+	return service.session.bind(ctx).genreService.UpdateGenre(ID, attributes)
+}
+
+// DeleteGenreContext calls DeleteGenre within the given context.
+func (service *GenreService) DeleteGenreContext(ctx context.Context, ID string) error {
+	return service.session.bind(ctx).genreService.DeleteGenre(ID)
+}
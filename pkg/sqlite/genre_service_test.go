@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// TestUpdateGenre checks that a genre can be renamed.
+func TestUpdateGenre(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	ID := queryTestID(t, ls, `SELECT genre_id FROM genres WHERE genre_name = 'Rock'`)
+
+	err := ls.Session.GenreService().UpdateGenre(ID, &library.GenreAttributes{Name: "Rock & Roll"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := ls.Session.GenreService().Genre(ID)
+	if err != nil || g.Attributes.Name != "Rock & Roll" {
+		t.Errorf("Genre(%s) returned %+v (%v), want Rock & Roll", ID, g, err)
+	}
+
+	err = ls.Session.GenreService().UpdateGenre("999", &library.GenreAttributes{Name: "None"})
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("UpdateGenre of an unknown genre returned %v, want ErrNotFound", err)
+	}
+}
+
+// TestDeleteGenre checks that deleting a genre keeps its songs and albums
+// without a genre.
+func TestDeleteGenre(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	ID := queryTestID(t, ls, `SELECT genre_id FROM genres WHERE genre_name = 'Jazz'`)
+
+	err := ls.Session.GenreService().DeleteGenre(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM genres`:                        1,
+		`SELECT COUNT(*) FROM songs WHERE genre_id IS NULL`:  1,
+		`SELECT COUNT(*) FROM albums WHERE genre_id IS NULL`: 1,
+		`SELECT COUNT(*) FROM songs`:                         3,
+	} {
+		if n := queryTestInt(t, ls, query); n != want {
+			t.Errorf("%s = %d, want %d", query, n, want)
+		}
+	}
+
+	err = ls.Session.GenreService().DeleteGenre(ID)
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("DeleteGenre of a deleted genre returned %v, want ErrNotFound", err)
+	}
+}
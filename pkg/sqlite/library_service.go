@@ -1,12 +1,9 @@
 package sqlite
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"path/filepath"
-
-	"github.com/jeremybouzigard/library"
-	"github.com/jeremybouzigard/metadata/pkg/metadata"
 )
 
 // Service manages interactions with the media library.
@@ -23,13 +20,26 @@ func NewService(path string) Service {
 	return ls
 }
 
-// Open opens and initializes a new library session.
+// Open opens and initializes a new library session, migrating the library to
+// the current schema version.
 func (ls *Service) Open() error {
 	if ls.Session != nil {
 		return fmt.Errorf("library session already opened")
 	}
-	ls.client.Open()
-	ls.Session = ls.client.Connect()
+
+	err := ls.client.Open()
+	if err != nil {
+		return err
+	}
+
+	s := ls.client.Connect()
+	err = s.migrate()
+	if err != nil {
+		ls.client.Close()
+		return err
+	}
+
+	ls.Session = s
 	return nil
 }
 
@@ -43,104 +53,136 @@ func (ls *Service) Close() error {
 	return nil
 }
 
-// CreateLibrary creates library tables in the data source.
+// WithUser returns a service for the same library in which the user with the
+// given ID is acting, so that one open library can serve many users. Recording
+// playlists, plays and ratings returns library.ErrNotFound if there is no such
+// user. The returned service shares the connection of this service and must
+// not be closed.
+func (ls *Service) WithUser(ID string) *Service {
+	return &Service{client: ls.client, Session: ls.Session.WithUser(ID)}
+}
+
+// Version returns the schema version of the library.
+func (ls *Service) Version() (int, error) {
+	return ls.Session.Version()
+}
+
+// CreateLibrary creates library tables in the data source by applying any
+// migrations the library has not had yet.
 func (ls *Service) CreateLibrary() error {
+	return ls.Session.migrate()
+}
+
+// CreateLibraryContext calls CreateLibrary within the given context.
+func (ls *Service) CreateLibraryContext(ctx context.Context) error {
+	return ls.Session.bind(ctx).migrate()
+}
+
+// DeleteLibraryContext calls DeleteLibrary within the given context.
+func (ls *Service) DeleteLibraryContext(ctx context.Context) error {
+	b := &Service{client: ls.client, Session: ls.Session.bind(ctx)}
+	return b.DeleteLibrary()
+}
+
+// DeleteLibrary deletes all library data and drops tables from the data source.
+func (ls *Service) DeleteLibrary() error {
 	err := ls.Session.BeginTx()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	_, err = ls.Session.genreService.CreateTable()
+	defer ls.Session.albumService.Close()
+	defer ls.Session.AlbumDiscogService.Close()
+	defer ls.Session.artistService.Close()
+	defer ls.Session.genreService.Close()
+	defer ls.Session.SongDiscogService.Close()
+
+	_, err = ls.Session.searchService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	_, err = ls.Session.artistService.CreateTable()
+	_, err = ls.Session.genreService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	_, err = ls.Session.albumService.CreateTable()
+	_, err = ls.Session.artistService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	_, err = ls.Session.songService.CreateTable()
+	_, err = ls.Session.albumService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	_, err = ls.Session.AlbumDiscogService.CreateTable()
+	_, err = ls.Session.songService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	_, err = ls.Session.SongDiscogService.CreateTable()
+	_, err = ls.Session.AlbumDiscogService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	err = ls.Session.CommitTx()
+	_, err = ls.Session.SongDiscogService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	return nil
-}
-
-// DeleteLibrary deletes all library data and drops tables from the data source.
-func (ls *Service) DeleteLibrary() error {
-	err := ls.Session.BeginTx()
+	_, err = ls.Session.userService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	defer ls.Session.albumService.Close()
-	defer ls.Session.AlbumDiscogService.Close()
-	defer ls.Session.artistService.Close()
-	defer ls.Session.genreService.Close()
-	defer ls.Session.SongDiscogService.Close()
+	_, err = ls.Session.tagService.DropTable()
+	if err != nil {
+		ls.Session.Logger.Println(err)
+		return err
+	}
 
-	_, err = ls.Session.genreService.DropTable()
+	_, err = ls.Session.ratingService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	_, err = ls.Session.artistService.DropTable()
+	_, err = ls.Session.playService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	_, err = ls.Session.albumService.DropTable()
+	_, err = ls.Session.playlistService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	_, err = ls.Session.songService.DropTable()
+	_, err = ls.Session.ArtistAliasService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	_, err = ls.Session.AlbumDiscogService.DropTable()
+	_, err = ls.Session.RootService.DropTable()
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
 	}
 
-	_, err = ls.Session.SongDiscogService.DropTable()
+	err = ls.Session.setVersion(0)
 	if err != nil {
 		ls.Session.Logger.Println(err)
 		return err
@@ -155,63 +197,41 @@ func (ls *Service) DeleteLibrary() error {
 	return nil
 }
 
-// AddPath adds media data within the given path to the library.
-func (ls *Service) AddPath(path string) error {
-	err := ls.Session.BeginTx()
+// AddPath adds media data within the given path to the library. Songs whose
+// files are unchanged since the last scan are skipped, songs whose files have
+// changed are updated, and songs whose files no longer exist are deleted along
+// with any albums, artists and genres left without files. The path is added as
+// a library root unless it lies within one already; RootService.Add adds a
+// root without scanning it.
+func (ls *Service) AddPath(path string) (*ScanReport, error) {
+	return ls.Scan(path, nil)
+}
+
+// Scan adds media data within the given path to the library as AddPath does,
+// reading files as configured by the given options.
+func (ls *Service) Scan(path string, opts *ScanOptions) (*ScanReport, error) {
+	return ls.ScanContext(context.Background(), path, opts)
+}
+
+// ScanContext adds media data within the given path to the library as Scan
+// does. The path is added as a library root unless it lies within one already.
+// If the context is cancelled before the scan completes, the scan stops, every
+// change it made is rolled back and no report is returned.
+func (ls *Service) ScanContext(ctx context.Context, path string, opts *ScanOptions) (*ScanReport, error) {
+	path, err := filepath.Abs(path)
 	if err != nil {
-		ls.Session.Logger.Println(err)
-		return err
+		return nil, err
 	}
 
-	ms := metadata.Service{}
-	filepath.Walk(path, func(path string, f os.FileInfo, err error) error {
-		metadata, err := ms.Metadata(path)
-		if err != nil {
-			ls.Session.Logger.Println(err)
-		} else {
-			genre := library.GenreAttributes{
-				Name: metadata.Genre}
-
-			artist := library.ArtistAttributes{
-				Name: metadata.Artist,
-				Sort: metadata.ArtistSort}
-
-			album := library.AlbumAttributes{
-				Name:        metadata.Album,
-				Sort:        metadata.AlbumSort,
-				ArtistName:  metadata.Artist,
-				ArtistSort:  metadata.ArtistSort,
-				GenreName:   metadata.Genre,
-				ReleaseDate: metadata.Year}
-
-			song := library.SongAttributes{
-				FilePath:    path,
-				FileBase:    filepath.Base(path),
-				FileDir:     filepath.Dir(path),
-				ArtistName:  metadata.Artist,
-				ArtistSort:  metadata.ArtistSort,
-				Name:        metadata.Title,
-				GenreName:   metadata.Genre,
-				TrackNumber: metadata.Track,
-				ReleaseDate: metadata.Year,
-				Lyrics:      metadata.Lyrics,
-				Comments:    metadata.Comment}
-
-			ls.Session.genreService.CreateGenre(&genre)
-			ls.Session.artistService.CreateArtist(&artist)
-			ls.Session.albumService.CreateAlbum(&album)
-			ls.Session.songService.CreateSong(&song)
-			ls.Session.AlbumDiscogService.CreateAlbumDiscog(&album)
-			ls.Session.SongDiscogService.CreateSongDiscog(&song, &album)
-		}
-
-		return nil
-	})
-
-	err = ls.Session.CommitTx()
+	s := ls.Session.bind(ctx)
+	root, err := s.RootService.rootFor(path)
 	if err != nil {
-		ls.Session.Logger.Println(err)
-		return err
+		return nil, err
 	}
-	return nil
+
+	rootID := ""
+	if root != nil {
+		rootID = root.ID
+	}
+	return s.scan(ctx, path, rootID, opts)
 }
@@ -0,0 +1,313 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration represents an ordered change to the schema of the library.
+type migration struct {
+	version int
+	name    string
+	up      func(s *Session) error
+}
+
+// migrations lists every change to the schema of the library in the order the
+// changes are applied. The schema version of a library is the version of the
+// last migration applied to it, which is recorded as the user version of the
+// database. Each CreateTable statement describes the current schema, so the
+// migrations that follow the first must tolerate tables that already have the
+// changes they make.
+var migrations = []migration{
+	{1, "create library tables", createTables},
+	{2, "record the files and library roots of songs", func(s *Session) error {
+		_, err := s.RootService.CreateTable()
+		if err != nil {
+			return err
+		}
+
+		err = s.ensureColumns("songs",
+			"file_size   INTEGER",
+			"file_mtime  INTEGER",
+			"fingerprint TEXT",
+			"root_id     INTEGER REFERENCES library_roots(root_id)")
+		if err != nil {
+			return err
+		}
+
+		_, err = s.songService.CreateIndexes()
+		return err
+	}},
+	{3, "create artist aliases", func(s *Session) error {
+		_, err := s.ArtistAliasService.CreateTable()
+		return err
+	}},
+	{4, "create playlists", func(s *Session) error {
+		_, err := s.playlistService.CreateTable()
+		return err
+	}},
+	{5, "add smart playlist rules and song dates", func(s *Session) error {
+		err := s.ensureColumns("playlists", "rules TEXT")
+		if err != nil {
+			return err
+		}
+
+		err = s.ensureColumns("songs", "date_added TEXT")
+		if err != nil {
+			return err
+		}
+
+		update :=
+			`UPDATE songs
+			    SET date_added = (SELECT date_added
+			                        FROM library_roots
+			                       WHERE library_roots.root_id = songs.root_id)
+			  WHERE date_added IS NULL`
+		_, err = s.tx.Exec(update)
+		return err
+	}},
+	{6, "create plays", func(s *Session) error {
+		_, err := s.playService.CreateTable()
+		return err
+	}},
+	{7, "create ratings", func(s *Session) error {
+		_, err := s.ratingService.CreateTable()
+		return err
+	}},
+	{8, "create tags", func(s *Session) error {
+		_, err := s.tagService.CreateTable()
+		return err
+	}},
+	{9, "create users and record the owners of playlists, plays and ratings", func(s *Session) error {
+		_, err := s.userService.CreateTable()
+		if err != nil {
+			return err
+		}
+
+		err = s.ensureColumns("playlists", "user_id INTEGER NOT NULL DEFAULT 0")
+		if err != nil {
+			return err
+		}
+
+		err = s.ensureColumns("plays", "user_id INTEGER NOT NULL DEFAULT 0")
+		if err != nil {
+			return err
+		}
+
+		// The user is part of the primary key of ratings, so older ratings
+		// are copied to a new table.
+		columns, err := s.columns("ratings")
+		if err != nil || columns["user_id"] {
+			return err
+		}
+		_, err = s.tx.Exec(`ALTER TABLE ratings RENAME TO ratings_v8`)
+		if err != nil {
+			return err
+		}
+		_, err = s.ratingService.CreateTable()
+		if err != nil {
+			return err
+		}
+		insert :=
+			`INSERT INTO ratings
+			             (resource_type,
+			              resource_id,
+			              rating,
+			              loved,
+			              date_rated)
+			      SELECT resource_type,
+			             resource_id,
+			             rating,
+			             loved,
+			             date_rated
+			        FROM ratings_v8`
+		_, err = s.tx.Exec(insert)
+		if err != nil {
+			return err
+		}
+		_, err = s.tx.Exec(`DROP TABLE ratings_v8`)
+		return err
+	}},
+	{10, "store every song field", func(s *Session) error {
+		err := s.ensureColumns("songs",
+			"track_total INTEGER",
+			"disc_total  INTEGER",
+			"comments    TEXT")
+		if err != nil {
+			return err
+		}
+
+		// Older versions stored the track number as the disc number and
+		// duration. Clearing the file properties of songs makes the next
+		// scan read their tags again.
+		update :=
+			`UPDATE songs
+			    SET disc_number = NULL,
+			        duration_in_millis = NULL,
+			        file_size = NULL,
+			        fingerprint = NULL`
+		_, err = s.tx.Exec(update)
+		return err
+	}},
+	{11, "create search index", func(s *Session) error {
+		return s.searchService.update()
+	}},
+	{12, "index plays by user and song", func(s *Session) error {
+		_, err := s.playService.CreateTable()
+		return err
+	}},
+}
+
+// SupportedVersion is the schema version created by this build of the library.
+// Libraries with a newer schema version are refused.
+var SupportedVersion = migrations[len(migrations)-1].version
+
+// createTables creates the library tables.
+func createTables(s *Session) error {
+	_, err := s.RootService.CreateTable()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.genreService.CreateTable()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.artistService.CreateTable()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.albumService.CreateTable()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.songService.CreateTable()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.AlbumDiscogService.CreateTable()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.SongDiscogService.CreateTable()
+	return err
+}
+
+// Version returns the schema version of the library.
+func (s *Session) Version() (int, error) {
+	var version int
+	err := s.conn().QueryRow(`PRAGMA user_version`).Scan(&version)
+	if err != nil {
+		s.Logger.Println(err)
+		return 0, err
+	}
+	return version, nil
+}
+
+// migrate applies every migration newer than the schema version of the
+// library, each in a transaction of its own, and then creates or drops the
+// search index according to whether this build supports it. It refuses to
+// change a library whose schema is newer than this build supports.
+func (s *Session) migrate() error {
+	version, err := s.Version()
+	if err != nil {
+		return err
+	}
+	if version > SupportedVersion {
+		return fmt.Errorf("library schema version %d is newer than supported version %d", version, SupportedVersion)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		err := s.BeginTx()
+		if err != nil {
+			s.Logger.Println(err)
+			return err
+		}
+
+		err = m.up(s)
+		if err == nil {
+			err = s.setVersion(m.version)
+		}
+		if err != nil {
+			err = fmt.Errorf("migration %d (%s): %v", m.version, m.name, err)
+			s.Logger.Println(err)
+			s.RollbackTx()
+			return err
+		}
+
+		err = s.CommitTx()
+		if err != nil {
+			s.Logger.Println(err)
+			return err
+		}
+	}
+
+	err = s.searchService.update()
+	if err != nil {
+		err = fmt.Errorf("search index: %v", err)
+		s.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// setVersion records the given schema version within the current transaction.
+func (s *Session) setVersion(version int) error {
+	_, err := s.tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version))
+	return err
+}
+
+// columns returns the set of the names of the columns of the given table.
+func (s *Session) columns(table string) (map[string]bool, error) {
+	columns := make(map[string]bool)
+
+	rows, err := s.tx.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return columns, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, kind string
+		var value sql.NullString
+		err := rows.Scan(&cid, &name, &kind, &notNull, &value, &pk)
+		if err != nil {
+			return columns, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// ensureColumns adds each of the given column definitions to the given table,
+// unless the table already has a column of that name.
+func (s *Session) ensureColumns(table string, definitions ...string) error {
+	columns, err := s.columns(table)
+	if err != nil {
+		return err
+	}
+
+	for _, definition := range definitions {
+		var name string
+		fmt.Sscan(definition, &name)
+		if columns[name] {
+			continue
+		}
+
+		_, err := s.tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s`, table, definition))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// baselineSchema creates the tables of a library written before the schema was
+// versioned, along with a song whose disc number and duration hold the track
+// number as that version recorded them.
+var baselineSchema = []string{
+	`CREATE TABLE genres (
+		genre_id   INTEGER PRIMARY KEY,
+		genre_name TEXT    UNIQUE NOT NULL
+	)`,
+	`CREATE TABLE artists (
+		artist_id   INTEGER PRIMARY KEY,
+		artist_name TEXT    NOT NULL,
+		artist_sort TEXT
+	)`,
+	`CREATE TABLE albums (
+		album_id          INTEGER PRIMARY KEY,
+		album_name        TEXT    NOT NULL,
+		artist_id         INTEGER NOT NULL,
+		genre_id          INTEGER,
+		release_date      TEXT,
+		track_total       INTEGER,
+		album_sort        TEXT,
+		album_artist      TEXT,
+		album_artist_sort TEXT
+	)`,
+	`CREATE TABLE songs (
+		song_id            INTEGER PRIMARY KEY,
+		file_path          TEXT    NOT NULL,
+		file_base          TEXT    NOT NULL,
+		file_dir           TEXT    NOT NULL,
+		artist_id          INTEGER NOT NULL,
+		song_name          TEXT,
+		genre_id           INTEGER,
+		release_date       TEXT,
+		track_number       INTEGER,
+		disc_number        INTEGER,
+		duration_in_millis INTEGER,
+		artist_sort        TEXT,
+		composer_name      TEXT,
+		composer_sort      TEXT,
+		conductor          TEXT,
+		song_name_sort     TEXT,
+		lyrics             TEXT
+	)`,
+	`CREATE TABLE album_discographies (
+		artist_id INTEGER NOT NULL,
+		album_id  INTEGER NOT NULL,
+		PRIMARY KEY('artist_id','album_id')
+	)`,
+	`CREATE TABLE song_discographies (
+		artist_id INTEGER NOT NULL,
+		song_id   INTEGER NOT NULL,
+		album_id  INTEGER,
+		PRIMARY KEY('artist_id','song_id')
+	)`,
+	`INSERT INTO genres VALUES (1, 'Rock')`,
+	`INSERT INTO artists VALUES (1, 'Ann', '')`,
+	`INSERT INTO albums VALUES (1, 'First', 1, 1, '1999', 0, '', 'Ann', '')`,
+	`INSERT INTO songs
+	      VALUES (1, '/music/1.mp3', '1.mp3', '/music', 1, 'One', 1, '1999', 3, 3, 3,
+	              '', '', '', '', '', '')`,
+	`INSERT INTO album_discographies VALUES (1, 1)`,
+	`INSERT INTO song_discographies VALUES (1, 1, 1)`,
+}
+
+// openTestLibrary opens the library at the given path, returning the error of
+// Open rather than failing the test. An opened library is closed when the test
+// ends.
+func openTestLibrary(t *testing.T, path string) (*Service, error) {
+	t.Helper()
+
+	ls := NewService(path)
+	ls.client.Logger = log.New(io.Discard, "", 0)
+	err := ls.Open()
+	if err != nil {
+		return nil, err
+	}
+	ls.Session.Logger = ls.client.Logger
+	t.Cleanup(func() {
+		if ls.Session != nil {
+			ls.Close()
+		}
+	})
+	return &ls, nil
+}
+
+// execTestDatabase executes the given statements on the database at the given
+// path without opening it as a library.
+func execTestDatabase(t *testing.T, path string, statements ...string) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, statement := range statements {
+		_, err := db.Exec(statement)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// describeSchema returns the sorted columns of every table of the library, and
+// the names of its indexes and triggers.
+func describeSchema(t *testing.T, ls *Service) map[string][]string {
+	t.Helper()
+
+	schema := make(map[string][]string)
+	rows, err := ls.Session.db.Query(
+		`SELECT type, name, tbl_name FROM sqlite_master
+		  WHERE name NOT LIKE 'sqlite_%' AND name NOT LIKE 'search_%'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	for rows.Next() {
+		var kind, name, table string
+		err := rows.Scan(&kind, &name, &table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kind == "table" {
+			tables = append(tables, name)
+		} else {
+			schema[kind+"s"] = append(schema[kind+"s"], name)
+		}
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		rows, err := ls.Session.db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var cid, notNull, pk int
+			var name, kind string
+			var value sql.NullString
+			err := rows.Scan(&cid, &name, &kind, &notNull, &value, &pk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			schema[table] = append(schema[table], name)
+		}
+		rows.Close()
+	}
+
+	for _, names := range schema {
+		sort.Strings(names)
+	}
+	return schema
+}
+
+// TestMigrateFromEachVersion checks that a library at every earlier schema
+// version is migrated to the same schema as a new library.
+func TestMigrateFromEachVersion(t *testing.T) {
+	want := describeSchema(t, openTestService(t))
+
+	all, supported := migrations, SupportedVersion
+	defer func() { migrations, SupportedVersion = all, supported }()
+
+	for i := range all[:len(all)-1] {
+		version := all[i].version
+		t.Run(fmt.Sprintf("version %d", version), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "library.db")
+
+			migrations, SupportedVersion = all[:i+1], version
+			old, err := openTestLibrary(t, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := old.Version()
+			if err != nil || got != version {
+				t.Fatalf("library was created at version %d (%v), want %d", got, err, version)
+			}
+			old.Close()
+
+			migrations, SupportedVersion = all, supported
+			ls, err := openTestLibrary(t, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = ls.Version()
+			if err != nil || got != supported {
+				t.Fatalf("library was migrated to version %d (%v), want %d", got, err, supported)
+			}
+			if schema := describeSchema(t, ls); !reflect.DeepEqual(schema, want) {
+				t.Errorf("migrated schema is\n%v\nwant\n%v", schema, want)
+			}
+		})
+	}
+}
+
+// TestMigrateFromBaseline checks that a library written before the schema was
+// versioned keeps its songs when it is migrated, and has its misread fields
+// cleared so that the next scan reads them again.
+func TestMigrateFromBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "library.db")
+	execTestDatabase(t, path, baselineSchema...)
+
+	ls, err := openTestLibrary(t, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := ls.Version()
+	if err != nil || version != SupportedVersion {
+		t.Fatalf("library was migrated to version %d (%v), want %d", version, err, SupportedVersion)
+	}
+
+	s, err := ls.Session.SongService().Song("1")
+	if err != nil || s == nil {
+		t.Fatalf("Song(1) returned %v (%v) after the migration", s, err)
+	}
+	if s.Attributes.Name != "One" || s.Attributes.TrackNumber != "3" {
+		t.Errorf("migrated song has name %q and track number %q, want One and 3", s.Attributes.Name, s.Attributes.TrackNumber)
+	}
+	if s.Attributes.DiscNumber != "" || s.Attributes.DurationInMillis != 0 {
+		t.Errorf("migrated song has disc number %q and duration %d, want them cleared", s.Attributes.DiscNumber, s.Attributes.DurationInMillis)
+	}
+}
+
+// TestMigrateRefusesNewerVersion checks that a library with a newer schema
+// version than this build supports is neither opened nor changed.
+func TestMigrateRefusesNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "library.db")
+	execTestDatabase(t, path,
+		`CREATE TABLE future (id INTEGER PRIMARY KEY)`,
+		fmt.Sprintf(`PRAGMA user_version = %d`, SupportedVersion+1))
+
+	_, err := openTestLibrary(t, path)
+	if err == nil {
+		t.Fatal("Open opened a library with a newer schema version")
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var version, tables int
+	err = db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	if err == nil {
+		err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'`).Scan(&tables)
+	}
+	if err != nil || version != SupportedVersion+1 || tables != 1 {
+		t.Errorf("refused library has version %d and %d tables (%v), want %d and 1", version, tables, err, SupportedVersion+1)
+	}
+}
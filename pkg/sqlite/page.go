@@ -0,0 +1,268 @@
+package sqlite
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// sortKey represents an expression that rows are ordered by.
+type sortKey struct {
+	expr string
+	desc bool
+}
+
+// sortKeys returns the keys that order rows by the given comma-separated
+// fields, each prefixed with '-' for descending order, and then by the given
+// ID column. Missing values are ordered as empty text or zero so that rows
+// can be compared against a cursor, and text is ordered without regard to
+// case.
+func sortKeys(sort string, fields map[string]ruleField, ID string) ([]sortKey, error) {
+	var keys []sortKey
+	for _, s := range strings.Split(sort, ",") {
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			continue
+		}
+
+		name := strings.TrimPrefix(s, "-")
+		field, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort field %q", name)
+		}
+
+		var expr string
+		switch field.kind {
+		case textField:
+			expr = `IFNULL(` + field.expr + `, '') COLLATE NOCASE`
+		case numberField:
+			expr = `IFNULL(` + field.expr + `, 0)`
+		default:
+			expr = `IFNULL(` + field.expr + `, '')`
+		}
+		keys = append(keys, sortKey{expr: expr, desc: name != s})
+	}
+	return append(keys, sortKey{expr: ID}), nil
+}
+
+// orderBy returns an ORDER BY clause that orders rows by the given
+// comma-separated fields, as sortKeys does.
+func orderBy(sort string, fields map[string]ruleField, ID string) (string, error) {
+	keys, err := sortKeys(sort, fields, ID)
+	if err != nil {
+		return "", err
+	}
+	return orderKeys(keys), nil
+}
+
+// orderKeys returns an ORDER BY clause that orders rows by the given keys.
+func orderKeys(keys []sortKey) string {
+	order := make([]string, len(keys))
+	for i, k := range keys {
+		order[i] = k.expr
+		if k.desc {
+			order[i] += ` DESC`
+		}
+	}
+	return ` ORDER BY ` + strings.Join(order, `, `)
+}
+
+// pager reads a page of rows. Rows are ordered by the keys of the sort of a
+// filter, and the page holds up to the limit of rows, if it is positive, read
+// after skipping the offset. A cursor reads only the rows ordered after the
+// row it was made from, so that pages stay stable while rows are added and
+// deleted.
+type pager struct {
+	keys   []sortKey
+	limit  int
+	offset int
+	after  []interface{}
+	last   []interface{}
+	read   int
+}
+
+// newPager returns a pager that reads the page given by the filter of rows
+// that may be sorted by the given fields and are identified by the given ID
+// column.
+func newPager(f *library.Filter, fields map[string]ruleField, ID string) (*pager, error) {
+	keys, err := sortKeys(f.Sort, fields, ID)
+	if err != nil {
+		return nil, err
+	}
+	p := &pager{keys: keys, limit: f.Limit, offset: f.Offset}
+
+	if len(f.Cursor) > 0 {
+		p.after, err = decodeCursor(f.Cursor)
+		if err == nil && len(p.after) != len(p.keys) {
+			err = fmt.Errorf("cursor does not match sort %q", f.Sort)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// columns lists the sort keys as extra columns, which are read by scanner.
+func (p *pager) columns() string {
+	var columns bytes.Buffer
+	for _, k := range p.keys {
+		columns.WriteString(`, `)
+		columns.WriteString(strings.TrimSuffix(k.expr, ` COLLATE NOCASE`))
+	}
+	return columns.String()
+}
+
+// filter adds the condition that selects the rows after the cursor, if any.
+func (p *pager) filter(c *conditions) {
+	if p.after == nil {
+		return
+	}
+
+	var after bytes.Buffer
+	var args []interface{}
+	after.WriteString(`(`)
+	for i, k := range p.keys {
+		if i > 0 {
+			after.WriteString(` OR `)
+		}
+		after.WriteString(`(`)
+		for _, equal := range p.keys[:i] {
+			after.WriteString(equal.expr + ` = ? AND `)
+		}
+		if k.desc {
+			after.WriteString(k.expr + ` < ?)`)
+		} else {
+			after.WriteString(k.expr + ` > ?)`)
+		}
+		args = append(args, p.after[:i+1]...)
+	}
+	after.WriteString(`)`)
+	c.add(after.String(), args...)
+}
+
+// order appends the ORDER BY, LIMIT and OFFSET clauses to the given query,
+// reading the given number of extra rows beyond the limit, and returns the
+// arguments of the query.
+func (p *pager) order(query *bytes.Buffer, args []interface{}, extra int) []interface{} {
+	query.WriteString(orderKeys(p.keys))
+	if p.limit > 0 {
+		query.WriteString(` LIMIT ?`)
+		args = append(args, p.limit+extra)
+	} else if p.offset > 0 {
+		query.WriteString(` LIMIT -1`)
+	}
+	if p.offset > 0 {
+		query.WriteString(` OFFSET ?`)
+		args = append(args, p.offset)
+	}
+	return args
+}
+
+// scanner returns a rowScanner that reads the sort keys selected by columns
+// after the given destinations, keeping those of the last row of the page.
+func (p *pager) scanner(rows *sql.Rows) rowScanner {
+	return scanFunc(func(dest ...interface{}) error {
+		keys := make([]interface{}, len(p.keys))
+		for i := range keys {
+			dest = append(dest, &keys[i])
+		}
+		err := rows.Scan(dest...)
+		if err != nil {
+			return err
+		}
+		p.read++
+		if !p.more() {
+			p.last = keys
+		}
+		return nil
+	})
+}
+
+// more reports whether the last row scanned is beyond the limit, which is read
+// to learn whether there is a following page.
+func (p *pager) more() bool {
+	return p.limit > 0 && p.read > p.limit
+}
+
+// page returns the page read, out of the given total number of rows.
+func (p *pager) page(total int) (*library.Page, error) {
+	page := &library.Page{Total: total, Limit: p.limit, Offset: p.offset}
+	if p.more() {
+		next, err := encodeCursor(p.last)
+		if err != nil {
+			return nil, err
+		}
+		page.Next = next
+	}
+	return page, nil
+}
+
+// countRows queries the number of rows selected from the given tables and
+// WHERE clauses.
+func countRows(db queryer, from string, args []interface{}) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM`+from, args...).Scan(&n)
+	return n, err
+}
+
+// scanFunc adapts a function to a rowScanner.
+type scanFunc func(dest ...interface{}) error
+
+// Scan calls f(dest...).
+func (f scanFunc) Scan(dest ...interface{}) error {
+	return f(dest...)
+}
+
+// encodeCursor returns the opaque cursor of the given sort key values.
+func encodeCursor(values []interface{}) (string, error) {
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			values[i] = string(b)
+		}
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor returns the sort key values of the given opaque cursor.
+func decodeCursor(cursor string) ([]interface{}, error) {
+	invalid := fmt.Errorf("invalid cursor %q", cursor)
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalid
+	}
+
+	var values []interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if d.Decode(&values) != nil || values == nil {
+		return nil, invalid
+	}
+
+	for i, v := range values {
+		switch v := v.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				values[i] = n
+			} else if f, err := v.Float64(); err == nil {
+				values[i] = f
+			} else {
+				return nil, invalid
+			}
+		case string:
+		default:
+			return nil, invalid
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,201 @@
+package sqlite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// songPageNames returns the names of the given songs.
+func songPageNames(songs []*library.Song) []string {
+	names := []string{}
+	for _, s := range songs {
+		names = append(names, s.Attributes.Name)
+	}
+	return names
+}
+
+// scanPagingLibrary scans songs whose genres and years repeat, so that sorting
+// by them leaves ties, and returns the scanned directory.
+func scanPagingLibrary(t *testing.T, ls *Service) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for i, song := range []struct{ name, genre, year string }{
+		{"f", "Rock", "2001"},
+		{"B", "Jazz", "1999"},
+		{"h", "Rock", "1999"},
+		{"a", "Jazz", "2001"},
+		{"E", "Rock", "2001"},
+		{"c", "Jazz", "1999"},
+		{"G", "Rock", "1999"},
+		{"d", "Jazz", "2001"},
+	} {
+		writeTestFile(t, filepath.Join(dir, fmt.Sprintf("%d.mp3", i)), "title", song.name, "genre", song.genre, "year", song.year)
+	}
+	_, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// TestSongsPageSort checks that songs are ordered by every key of a sort in
+// turn, ignoring the case of text, and then by ID.
+func TestSongsPageSort(t *testing.T) {
+	ls := openTestService(t)
+	scanPagingLibrary(t, ls)
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"name", []string{"a", "B", "c", "d", "E", "f", "G", "h"}},
+		{"-name", []string{"h", "G", "f", "E", "d", "c", "B", "a"}},
+		{"genre,-year,name", []string{"a", "d", "B", "c", "E", "f", "G", "h"}},
+		{"-genre,year,-name", []string{"h", "G", "f", "E", "c", "B", "d", "a"}},
+		{"year", []string{"B", "h", "c", "G", "f", "a", "E", "d"}},
+	}
+	for _, tt := range tests {
+		songs, page, err := ls.Session.SongService().SongsPage(map[string]string{"sort": tt.sort})
+		if err != nil {
+			t.Fatalf("sort %q: %v", tt.sort, err)
+		}
+		if names := songPageNames(songs); !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("sort %q ordered songs %v, want %v", tt.sort, names, tt.want)
+		}
+		if page.Total != 8 || page.Next != "" {
+			t.Errorf("sort %q returned page %+v, want a total of 8 and no next page", tt.sort, page)
+		}
+	}
+
+	_, _, err := ls.Session.SongService().SongsPage(map[string]string{"sort": "mood"})
+	if err == nil {
+		t.Error("SongsPage sorted by an unknown field")
+	}
+}
+
+// TestSongsPageCursor checks that following the cursors of pages reads every
+// song once, in order, and that a cursor keeps reading after the row it was
+// made from while songs are added and deleted.
+func TestSongsPageCursor(t *testing.T) {
+	ls := openTestService(t)
+	dir := scanPagingLibrary(t, ls)
+	const sort = "genre,-year,name"
+	want := []string{"a", "d", "B", "c", "E", "f", "G", "h"}
+
+	var names []string
+	params := map[string]string{"sort": sort, "limit": "3"}
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatal("cursors did not reach the last page")
+		}
+		songs, page, err := ls.Session.SongService().SongsPage(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != len(want) || page.Limit != 3 || len(songs) > 3 {
+			t.Fatalf("page %d has %d songs and page %+v", pages, len(songs), page)
+		}
+		names = append(names, songPageNames(songs)...)
+		if page.Next == "" {
+			break
+		}
+		params["cursor"] = page.Next
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("cursors read songs %v, want %v", names, want)
+	}
+
+	songs, page, err := ls.Session.SongService().SongsPage(map[string]string{"sort": sort, "limit": "3", "offset": "3"})
+	if err != nil || !reflect.DeepEqual(songPageNames(songs), want[3:6]) || page.Offset != 3 {
+		t.Errorf("offset page has songs %v and page %+v (%v), want %v", songPageNames(songs), page, err, want[3:6])
+	}
+
+	// Rows added before the cursor and deleted from the first page do not
+	// shift the page that follows it.
+	_, first, err := ls.Session.SongService().SongsPage(map[string]string{"sort": sort, "limit": "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "new.mp3"), "title", "0", "genre", "Jazz", "year", "2005")
+	err = os.Remove(filepath.Join(dir, "3.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	songs, page, err = ls.Session.SongService().SongsPage(map[string]string{"sort": sort, "limit": "3", "cursor": first.Next})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := songPageNames(songs); !reflect.DeepEqual(names, want[3:6]) || page.Total != len(want) {
+		t.Errorf("page after the cursor has songs %v of %d, want %v of %d", names, page.Total, want[3:6], len(want))
+	}
+
+	_, _, err = ls.Session.SongService().SongsPage(map[string]string{"sort": "name", "cursor": first.Next})
+	if err == nil {
+		t.Error("SongsPage accepted a cursor of another sort")
+	}
+}
+
+// TestAlbumsAndArtistsPageCursor checks that albums and artists are paged by
+// their cursors as songs are.
+func TestAlbumsAndArtistsPageCursor(t *testing.T) {
+	dir := t.TempDir()
+	for i, name := range []string{"b", "A", "c", "D", "e"} {
+		writeTestFile(t, filepath.Join(dir, fmt.Sprintf("%d.mp3", i)), "title", name, "artist", name, "album", name)
+	}
+	ls := openTestService(t)
+	_, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"e", "D", "c", "b", "A"}
+
+	var albums, artists []string
+	params := map[string]string{"sort": "-name", "limit": "2"}
+	for cursor := ""; ; {
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		page, p, err := ls.Session.AlbumService().AlbumsPage(params)
+		if err != nil || p.Total != 5 {
+			t.Fatalf("AlbumsPage returned page %+v (%v)", p, err)
+		}
+		for _, a := range page {
+			albums = append(albums, a.Attributes.Name)
+		}
+		cursor = p.Next
+		if cursor == "" {
+			break
+		}
+	}
+	delete(params, "cursor")
+	for cursor := ""; ; {
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		page, p, err := ls.Session.ArtistService().ArtistsPage(params)
+		if err != nil || p.Total != 5 {
+			t.Fatalf("ArtistsPage returned page %+v (%v)", p, err)
+		}
+		for _, a := range page {
+			artists = append(artists, a.Attributes.Name)
+		}
+		cursor = p.Next
+		if cursor == "" {
+			break
+		}
+	}
+
+	if !reflect.DeepEqual(albums, want) || !reflect.DeepEqual(artists, want) {
+		t.Errorf("cursors read albums %v and artists %v, want %v", albums, artists, want)
+	}
+}
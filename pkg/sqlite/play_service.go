@@ -0,0 +1,249 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// PlayService manages interactions with the play history data source.
+type PlayService struct {
+	session *Session
+	insert  *sql.Stmt
+}
+
+// NewPlayService returns a new instance of a PlayService that operates within
+// the given session.
+func NewPlayService(s *Session) PlayService {
+	service := PlayService{session: s}
+	return service
+}
+
+// CreateTable creates the 'plays' table and returns any errors.
+func (service *PlayService) CreateTable() (sql.Result, error) {
+	create :=
+		`CREATE TABLE IF NOT EXISTS plays (
+			play_id            INTEGER PRIMARY KEY,
+			song_id            INTEGER NOT NULL,
+			played_at          TEXT    NOT NULL,
+			duration_in_millis INTEGER,
+			source             TEXT,
+			skipped            INTEGER NOT NULL DEFAULT 0,
+			user_id            INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY('song_id') REFERENCES songs('song_id')
+		)`
+	result, err := service.session.tx.Exec(create)
+	if err != nil {
+		return result, err
+	}
+
+	index := `CREATE INDEX IF NOT EXISTS plays_song_id ON plays (song_id)`
+	result, err = service.session.tx.Exec(index)
+	if err != nil {
+		return result, err
+	}
+
+	index = `CREATE INDEX IF NOT EXISTS plays_played_at ON plays (played_at)`
+	result, err = service.session.tx.Exec(index)
+	if err != nil {
+		return result, err
+	}
+
+	index = `CREATE INDEX IF NOT EXISTS plays_user_song ON plays (user_id, song_id, skipped, played_at)`
+	return service.session.tx.Exec(index)
+}
+
+// DropTable drops the 'plays' table and returns any errors.
+func (service *PlayService) DropTable() (sql.Result, error) {
+	drop := `DROP TABLE IF EXISTS plays`
+	return service.session.tx.Exec(drop)
+}
+
+// RecordPlay records a play of the song with the given ID by the acting user
+// and returns it. The play is recorded at the current time unless the
+// attributes give a time, which must be in RFC 3339 format and is recorded in
+// UTC.
+func (service *PlayService) RecordPlay(attributes *library.PlayAttributes) (*library.Play, error) {
+	playedAt := now()
+	if len(attributes.PlayedAt) > 0 {
+		t, err := time.Parse(time.RFC3339, attributes.PlayedAt)
+		if err != nil {
+			err = fmt.Errorf("play time %q is not an RFC 3339 time", attributes.PlayedAt)
+			service.session.Logger.Println(err)
+			return nil, err
+		}
+		playedAt = t.UTC().Format(time.RFC3339)
+	}
+
+	var ID int64
+	err := service.session.inTx(func() error {
+		err := service.session.checkUser()
+		if err != nil {
+			return err
+		}
+
+		if service.insert == nil {
+			insert :=
+				`INSERT INTO plays
+				             (song_id,
+				              played_at,
+				              duration_in_millis,
+				              source,
+				              skipped,
+				              user_id)
+				      SELECT song_id,
+				             ?,
+				             ?,
+				             ?,
+				             ?,
+				             ?
+				        FROM songs
+				       WHERE song_id = ?`
+			stmt, err := service.session.tx.Prepare(insert)
+			if err != nil {
+				return err
+			}
+			service.insert = stmt
+		}
+
+		result, err := service.insert.ExecContext(
+			service.session.ctx,
+			playedAt,
+			attributes.DurationInMillis,
+			nullable(attributes.Source),
+			attributes.Skipped,
+			service.session.userID(),
+			attributes.SongID)
+		if err == nil {
+			err = found(result)
+		}
+		if err != nil {
+			return err
+		}
+
+		ID, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		service.session.Logger.Println(err)
+		return nil, err
+	}
+
+	return service.Play(fmt.Sprint(ID))
+}
+
+// playColumns lists the columns read by scanPlay.
+const playColumns = `
+		  play_id,
+		  song_id,
+		  played_at,
+		  IFNULL(duration_in_millis, 0),
+		  IFNULL(source, ''),
+		  skipped`
+
+// scanPlay reads a play from a row that selects playColumns.
+func scanPlay(row rowScanner) (*library.Play, error) {
+	var p library.Play
+	err := row.Scan(
+		&p.ID,
+		&p.Attributes.SongID,
+		&p.Attributes.PlayedAt,
+		&p.Attributes.DurationInMillis,
+		&p.Attributes.Source,
+		&p.Attributes.Skipped)
+	p.Type = "plays"
+	return &p, err
+}
+
+// Play queries the 'plays' table for a play with the given ID and returns the
+// result along with any error.
+func (service *PlayService) Play(ID string) (*library.Play, error) {
+	query := `SELECT` + playColumns + ` FROM plays WHERE play_id = ? AND user_id = ?`
+	p, err := scanPlay(service.session.conn().QueryRow(query, ID, service.session.userID()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		service.session.Logger.Println(err)
+		return p, err
+	}
+	return p, nil
+}
+
+// Plays queries the 'plays' table for the plays by the acting user of the song
+// with the given ID, or of every song if the ID is empty, and returns the most
+// recent plays, up to the given limit if it is positive, along with any error.
+func (service *PlayService) Plays(songID string, limit int) ([]*library.Play, error) {
+	var results []*library.Play
+
+	query := `SELECT` + playColumns + ` FROM plays WHERE user_id = ?`
+	args := []interface{}{service.session.userID()}
+	if len(songID) > 0 {
+		query += ` AND song_id = ?`
+		args = append(args, songID)
+	}
+	query += ` ORDER BY played_at DESC, play_id DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := service.session.conn().Query(query, args...)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPlay(rows)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return results, err
+		}
+		results = append(results, p)
+	}
+	return results, rows.Err()
+}
+
+// deleteSongPlays deletes the plays of the song with the given ID.
+func (service *PlayService) deleteSongPlays(songID string) error {
+	_, err := service.session.tx.Exec(`DELETE FROM plays WHERE song_id = ?`, songID)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// Close closes all open statements.
+func (service *PlayService) Close() error {
+	if service.insert != nil {
+		err := service.insert.Close()
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		service.insert = nil
+	}
+
+	return nil
+}
+
+// RecordPlayContext calls RecordPlay within the given context.
+func (service *PlayService) RecordPlayContext(ctx context.Context, attributes *library.PlayAttributes) (*library.Play, error) {
+	return service.session.bind(ctx).playService.RecordPlay(attributes)
+}
+
+// PlayContext calls Play within the given context.
+func (service *PlayService) PlayContext(ctx context.Context, ID string) (*library.Play, error) {
+	return service.session.bind(ctx).playService.Play(ID)
+}
+
+// PlaysContext calls Plays within the given context.
+func (service *PlayService) PlaysContext(ctx context.Context, songID string, limit int) ([]*library.Play, error) {
+	return service.session.bind(ctx).playService.Plays(songID, limit)
+}
@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// TestRecordPlayTime checks that play times are stored in UTC to the second,
+// and that times that are not RFC 3339 are refused.
+func TestRecordPlayTime(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "1.mp3"), "title", "One")
+
+	ls := openTestService(t)
+	_, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	songs, err := ls.Session.SongService().Songs(map[string]string{})
+	if err != nil || len(songs) != 1 {
+		t.Fatalf("Songs found %d songs (%v), want 1", len(songs), err)
+	}
+
+	tests := []struct {
+		playedAt string
+		want     string
+		wantErr  bool
+	}{
+		{"2024-03-01T10:00:00Z", "2024-03-01T10:00:00Z", false},
+		{"2024-03-01T12:30:00+02:00", "2024-03-01T10:30:00Z", false},
+		{"2024-03-01T10:00:00.250Z", "2024-03-01T10:00:00Z", false},
+		{"yesterday", "", true},
+		{"2024-03-01", "", true},
+		{"2024-03-01 10:00:00", "", true},
+	}
+	for _, tt := range tests {
+		play, err := ls.Session.PlayService().RecordPlay(&library.PlayAttributes{SongID: songs[0].ID, PlayedAt: tt.playedAt})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("RecordPlay at %q recorded %q, want an error", tt.playedAt, play.Attributes.PlayedAt)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("RecordPlay at %q returned %v", tt.playedAt, err)
+		} else if play.Attributes.PlayedAt != tt.want {
+			t.Errorf("RecordPlay at %q recorded %q, want %q", tt.playedAt, play.Attributes.PlayedAt, tt.want)
+		}
+	}
+}
+
+// TestSongPlays checks that the play counts of songs are those of the acting
+// user, and that they are looked up by song rather than by reading every play.
+func TestSongPlays(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	IDs := createTestUsers(t, ls, "Alice")
+	one := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'One'`)
+	two := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'Two'`)
+
+	alice := ls.Session.WithUser(IDs[0])
+	for _, p := range []struct {
+		session  *Session
+		songID   string
+		playedAt string
+		skipped  bool
+	}{
+		{alice, one, "2024-03-01T10:00:00Z", false},
+		{alice, one, "2024-03-02T10:00:00Z", false},
+		{alice, one, "2024-03-03T10:00:00Z", true},
+		{alice, two, "2024-03-04T10:00:00Z", false},
+		{ls.Session, one, "2024-03-05T10:00:00Z", false},
+	} {
+		_, err := p.session.PlayService().RecordPlay(&library.PlayAttributes{SongID: p.songID, PlayedAt: p.playedAt, Skipped: p.skipped})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		session    *Session
+		songID     string
+		plays      int
+		skips      int
+		lastPlayed string
+	}{
+		{alice, one, 2, 1, "2024-03-03T10:00:00Z"},
+		{alice, two, 1, 0, "2024-03-04T10:00:00Z"},
+		{ls.Session, one, 1, 0, "2024-03-05T10:00:00Z"},
+		{ls.Session, two, 0, 0, ""},
+	} {
+		s, err := tt.session.SongService().Song(tt.songID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := s.Attributes
+		if a.PlayCount != tt.plays || a.SkipCount != tt.skips || a.LastPlayed != tt.lastPlayed {
+			t.Errorf("song %s of user %q has %d plays, %d skips and was last played %q, want %d, %d and %q",
+				tt.songID, tt.session.User(), a.PlayCount, a.SkipCount, a.LastPlayed, tt.plays, tt.skips, tt.lastPlayed)
+		}
+	}
+
+	rows, err := ls.Session.db.Query(`EXPLAIN QUERY PLAN SELECT`+songColumns+` FROM`+songTables, ls.Session.songArgs()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		err := rows.Scan(&id, &parent, &unused, &detail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(detail, " plays") && !strings.Contains(detail, "plays_user_song") {
+			t.Errorf("songs are read with the plan step %q, want plays searched by their user and song", detail)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jeremybouzigard/library"
+	"github.com/jeremybouzigard/library/pkg/playlist"
+)
+
+// ImportReport summarizes the playlist created by importing a playlist file and
+// lists every entry of the file that is not a song in the library.
+type ImportReport struct {
+	Path       string            `json:"path"`
+	Playlist   *library.Playlist `json:"playlist,omitempty"`
+	Imported   int               `json:"imported"`
+	Unresolved []string          `json:"unresolved,omitempty"`
+}
+
+// ImportPlaylist creates a playlist from the M3U, M3U8, PLS or XSPF playlist
+// file at the given path. The playlist is given the name of the file unless a
+// name is given. Relative entries are resolved against the directory of the
+// file, and entries that are not songs in the library are left out and listed
+// by the report.
+func (ls *Service) ImportPlaylist(path, name string) (*ImportReport, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := playlist.FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := playlist.Read(f, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(name) == 0 {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	report := &ImportReport{Path: path}
+	var ID string
+	err = ls.Session.inTx(func() error {
+		p, err := ls.Session.playlistService.CreatePlaylist(&library.PlaylistAttributes{Name: name})
+		if err != nil {
+			return err
+		}
+		ID = p.ID
+
+		dir := filepath.Dir(path)
+		for _, e := range entries {
+			songID, err := ls.Session.songService.songAt(e.Location, dir)
+			if err != nil {
+				return err
+			}
+			if len(songID) == 0 {
+				report.Unresolved = append(report.Unresolved, e.Location)
+				continue
+			}
+
+			err = ls.Session.playlistService.insertAt(ID, songID, -1)
+			if err != nil {
+				return err
+			}
+			report.Imported++
+		}
+		return nil
+	})
+	if err != nil {
+		ls.Session.Logger.Println(err)
+		return report, err
+	}
+
+	report.Playlist, err = ls.Session.playlistService.Playlist(ID)
+	return report, err
+}
+
+// ImportPlaylistContext calls ImportPlaylist within the given context.
+func (ls *Service) ImportPlaylistContext(ctx context.Context, path, name string) (*ImportReport, error) {
+	b := &Service{client: ls.client, Session: ls.Session.bind(ctx)}
+	return b.ImportPlaylist(path, name)
+}
+
+// ExportPlaylist writes the songs of the playlist with the given ID to a
+// playlist file at the given path, in the format given by its extension. Songs
+// beneath the directory of the file are written relative to it.
+func (ls *Service) ExportPlaylist(ID, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	format, err := playlist.FormatOf(path)
+	if err != nil {
+		return err
+	}
+
+	songs, err := ls.Session.playlistService.PlaylistSongs(ID)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = playlist.Write(f, format, playlist.Entries(songs, filepath.Dir(path)))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ExportPlaylistContext calls ExportPlaylist within the given context.
+func (ls *Service) ExportPlaylistContext(ctx context.Context, ID, path string) error {
+	b := &Service{client: ls.client, Session: ls.Session.bind(ctx)}
+	return b.ExportPlaylist(ID, path)
+}
+
+// songAt returns the ID of the song whose file is at the given playlist
+// location, resolved against the given directory, or an empty string if there
+// is no such song.
+func (ss *SongService) songAt(location, dir string) (string, error) {
+	path, err := playlist.Resolve(location, dir)
+	if err != nil {
+		return "", nil
+	}
+
+	var ID string
+	query := `SELECT song_id FROM songs WHERE file_path = ? LIMIT 1`
+	err = ss.session.tx.QueryRow(query, path).Scan(&ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		ss.session.Logger.Println(err)
+		return "", err
+	}
+	return ID, nil
+}
@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestPlaylist writes a PLS playlist file of the given locations to the
+// given path and returns the path.
+func writeTestPlaylist(t *testing.T, path string, locations ...string) string {
+	t.Helper()
+
+	file := "[playlist]\n"
+	for i, location := range locations {
+		file += fmt.Sprintf("File%d=%s\n", i+1, location)
+	}
+	err := os.WriteFile(path, []byte(file), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestImportPlaylist checks that the entries of a playlist file are resolved
+// against its directory, and that entries that are not songs in the library
+// are reported without failing the import.
+func TestImportPlaylist(t *testing.T) {
+	ls := openTestService(t)
+	dir := scanTestLibrary(t, ls)
+
+	lists := filepath.Join(dir, "lists")
+	err := os.Mkdir(lists, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(lists, "Mix.m3u8")
+	uri := (&url.URL{Scheme: "file", Path: filepath.Join(dir, "2.mp3")}).String()
+	file := "#EXTM3U\n" +
+		"#EXTINF:1,Ann - One\n" +
+		"../1.mp3\n" +
+		"../missing.mp3\n" +
+		filepath.Join(dir, "3.mp3") + "\n" +
+		"http://example.com/2.mp3\n" +
+		uri + "\n"
+	err = os.WriteFile(path, []byte(file), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := ls.ImportPlaylist(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Playlist == nil || report.Playlist.Attributes.Name != "Mix" || report.Imported != 3 {
+		t.Fatalf("ImportPlaylist reported %+v, want a playlist named Mix with 3 songs", report)
+	}
+	want := []string{"../missing.mp3", "http://example.com/2.mp3"}
+	if !reflect.DeepEqual(report.Unresolved, want) {
+		t.Errorf("ImportPlaylist reported %v unresolved, want %v", report.Unresolved, want)
+	}
+	if names := playlistSongNames(t, ls, report.Playlist.ID); !reflect.DeepEqual(names, []string{"One", "Three", "Two"}) {
+		t.Errorf("imported playlist holds %v, want [One Three Two]", names)
+	}
+
+	report, err = ls.ImportPlaylist(path, "Named")
+	if err != nil || report.Playlist == nil || report.Playlist.Attributes.Name != "Named" {
+		t.Errorf("ImportPlaylist with a name reported %+v (%v), want a playlist named Named", report, err)
+	}
+
+	_, err = ls.ImportPlaylist(filepath.Join(lists, "Mix.wpl"), "")
+	if err == nil {
+		t.Error("ImportPlaylist imported a file of an unknown format")
+	}
+	if n := queryTestInt(t, ls, `SELECT COUNT(*) FROM playlists`); n != 2 {
+		t.Errorf("library holds %d playlists, want 2", n)
+	}
+}
+
+// TestExportPlaylist checks that songs beneath the directory of an exported
+// playlist file are written relative to it, and that the file imports back as
+// the same playlist.
+func TestExportPlaylist(t *testing.T) {
+	ls := openTestService(t)
+	dir := scanTestLibrary(t, ls)
+	other := scanTestLibrary(t, ls)
+
+	path := writeTestPlaylist(t, filepath.Join(dir, "Mix.pls"),
+		filepath.Join(dir, "3.mp3"), filepath.Join(other, "1.mp3"), filepath.Join(dir, "2.mp3"))
+	report, err := ls.ImportPlaylist(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := report.Playlist
+
+	out := filepath.Join(dir, "Out.m3u8")
+	err = ls.ExportPlaylist(p.ID, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var locations []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			locations = append(locations, line)
+		}
+	}
+	want := []string{"3.mp3", filepath.Join(other, "1.mp3"), "2.mp3"}
+	if !reflect.DeepEqual(locations, want) {
+		t.Errorf("ExportPlaylist wrote %v, want %v", locations, want)
+	}
+
+	report, err = ls.ImportPlaylist(out, "")
+	if err != nil || report.Imported != 3 || len(report.Unresolved) != 0 {
+		t.Fatalf("importing the exported playlist reported %+v (%v), want 3 songs", report, err)
+	}
+	if names := playlistSongNames(t, ls, report.Playlist.ID); !reflect.DeepEqual(names, []string{"Three", "One", "Two"}) {
+		t.Errorf("exported playlist imports as %v, want [Three One Two]", names)
+	}
+
+	err = ls.ExportPlaylist(p.ID, filepath.Join(dir, "Out.wpl"))
+	if err == nil {
+		t.Error("ExportPlaylist wrote a file of an unknown format")
+	}
+}
@@ -0,0 +1,604 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// PlaylistService manages interactions with the playlist data source.
+type PlaylistService struct {
+	session *Session
+}
+
+// NewPlaylistService returns a new instance of a PlaylistService that operates
+// within the given session.
+func NewPlaylistService(s *Session) PlaylistService {
+	service := PlaylistService{session: s}
+	return service
+}
+
+// CreateTable creates the 'playlists' and 'playlist_entries' tables and
+// returns any errors.
+func (service *PlaylistService) CreateTable() (sql.Result, error) {
+	create :=
+		`CREATE TABLE IF NOT EXISTS playlists (
+			playlist_id   INTEGER PRIMARY KEY,
+			playlist_name TEXT    NOT NULL,
+			description   TEXT,
+			date_created  TEXT,
+			date_modified TEXT,
+			rules         TEXT,
+			user_id       INTEGER NOT NULL DEFAULT 0
+		)`
+	result, err := service.session.tx.Exec(create)
+	if err != nil {
+		return result, err
+	}
+
+	create =
+		`CREATE TABLE IF NOT EXISTS playlist_entries (
+			entry_id    INTEGER PRIMARY KEY,
+			playlist_id INTEGER NOT NULL,
+			song_id     INTEGER NOT NULL,
+			position    INTEGER NOT NULL,
+			FOREIGN KEY('playlist_id') REFERENCES playlists('playlist_id'),
+			FOREIGN KEY('song_id')     REFERENCES songs('song_id')
+		)`
+	result, err = service.session.tx.Exec(create)
+	if err != nil {
+		return result, err
+	}
+
+	index := `CREATE INDEX IF NOT EXISTS playlist_entries_position ON playlist_entries (playlist_id, position)`
+	return service.session.tx.Exec(index)
+}
+
+// DropTable drops the 'playlists' and 'playlist_entries' tables and returns
+// any errors.
+func (service *PlaylistService) DropTable() (sql.Result, error) {
+	drop := `DROP TABLE IF EXISTS playlist_entries`
+	result, err := service.session.tx.Exec(drop)
+	if err != nil {
+		return result, err
+	}
+
+	drop = `DROP TABLE IF EXISTS playlists`
+	return service.session.tx.Exec(drop)
+}
+
+// CreatePlaylist inserts a new playlist for the acting user and returns it. The
+// playlist is a smart playlist if the attributes have rules.
+func (service *PlaylistService) CreatePlaylist(attributes *library.PlaylistAttributes) (*library.Playlist, error) {
+	if len(attributes.Name) == 0 {
+		return nil, fmt.Errorf("playlist name is required")
+	}
+
+	rules, err := marshalRules(attributes.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	var ID int64
+	err = service.session.inTx(func() error {
+		err := service.session.checkUser()
+		if err != nil {
+			return err
+		}
+
+		insert :=
+			`INSERT INTO playlists
+			             (playlist_name,
+			              description,
+			              date_created,
+			              date_modified,
+			              rules,
+			              user_id)
+			      VALUES (?, ?, ?, ?, ?, ?)`
+		created := now()
+		result, err := service.session.tx.Exec(insert,
+			attributes.Name,
+			attributes.Description,
+			created,
+			created,
+			rules,
+			service.session.userID())
+		if err != nil {
+			return err
+		}
+
+		ID, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		service.session.Logger.Println(err)
+		return nil, err
+	}
+
+	return service.Playlist(fmt.Sprint(ID))
+}
+
+// UpdatePlaylist updates the playlist with the given ID with the given
+// attributes. Empty attributes are left unchanged. Giving a playlist rules
+// makes it a smart playlist and removes the songs added to it, and giving it
+// empty rules makes it a regular playlist without songs.
+func (service *PlaylistService) UpdatePlaylist(ID string, attributes *library.PlaylistAttributes) error {
+	rules, err := marshalRules(attributes.Rules)
+	if err != nil {
+		return err
+	}
+	clear := attributes.Rules != nil && rules == nil
+
+	return service.session.inTx(func() error {
+		update :=
+			`UPDATE playlists
+			    SET playlist_name = COALESCE(NULLIF(?, ''), playlist_name),
+			        description = COALESCE(NULLIF(?, ''), description),
+			        rules = CASE WHEN ? THEN NULL ELSE COALESCE(?, rules) END,
+			        date_modified = ?
+			  WHERE playlist_id = ?
+			    AND user_id = ?`
+		result, err := service.session.tx.Exec(update,
+			attributes.Name,
+			attributes.Description,
+			clear,
+			rules,
+			now(),
+			ID,
+			service.session.userID())
+		if err == nil {
+			err = found(result)
+		}
+		if err == nil && rules != nil {
+			_, err = service.session.tx.Exec(`DELETE FROM playlist_entries WHERE playlist_id = ?`, ID)
+		}
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		return nil
+	})
+}
+
+// DeletePlaylist deletes the playlist with the given ID. Its songs are kept.
+func (service *PlaylistService) DeletePlaylist(ID string) error {
+	return service.session.inTx(func() error {
+		remove :=
+			`DELETE FROM playlist_entries
+			       WHERE playlist_id IN (SELECT playlist_id
+			                               FROM playlists
+			                              WHERE playlist_id = ?
+			                                AND user_id = ?)`
+		_, err := service.session.tx.Exec(remove, ID, service.session.userID())
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+
+		remove = `DELETE FROM playlists WHERE playlist_id = ? AND user_id = ?`
+		result, err := service.session.tx.Exec(remove, ID, service.session.userID())
+		if err == nil {
+			err = found(result)
+		}
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		return nil
+	})
+}
+
+// InsertSong inserts the song with the given ID into the playlist with the
+// given ID at the given position. Songs at or after the position move down by
+// one. A negative position, or one past the end of the playlist, appends the
+// song.
+func (service *PlaylistService) InsertSong(ID string, songID string, position int) error {
+	return service.session.inTx(func() error {
+		err := service.touch(ID)
+		if err != nil {
+			return err
+		}
+		return service.insertAt(ID, songID, position)
+	})
+}
+
+// MoveSong moves the song at the given from position in the playlist with the
+// given ID so that it ends up at the given to position.
+func (service *PlaylistService) MoveSong(ID string, from, to int) error {
+	return service.session.inTx(func() error {
+		err := service.touch(ID)
+		if err != nil {
+			return err
+		}
+
+		entryID, songID, err := service.entryAt(ID, from)
+		if err != nil {
+			return err
+		}
+
+		_, err = service.session.tx.Exec(`DELETE FROM playlist_entries WHERE entry_id = ?`, entryID)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		return service.insertAt(ID, songID, to)
+	})
+}
+
+// RemoveSong removes the song at the given position from the playlist with the
+// given ID. Songs after the position move up by one.
+func (service *PlaylistService) RemoveSong(ID string, position int) error {
+	return service.session.inTx(func() error {
+		err := service.touch(ID)
+		if err != nil {
+			return err
+		}
+
+		entryID, _, err := service.entryAt(ID, position)
+		if err != nil {
+			return err
+		}
+
+		_, err = service.session.tx.Exec(`DELETE FROM playlist_entries WHERE entry_id = ?`, entryID)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		return nil
+	})
+}
+
+// insertAt inserts the song with the given ID into the playlist with the given
+// ID at the given position.
+func (service *PlaylistService) insertAt(ID string, songID string, position int) error {
+	var stored int64
+	err := sql.ErrNoRows
+	if position >= 0 {
+		query :=
+			`SELECT position
+			   FROM playlist_entries
+			  WHERE playlist_id = ?
+			  ORDER BY position
+			  LIMIT 1 OFFSET ?`
+		err = service.session.tx.QueryRow(query, ID, position).Scan(&stored)
+	}
+
+	switch err {
+	case nil:
+		update :=
+			`UPDATE playlist_entries
+			    SET position = position + 1
+			  WHERE playlist_id = ?
+			    AND position >= ?`
+		_, err = service.session.tx.Exec(update, ID, stored)
+	case sql.ErrNoRows:
+		query := `SELECT IFNULL(MAX(position) + 1, 0) FROM playlist_entries WHERE playlist_id = ?`
+		err = service.session.tx.QueryRow(query, ID).Scan(&stored)
+	}
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+
+	insert :=
+		`INSERT INTO playlist_entries
+		             (playlist_id,
+		              song_id,
+		              position)
+		      SELECT ?,
+		             song_id,
+		             ?
+		        FROM songs
+		       WHERE song_id = ?`
+	result, err := service.session.tx.Exec(insert, ID, stored, songID)
+	if err == nil {
+		err = found(result)
+	}
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// entryAt returns the entry and song IDs at the given position in the playlist
+// with the given ID.
+func (service *PlaylistService) entryAt(ID string, position int) (string, string, error) {
+	var entryID, songID string
+	if position < 0 {
+		return "", "", fmt.Errorf("no song at position %d of playlist %s", position, ID)
+	}
+
+	query :=
+		`SELECT entry_id,
+		        song_id
+		   FROM playlist_entries
+		  WHERE playlist_id = ?
+		  ORDER BY position
+		  LIMIT 1 OFFSET ?`
+	err := service.session.tx.QueryRow(query, ID, position).Scan(&entryID, &songID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", fmt.Errorf("no song at position %d of playlist %s", position, ID)
+		}
+		service.session.Logger.Println(err)
+		return "", "", err
+	}
+	return entryID, songID, nil
+}
+
+// touch records that the songs of the playlist with the given ID have been
+// changed. It returns library.ErrSmartPlaylist if the playlist is a smart
+// playlist.
+func (service *PlaylistService) touch(ID string) error {
+	rules, err := service.rules(ID)
+	if err != nil {
+		return err
+	}
+	if rules != nil {
+		return library.ErrSmartPlaylist
+	}
+
+	update := `UPDATE playlists SET date_modified = ? WHERE playlist_id = ? AND user_id = ?`
+	result, err := service.session.tx.Exec(update, now(), ID, service.session.userID())
+	if err == nil {
+		err = found(result)
+	}
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// rules returns the rules of the playlist with the given ID, or nil if it is
+// not a smart playlist. It returns library.ErrNotFound if the acting user has
+// no such playlist.
+func (service *PlaylistService) rules(ID string) (*library.SmartRules, error) {
+	var rules sql.NullString
+	query := `SELECT rules FROM playlists WHERE playlist_id = ? AND user_id = ?`
+	err := service.session.conn().QueryRow(query, ID, service.session.userID()).Scan(&rules)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, library.ErrNotFound
+		}
+		service.session.Logger.Println(err)
+		return nil, err
+	}
+	return unmarshalRules(rules)
+}
+
+// count sets the song count of the given playlist if it is a smart playlist.
+func (service *PlaylistService) count(p *library.Playlist) error {
+	if p.Attributes.Rules == nil {
+		return nil
+	}
+
+	query, args, err := compileRules(p.Attributes.Rules)
+	if err != nil {
+		return err
+	}
+
+	query = `SELECT COUNT(*) FROM (` + query + `)`
+	err = service.session.conn().QueryRow(query, service.session.songArgs(args...)...).Scan(&p.Attributes.SongCount)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// marshalRules validates the given rules and returns them encoded for storage,
+// or nil if there are none or they are empty, having no match, conditions,
+// sort or limit.
+func marshalRules(rules *library.SmartRules) (interface{}, error) {
+	if rules == nil {
+		return nil, nil
+	}
+	if len(rules.Match) == 0 && len(rules.Conditions) == 0 && len(rules.Sort) == 0 && rules.Limit == 0 {
+		return nil, nil
+	}
+
+	_, _, err := compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// unmarshalRules decodes the given stored rules.
+func unmarshalRules(rules sql.NullString) (*library.SmartRules, error) {
+	if !rules.Valid {
+		return nil, nil
+	}
+
+	var r library.SmartRules
+	err := json.Unmarshal([]byte(rules.String), &r)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// deleteSongEntries removes the song with the given ID from every playlist.
+func (service *PlaylistService) deleteSongEntries(songID string) error {
+	_, err := service.session.tx.Exec(`DELETE FROM playlist_entries WHERE song_id = ?`, songID)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// playlistColumns lists the columns read by scanPlaylist.
+const playlistColumns = `
+		  playlists.playlist_id,
+		  playlists.playlist_name,
+		  IFNULL(playlists.description, ''),
+		  (SELECT COUNT(*)
+		     FROM playlist_entries
+		    WHERE playlist_entries.playlist_id = playlists.playlist_id),
+		  IFNULL(playlists.date_created, ''),
+		  IFNULL(playlists.date_modified, ''),
+		  playlists.rules`
+
+// scanPlaylist reads a playlist from a row that selects playlistColumns.
+func scanPlaylist(row rowScanner) (*library.Playlist, error) {
+	var p library.Playlist
+	var rules sql.NullString
+	err := row.Scan(
+		&p.ID,
+		&p.Attributes.Name,
+		&p.Attributes.Description,
+		&p.Attributes.SongCount,
+		&p.Attributes.DateCreated,
+		&p.Attributes.DateModified,
+		&rules)
+	p.Type = "playlists"
+	if err != nil {
+		return &p, err
+	}
+
+	p.Attributes.Rules, err = unmarshalRules(rules)
+	return &p, err
+}
+
+// Playlist queries the 'playlists' table for a playlist with the given ID and
+// returns the result along with any error.
+func (service *PlaylistService) Playlist(ID string) (*library.Playlist, error) {
+	query := `SELECT` + playlistColumns + ` FROM playlists WHERE playlist_id = ? AND user_id = ?`
+	p, err := scanPlaylist(service.session.conn().QueryRow(query, ID, service.session.userID()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		service.session.Logger.Println(err)
+		return p, err
+	}
+	return p, service.count(p)
+}
+
+// Playlists queries the 'playlists' table for all playlists of the acting user
+// and returns the result along with any error.
+func (service *PlaylistService) Playlists() ([]*library.Playlist, error) {
+	var results []*library.Playlist
+
+	query := `SELECT` + playlistColumns + ` FROM playlists WHERE user_id = ? ORDER BY playlists.playlist_name`
+	rows, err := service.session.conn().Query(query, service.session.userID())
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPlaylist(rows)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return results, err
+		}
+		results = append(results, p)
+	}
+	err = rows.Err()
+	if err != nil {
+		return results, err
+	}
+
+	for _, p := range results {
+		err := service.count(p)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// PlaylistSongs queries the 'playlist_entries' table for the songs of the
+// playlist with the given ID, in order, and returns the result along with any
+// error. The songs of a smart playlist are queried using its rules.
+func (service *PlaylistService) PlaylistSongs(ID string) ([]*library.Song, error) {
+	rules, err := service.rules(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT` + songColumns + ` FROM` + songTables + `
+		  INNER JOIN playlist_entries ON playlist_entries.song_id = songs.song_id
+		WHERE
+		  playlist_entries.playlist_id = ?
+		ORDER BY
+		  playlist_entries.position`
+	args := []interface{}{ID}
+	if rules != nil {
+		query, args, err = compileRules(rules)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := service.session.conn().Query(query, service.session.songArgs(args...)...)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return nil, err
+	}
+
+	results, err := scanSongs(rows)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, err
+	}
+	return results, nil
+}
+
+// CreatePlaylistContext calls CreatePlaylist within the given context.
+func (service *PlaylistService) CreatePlaylistContext(ctx context.Context, attributes *library.PlaylistAttributes) (*library.Playlist, error) {
+	return service.session.bind(ctx).playlistService.CreatePlaylist(attributes)
+}
+
+// UpdatePlaylistContext calls UpdatePlaylist within the given context.
+func (service *PlaylistService) UpdatePlaylistContext(ctx context.Context, ID string, attributes *library.PlaylistAttributes) error {
+	return service.session.bind(ctx).playlistService.UpdatePlaylist(ID, attributes)
+}
+
+// DeletePlaylistContext calls DeletePlaylist within the given context.
+func (service *PlaylistService) DeletePlaylistContext(ctx context.Context, ID string) error {
+	return service.session.bind(ctx).playlistService.DeletePlaylist(ID)
+}
+
+// InsertSongContext calls InsertSong within the given context.
+func (service *PlaylistService) InsertSongContext(ctx context.Context, ID string, songID string, position int) error {
+	return service.session.bind(ctx).playlistService.InsertSong(ID, songID, position)
+}
+
+// MoveSongContext calls MoveSong within the given context.
+func (service *PlaylistService) MoveSongContext(ctx context.Context, ID string, from, to int) error {
+	return service.session.bind(ctx).playlistService.MoveSong(ID, from, to)
+}
+
+// RemoveSongContext calls RemoveSong within the given context.
+func (service *PlaylistService) RemoveSongContext(ctx context.Context, ID string, position int) error {
+	return service.session.bind(ctx).playlistService.RemoveSong(ID, position)
+}
+
+// PlaylistContext calls Playlist within the given context.
+func (service *PlaylistService) PlaylistContext(ctx context.Context, ID string) (*library.Playlist, error) {
+	return service.session.bind(ctx).playlistService.Playlist(ID)
+}
+
+// PlaylistsContext calls Playlists within the given context.
+func (service *PlaylistService) PlaylistsContext(ctx context.Context) ([]*library.Playlist, error) {
+	return service.session.bind(ctx).playlistService.Playlists()
+}
+
+// PlaylistSongsContext calls PlaylistSongs within the given context.
+func (service *PlaylistService) PlaylistSongsContext(ctx context.Context, ID string) ([]*library.Song, error) {
+	return service.session.bind(ctx).playlistService.PlaylistSongs(ID)
+}
@@ -0,0 +1,161 @@
+package sqlite
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// playlistSongNames returns the names of the songs of the playlist with the
+// given ID, in order.
+func playlistSongNames(t *testing.T, ls *Service, ID string) []string {
+	t.Helper()
+
+	songs, err := ls.Session.PlaylistService().PlaylistSongs(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, s := range songs {
+		names = append(names, s.Attributes.Name)
+	}
+	return names
+}
+
+// TestPlaylistCRUD checks that playlists can be created, read, updated and
+// deleted, and that deleting a playlist keeps its songs.
+func TestPlaylistCRUD(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	playlists := ls.Session.PlaylistService()
+
+	_, err := playlists.CreatePlaylist(&library.PlaylistAttributes{Description: "No name"})
+	if err == nil {
+		t.Error("CreatePlaylist created a playlist without a name")
+	}
+
+	road, err := playlists.CreatePlaylist(&library.PlaylistAttributes{Name: "Road", Description: "Long drives"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if road.Type != "playlists" || road.Attributes.Name != "Road" || road.Attributes.Description != "Long drives" ||
+		road.Attributes.DateCreated == "" || road.Attributes.DateModified == "" || road.Attributes.Rules != nil {
+		t.Errorf("CreatePlaylist returned %+v", road)
+	}
+	_, err = playlists.CreatePlaylist(&library.PlaylistAttributes{Name: "Morning"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = playlists.UpdatePlaylist(road.ID, &library.PlaylistAttributes{Name: "Road Trip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := playlists.Playlist(road.ID)
+	if err != nil || p.Attributes.Name != "Road Trip" || p.Attributes.Description != "Long drives" {
+		t.Errorf("Playlist(%s) returned %+v (%v), want Road Trip with its description kept", road.ID, p, err)
+	}
+
+	all, err := playlists.Playlists()
+	if err != nil || len(all) != 2 || all[0].Attributes.Name != "Morning" || all[1].Attributes.Name != "Road Trip" {
+		t.Errorf("Playlists returned %v (%v), want Morning and Road Trip", all, err)
+	}
+
+	err = playlists.InsertSong(road.ID, queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'One'`), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = playlists.DeletePlaylist(road.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = playlists.Playlist(road.ID)
+	if err != nil || p != nil {
+		t.Errorf("Playlist of a deleted playlist returned %+v (%v), want nil", p, err)
+	}
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM playlist_entries`: 0,
+		`SELECT COUNT(*) FROM songs`:            3,
+	} {
+		if n := queryTestInt(t, ls, query); n != want {
+			t.Errorf("%s = %d, want %d", query, n, want)
+		}
+	}
+
+	for name, err := range map[string]error{
+		"UpdatePlaylist": playlists.UpdatePlaylist(road.ID, &library.PlaylistAttributes{Name: "Gone"}),
+		"DeletePlaylist": playlists.DeletePlaylist(road.ID),
+		"InsertSong":     playlists.InsertSong(road.ID, "1", -1),
+	} {
+		if !errors.Is(err, library.ErrNotFound) {
+			t.Errorf("%s of a deleted playlist returned %v, want ErrNotFound", name, err)
+		}
+	}
+	_, err = playlists.PlaylistSongs(road.ID)
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("PlaylistSongs of a deleted playlist returned %v, want ErrNotFound", err)
+	}
+}
+
+// TestPlaylistOrdering checks that songs can be inserted, moved and removed at
+// any position of a playlist, more than once, and that deleted songs leave
+// the playlists they are in.
+func TestPlaylistOrdering(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	playlists := ls.Session.PlaylistService()
+	p, err := playlists.CreatePlaylist(&library.PlaylistAttributes{Name: "Mix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	IDs := make(map[string]string)
+	for _, name := range []string{"One", "Two", "Three"} {
+		IDs[name] = queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = ?`, name)
+	}
+
+	steps := []struct {
+		name string
+		step func() error
+		want []string
+	}{
+		{"append", func() error { return playlists.InsertSong(p.ID, IDs["One"], -1) }, []string{"One"}},
+		{"append past the end", func() error { return playlists.InsertSong(p.ID, IDs["Two"], 5) }, []string{"One", "Two"}},
+		{"insert first", func() error { return playlists.InsertSong(p.ID, IDs["Three"], 0) }, []string{"Three", "One", "Two"}},
+		{"insert duplicate", func() error { return playlists.InsertSong(p.ID, IDs["One"], 2) }, []string{"Three", "One", "One", "Two"}},
+		{"move to the end", func() error { return playlists.MoveSong(p.ID, 0, 3) }, []string{"One", "One", "Two", "Three"}},
+		{"move to the start", func() error { return playlists.MoveSong(p.ID, 3, 0) }, []string{"Three", "One", "One", "Two"}},
+		{"move within", func() error { return playlists.MoveSong(p.ID, 3, 1) }, []string{"Three", "Two", "One", "One"}},
+		{"remove duplicate", func() error { return playlists.RemoveSong(p.ID, 2) }, []string{"Three", "Two", "One"}},
+		{"delete song", func() error { return ls.Session.SongService().DeleteSong(IDs["Two"]) }, []string{"Three", "One"}},
+	}
+	for _, s := range steps {
+		err := s.step()
+		if err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if names := playlistSongNames(t, ls, p.ID); !reflect.DeepEqual(names, s.want) {
+			t.Fatalf("%s: playlist has songs %v, want %v", s.name, names, s.want)
+		}
+	}
+
+	for name, err := range map[string]error{
+		"RemoveSong past the end": playlists.RemoveSong(p.ID, 2),
+		"RemoveSong before start": playlists.RemoveSong(p.ID, -1),
+		"MoveSong from past end":  playlists.MoveSong(p.ID, 5, 0),
+		"InsertSong unknown song": playlists.InsertSong(p.ID, "999", 0),
+	} {
+		if err == nil {
+			t.Errorf("%s returned no error", name)
+		}
+	}
+	if names := playlistSongNames(t, ls, p.ID); !reflect.DeepEqual(names, []string{"Three", "One"}) {
+		t.Errorf("failed changes left playlist songs %v, want [Three One]", names)
+	}
+
+	p, err = playlists.Playlist(p.ID)
+	if err != nil || p.Attributes.SongCount != 2 {
+		t.Errorf("Playlist returned %+v (%v), want 2 songs", p, err)
+	}
+}
@@ -0,0 +1,188 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RatingService manages interactions with the rating data source.
+type RatingService struct {
+	session *Session
+}
+
+// NewRatingService returns a new instance of a RatingService that operates
+// within the given session.
+func NewRatingService(s *Session) RatingService {
+	service := RatingService{session: s}
+	return service
+}
+
+// CreateTable creates the 'ratings' table and returns any errors.
+func (service *RatingService) CreateTable() (sql.Result, error) {
+	create :=
+		`CREATE TABLE IF NOT EXISTS ratings (
+			user_id       INTEGER NOT NULL DEFAULT 0,
+			resource_type TEXT    NOT NULL,
+			resource_id   INTEGER NOT NULL,
+			rating        REAL    NOT NULL DEFAULT 0,
+			loved         INTEGER NOT NULL DEFAULT 0,
+			date_rated    TEXT,
+			PRIMARY KEY('user_id','resource_type','resource_id')
+		)`
+	return service.session.tx.Exec(create)
+}
+
+// DropTable drops the 'ratings' table and returns any errors.
+func (service *RatingService) DropTable() (sql.Result, error) {
+	drop := `DROP TABLE IF EXISTS ratings`
+	return service.session.tx.Exec(drop)
+}
+
+// Rate gives the resource of the given type and ID the given rating from the
+// acting user.
+func (service *RatingService) Rate(resourceType string, ID string, rating float64) error {
+	if rating < 0 || rating > 5 || math.Mod(rating*2, 1) != 0 {
+		return fmt.Errorf("rating %v is not between 0 and 5 in steps of a half star", rating)
+	}
+	return service.set(resourceType, ID, "rating", rating)
+}
+
+// Love sets whether the acting user loves the resource of the given type and
+// ID.
+func (service *RatingService) Love(resourceType string, ID string, loved bool) error {
+	return service.set(resourceType, ID, "loved", loved)
+}
+
+// set sets the given column of the rating of the resource of the given type and
+// ID to the given value.
+func (service *RatingService) set(resourceType string, ID string, column string, value interface{}) error {
+	table, ok := resourceTables[resourceType]
+	if !ok {
+		return fmt.Errorf("resources of type %q cannot be rated", resourceType)
+	}
+
+	return service.session.inTx(func() error {
+		err := service.session.checkUser()
+		if err != nil {
+			return err
+		}
+
+		upsert := fmt.Sprintf(
+			`INSERT INTO ratings
+			             (user_id,
+			              resource_type,
+			              resource_id,
+			              %[1]s,
+			              date_rated)
+			      SELECT ?,
+			             ?,
+			             %[3]s,
+			             ?,
+			             ?
+			        FROM %[2]s
+			       WHERE %[3]s = ?
+			          ON CONFLICT(user_id, resource_type, resource_id)
+			          DO UPDATE SET %[1]s = excluded.%[1]s,
+			                        date_rated = excluded.date_rated`, column, table[0], table[1])
+		result, err := service.session.tx.Exec(upsert, service.session.userID(), resourceType, value, now(), ID)
+		if err == nil {
+			err = found(result)
+		}
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		return nil
+	})
+}
+
+// importRating gives the song whose file is at the given path the given
+// rating from the acting user, unless they have rated it already.
+func (service *RatingService) importRating(path string, rating float64) error {
+	insert :=
+		`INSERT OR IGNORE INTO ratings
+		                       (user_id,
+		                        resource_type,
+		                        resource_id,
+		                        rating,
+		                        date_rated)
+		                SELECT ?,
+		                       'songs',
+		                       song_id,
+		                       ?,
+		                       ?
+		                  FROM songs
+		                 WHERE file_path = ?`
+	_, err := service.session.tx.Exec(insert, service.session.userID(), rating, now(), path)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// prune deletes the ratings of resources that no longer exist.
+func (service *RatingService) prune() error {
+	for resourceType, table := range resourceTables {
+		prune := fmt.Sprintf(
+			`DELETE FROM ratings
+			       WHERE resource_type = ?
+			         AND resource_id NOT IN (SELECT %s FROM %s)`, table[1], table[0])
+		_, err := service.session.tx.Exec(prune, resourceType)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRating converts the value of a POPM or FMPS rating tag to a rating
+// between 0 and 5, rounded to the nearest half star. FMPS ratings are
+// fractions between 0 and 1, and POPM ratings are integers between 0 and 255.
+// The value does not say which tag it was read from, so FMPS ratings must
+// contain a decimal point: "1.0" is 5 stars, but "1" is a POPM rating of 1
+// star. parseRating reports whether the value is a rating.
+func parseRating(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	r, err := strconv.ParseFloat(value, 64)
+	if err != nil || r <= 0 {
+		return 0, false
+	}
+
+	switch {
+	case strings.Contains(value, ".") && r <= 1:
+		r *= 5
+	case r <= 255:
+		// POPM players map whole stars onto 1, 64, 128, 196 and 255.
+		switch {
+		case r < 32:
+			r = 1
+		case r < 96:
+			r = 2
+		case r < 160:
+			r = 3
+		case r < 224:
+			r = 4
+		default:
+			r = 5
+		}
+	default:
+		return 0, false
+	}
+	return math.Round(r*2) / 2, true
+}
+
+// RateContext calls Rate within the given context.
+func (service *RatingService) RateContext(ctx context.Context, resourceType string, ID string, rating float64) error {
+	return service.session.bind(ctx).ratingService.Rate(resourceType, ID, rating)
+}
+
+// LoveContext calls Love within the given context.
+func (service *RatingService) LoveContext(ctx context.Context, resourceType string, ID string, loved bool) error {
+	return service.session.bind(ctx).ratingService.Love(resourceType, ID, loved)
+}
@@ -0,0 +1,36 @@
+package sqlite
+
+import "testing"
+
+// TestParseRating checks that FMPS and POPM ratings are read as ratings of 0
+// to 5 stars, and that unrated and malformed values are not ratings.
+func TestParseRating(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   float64
+		wantOK bool
+	}{
+		{"1.0", 5, true},
+		{"0.5", 2.5, true},
+		{"0.55", 3, true},
+		{" 0.8 ", 4, true},
+		{"1", 1, true},
+		{"64", 2, true},
+		{"128", 3, true},
+		{"196", 4, true},
+		{"255", 5, true},
+		{"0", 0, false},
+		{"0.0", 0, false},
+		{"256", 0, false},
+		{"-1", 0, false},
+		{"five", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRating(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRating(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// RelocationReport summarizes the changes a relocation made to the library and
+// lists every song file that was not found at its new location.
+type RelocationReport struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Roots   int64    `json:"roots"`
+	Songs   int64    `json:"songs"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Relocate moves every library root and song at or beneath the given old
+// directory to the same location beneath the given new directory, in a single
+// transaction, so that songs keep their IDs when the files of the library are
+// moved. Relocated songs belong to the library root they are moved into, and
+// the relocation is refused if any song would be moved out of every root. The
+// files themselves are not moved; the report lists every relocated song file
+// that does not exist at its new location.
+func (ls *Service) Relocate(oldDir, newDir string) (*RelocationReport, error) {
+	oldDir, err := filepath.Abs(oldDir)
+	if err != nil {
+		return nil, err
+	}
+	newDir, err = filepath.Abs(newDir)
+	if err != nil {
+		return nil, err
+	}
+	if oldDir == newDir {
+		return nil, fmt.Errorf("cannot relocate %s to itself", oldDir)
+	}
+
+	report := &RelocationReport{From: oldDir, To: newDir}
+	err = ls.Session.inTx(func() error {
+		n, err := ls.Session.RootService.relocate(oldDir, newDir)
+		if err != nil {
+			return err
+		}
+		report.Roots = n
+
+		files, err := ls.Session.songService.relocate(oldDir, newDir)
+		if err != nil {
+			return err
+		}
+		report.Songs = int64(len(files))
+
+		roots := make(map[string]*library.Root)
+		for path, sf := range files {
+			dir := filepath.Dir(path)
+			root, ok := roots[dir]
+			if !ok {
+				root, err = ls.Session.RootService.rootFor(path)
+				if err != nil {
+					return err
+				}
+				roots[dir] = root
+			}
+			if root == nil {
+				return fmt.Errorf("cannot relocate %s to %s: %s would not be within a library root", oldDir, newDir, path)
+			}
+
+			err = ls.Session.songService.setRoot(sf.id, root.ID)
+			if err != nil {
+				return err
+			}
+
+			_, err := os.Stat(path)
+			if err != nil {
+				report.Missing = append(report.Missing, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		ls.Session.Logger.Println(err)
+		return report, err
+	}
+
+	sort.Strings(report.Missing)
+	return report, nil
+}
+
+// RelocateContext calls Relocate within the given context.
+func (ls *Service) RelocateContext(ctx context.Context, oldDir, newDir string) (*RelocationReport, error) {
+	b := &Service{client: ls.client, Session: ls.Session.bind(ctx)}
+	return b.Relocate(oldDir, newDir)
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestRelocateOutOfRoot checks that songs cannot be relocated out of every
+// root, and that songs relocated into another root no longer belong to the
+// root they left.
+func TestRelocateOutOfRoot(t *testing.T) {
+	dir := t.TempDir()
+	music, other := filepath.Join(dir, "music"), filepath.Join(dir, "other")
+	writeTestFile(t, filepath.Join(music, "a", "1.mp3"), "title", "One", "artist", "Ann")
+	writeTestFile(t, filepath.Join(music, "a", "2.mp3"), "title", "Two", "artist", "Ann")
+	writeTestFile(t, filepath.Join(music, "b", "3.mp3"), "title", "Three", "artist", "Bob")
+	writeTestFile(t, filepath.Join(other, "4.mp3"), "title", "Four", "artist", "Bob")
+
+	ls := openTestService(t)
+	for _, path := range []string{music, other} {
+		_, err := ls.Scan(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	roots, err := ls.Session.RootService.List()
+	if err != nil || len(roots) != 2 {
+		t.Fatalf("List returned %d roots (%v), want 2", len(roots), err)
+	}
+	musicRoot := roots[0]
+
+	_, err = ls.Relocate(filepath.Join(music, "a"), filepath.Join(dir, "elsewhere", "a"))
+	if err == nil {
+		t.Fatal("Relocate out of every root succeeded, want an error")
+	}
+
+	report, err := ls.Relocate(filepath.Join(music, "a"), filepath.Join(other, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Songs != 2 || len(report.Missing) != 2 {
+		t.Fatalf("Relocate moved %d songs with %d missing, want 2 and 2", report.Songs, len(report.Missing))
+	}
+
+	removed, err := ls.Session.RootService.Remove(musicRoot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed.Deleted != 1 {
+		t.Fatalf("Remove deleted %d songs, want 1", removed.Deleted)
+	}
+}
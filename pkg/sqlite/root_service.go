@@ -0,0 +1,280 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// RootService manages the library roots, the directories whose files make up
+// the library.
+type RootService struct {
+	session *Session
+}
+
+// NewRootService returns a new instance of a RootService that operates within
+// the given session.
+func NewRootService(s *Session) RootService {
+	service := RootService{session: s}
+	return service
+}
+
+// CreateTable creates the 'library_roots' table and returns any errors.
+func (service *RootService) CreateTable() (sql.Result, error) {
+	create :=
+		`CREATE TABLE IF NOT EXISTS library_roots (
+			root_id      INTEGER PRIMARY KEY,
+			root_path    TEXT    UNIQUE NOT NULL,
+			date_added   TEXT,
+			last_scanned TEXT
+		)`
+	return service.session.tx.Exec(create)
+}
+
+// DropTable drops the 'library_roots' table and returns any errors.
+func (service *RootService) DropTable() (sql.Result, error) {
+	drop := `DROP TABLE IF EXISTS library_roots`
+	return service.session.tx.Exec(drop)
+}
+
+// Add adds the given path as a library root, if it is not one already, and
+// returns the root. Unlike Service.AddPath and Service.Scan, which add the
+// root and scan it at once, Add leaves the path unscanned until the root is
+// rescanned.
+func (service *RootService) Add(path string) (*library.Root, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	insert :=
+		`INSERT OR IGNORE INTO library_roots
+		                       (root_path,
+		                        date_added)
+		                VALUES (?, ?)`
+	err = service.session.inTx(func() error {
+		_, err := service.session.tx.Exec(insert, path, now())
+		return err
+	})
+	if err != nil {
+		service.session.Logger.Println(err)
+		return nil, err
+	}
+
+	return service.query(`WHERE root_path = ?`, path)
+}
+
+// Remove removes the library root with the given ID along with its songs and
+// any albums, artists and genres left without songs, or returns
+// library.ErrNotFound if there is no such root. The files of the root are left
+// untouched.
+func (service *RootService) Remove(ID string) (*ScanReport, error) {
+	root, err := service.Root(ID)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, library.ErrNotFound
+	}
+
+	report := &ScanReport{Path: root.Attributes.Path}
+	err = service.session.inTx(func() error {
+		known, err := service.session.songService.filesByRoot(ID)
+		if err != nil {
+			return err
+		}
+
+		sc := &scanner{
+			session: service.session,
+			known:   known,
+			moved:   make(map[string]bool),
+			report:  report}
+		err = sc.finish()
+		if err != nil {
+			return err
+		}
+
+		_, err = service.session.tx.Exec(`DELETE FROM library_roots WHERE root_id = ?`, ID)
+		return err
+	})
+	if err != nil {
+		service.session.Logger.Println(err)
+		return report, err
+	}
+	return report, nil
+}
+
+// Root queries the 'library_roots' table for a root with the given ID and
+// returns the result along with any error.
+func (service *RootService) Root(ID string) (*library.Root, error) {
+	return service.query(`WHERE root_id = ?`, ID)
+}
+
+// List queries the 'library_roots' table for all library roots and returns the
+// result along with any error.
+func (service *RootService) List() ([]*library.Root, error) {
+	var results []*library.Root
+
+	query :=
+		`SELECT root_id,
+		        root_path,
+		        date_added,
+		        last_scanned
+		   FROM library_roots
+		  ORDER BY root_path`
+	rows, err := service.session.conn().Query(query)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r library.Root
+		var dateAdded, lastScanned sql.NullString
+		err := rows.Scan(
+			&r.ID,
+			&r.Attributes.Path,
+			&dateAdded,
+			&lastScanned)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return results, err
+		}
+		r.Type = "roots"
+		r.Attributes.DateAdded = dateAdded.String
+		r.Attributes.LastScanned = lastScanned.String
+		results = append(results, &r)
+	}
+	return results, rows.Err()
+}
+
+// Rescan scans the library root with the given ID, as configured by the given
+// options, and returns a report of the changes made, or returns
+// library.ErrNotFound if there is no such root.
+func (service *RootService) Rescan(ctx context.Context, ID string, opts *ScanOptions) (*ScanReport, error) {
+	root, err := service.Root(ID)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, library.ErrNotFound
+	}
+	return service.session.scan(ctx, root.Attributes.Path, root.ID, opts)
+}
+
+// RescanAll scans every library root in turn, as configured by the given
+// options, and returns a report for each root scanned.
+func (service *RootService) RescanAll(ctx context.Context, opts *ScanOptions) ([]*ScanReport, error) {
+	var results []*ScanReport
+
+	roots, err := service.List()
+	if err != nil {
+		return results, err
+	}
+
+	for _, root := range roots {
+		report, err := service.session.scan(ctx, root.Attributes.Path, root.ID, opts)
+		if report != nil {
+			results = append(results, report)
+		}
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// rootFor returns the library root that the given path lies within, or nil if
+// the path is not within any root.
+func (service *RootService) rootFor(path string) (*library.Root, error) {
+	where :=
+		`WHERE root_path = ?
+		    OR substr(?, 1, length(root_path) + 1) = root_path || ?
+		 ORDER BY length(root_path) DESC
+		 LIMIT 1`
+	return service.query(where, path, path, string(filepath.Separator))
+}
+
+// relocate rewrites the paths of the library roots at or beneath the given old
+// directory so that they lie at or beneath the given new directory instead, and
+// returns the number of roots relocated.
+func (service *RootService) relocate(oldDir, newDir string) (int64, error) {
+	update :=
+		`UPDATE library_roots
+		    SET root_path = ? || substr(root_path, length(?) + 1)
+		  WHERE root_path = ?
+		     OR substr(root_path, 1, length(?) + 1) = ? || ?`
+	result, err := service.session.tx.Exec(update,
+		newDir, oldDir,
+		oldDir,
+		oldDir, oldDir, string(filepath.Separator))
+	if err != nil {
+		service.session.Logger.Println(err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// scanned records that the library root with the given ID has been scanned.
+func (service *RootService) scanned(ID string) error {
+	update := `UPDATE library_roots SET last_scanned = ? WHERE root_id = ?`
+	_, err := service.session.tx.Exec(update, now(), ID)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// query queries the 'library_roots' table for the first root that meets the
+// given clause and returns the result, or nil if there is none.
+func (service *RootService) query(clause string, args ...interface{}) (*library.Root, error) {
+	var r library.Root
+	var dateAdded, lastScanned sql.NullString
+
+	query :=
+		`SELECT root_id,
+		        root_path,
+		        date_added,
+		        last_scanned
+		   FROM library_roots ` + clause
+	err := service.session.conn().QueryRow(query, args...).Scan(
+		&r.ID,
+		&r.Attributes.Path,
+		&dateAdded,
+		&lastScanned)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		service.session.Logger.Println(err)
+		return nil, err
+	}
+	r.Type = "roots"
+	r.Attributes.DateAdded = dateAdded.String
+	r.Attributes.LastScanned = lastScanned.String
+	return &r, nil
+}
+
+// AddContext calls Add within the given context.
+func (service *RootService) AddContext(ctx context.Context, path string) (*library.Root, error) {
+	return service.session.bind(ctx).RootService.Add(path)
+}
+
+// RemoveContext calls Remove within the given context.
+func (service *RootService) RemoveContext(ctx context.Context, ID string) (*ScanReport, error) {
+	return service.session.bind(ctx).RootService.Remove(ID)
+}
+
+// RootContext calls Root within the given context.
+func (service *RootService) RootContext(ctx context.Context, ID string) (*library.Root, error) {
+	return service.session.bind(ctx).RootService.Root(ID)
+}
+
+// ListContext calls List within the given context.
+func (service *RootService) ListContext(ctx context.Context) ([]*library.Root, error) {
+	return service.session.bind(ctx).RootService.List()
+}
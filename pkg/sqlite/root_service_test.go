@@ -0,0 +1,24 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// TestUnknownRoot checks that removing or rescanning an unknown root returns
+// ErrNotFound.
+func TestUnknownRoot(t *testing.T) {
+	ls := openTestService(t)
+
+	_, err := ls.Session.RootService.Remove("42")
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("Remove of an unknown root returned %v, want ErrNotFound", err)
+	}
+	_, err = ls.Session.RootService.Rescan(context.Background(), "42", nil)
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("Rescan of an unknown root returned %v, want ErrNotFound", err)
+	}
+}
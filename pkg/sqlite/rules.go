@@ -0,0 +1,264 @@
+package sqlite
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// fieldKind determines the operators that apply to a rule field and how its
+// values are compared.
+type fieldKind int
+
+const (
+	textField fieldKind = iota
+	numberField
+	dateField
+)
+
+// ruleField represents a song field that rules may refer to.
+type ruleField struct {
+	expr string
+	kind fieldKind
+}
+
+// ruleFields maps the fields that rules and song filters may refer to onto the
+// expressions they are compiled to. The expressions are read from the tables
+// joined by songTables. Missing release dates are NULL, so that songs without
+// one are neither before nor after any date.
+var ruleFields = map[string]ruleField{
+	"name":        {`IFNULL(songs.song_name, '')`, textField},
+	"sortName":    {`IFNULL(NULLIF(songs.song_name_sort, ''), songs.song_name)`, textField},
+	"artist":      {`IFNULL(artists.artist_name, '')`, textField},
+	"album":       {`IFNULL(albums.album_name, '')`, textField},
+	"genre":       {`IFNULL(genres.genre_name, '')`, textField},
+	"lyrics":      {`IFNULL(songs.lyrics, '')`, textField},
+	"composer":    {`IFNULL(songs.composer_name, '')`, textField},
+	"conductor":   {`IFNULL(songs.conductor, '')`, textField},
+	"filePath":    {`songs.file_path`, textField},
+	"year":        {`CAST(substr(NULLIF(songs.release_date, ''), 1, 4) AS INTEGER)`, numberField},
+	"trackNumber": {`CAST(songs.track_number AS INTEGER)`, numberField},
+	"discNumber":  {`CAST(songs.disc_number AS INTEGER)`, numberField},
+	"duration":    {`IFNULL(songs.duration_in_millis, 0)`, numberField},
+	"releaseDate": {`NULLIF(songs.release_date, '')`, dateField},
+	"dateAdded":   {`songs.date_added`, dateField},
+	"playCount":   {songPlayCount, numberField},
+	"skipCount":   {songSkipCount, numberField},
+	"lastPlayed":  {songLastPlayed, dateField},
+	"rating":      {`IFNULL(ratings.rating, 0)`, numberField},
+	"loved":       {`IFNULL(ratings.loved, 0)`, numberField},
+}
+
+// ruleScales maps the fields whose values are given in other units than they
+// are stored in onto the factors that convert the values. Durations are given
+// in seconds and compared in milliseconds, so that a song of 180.9 seconds is
+// not less than 180.
+var ruleScales = map[string]float64{
+	"duration": 1000,
+}
+
+// ruleOperators lists the operators that apply to each kind of field along
+// with the number of values each operator takes, where -1 is one or more.
+var ruleOperators = map[fieldKind]map[string]int{
+	textField: {
+		"is":          1,
+		"isNot":       1,
+		"isAnyOf":     -1,
+		"isNoneOf":    -1,
+		"contains":    1,
+		"notContains": 1,
+		"startsWith":  1,
+		"endsWith":    1,
+		"isEmpty":     0,
+		"isNotEmpty":  0,
+	},
+	numberField: {
+		"is":         1,
+		"isNot":      1,
+		"isAnyOf":    -1,
+		"isNoneOf":   -1,
+		"lessThan":   1,
+		"atMost":     1,
+		"moreThan":   1,
+		"atLeast":    1,
+		"between":    2,
+		"isEmpty":    0,
+		"isNotEmpty": 0,
+	},
+	dateField: {
+		"is":         1,
+		"isNot":      1,
+		"before":     1,
+		"lessThan":   1,
+		"atMost":     1,
+		"after":      1,
+		"moreThan":   1,
+		"atLeast":    1,
+		"between":    2,
+		"inTheLast":  1,
+		"isEmpty":    0,
+		"isNotEmpty": 0,
+	},
+}
+
+// compileRules compiles the given rules into a parameterised query for the
+// songs they select, reading songColumns, and returns the query along with
+// its arguments.
+func compileRules(rules *library.SmartRules) (string, []interface{}, error) {
+	var args []interface{}
+	query := bytes.NewBufferString(`SELECT` + songColumns + ` FROM` + songTables)
+
+	join := ` AND `
+	switch rules.Match {
+	case "", "all":
+	case "any":
+		join = ` OR `
+	default:
+		return "", nil, fmt.Errorf("unknown rule match %q", rules.Match)
+	}
+
+	for i, c := range rules.Conditions {
+		clause, values, err := compileCondition(c, ruleFields)
+		if err != nil {
+			return "", nil, err
+		}
+		if i == 0 {
+			query.WriteString(` WHERE (`)
+		} else {
+			query.WriteString(join)
+		}
+		query.WriteString(clause)
+		args = append(args, values...)
+	}
+	if len(rules.Conditions) > 0 {
+		query.WriteString(`)`)
+	}
+
+	order, err := orderBy(rules.Sort, ruleFields, "songs.song_id")
+	if err != nil {
+		return "", nil, err
+	}
+	query.WriteString(order)
+
+	if rules.Limit < 0 {
+		return "", nil, fmt.Errorf("rule limit %d is negative", rules.Limit)
+	}
+	if rules.Limit > 0 {
+		query.WriteString(` LIMIT ?`)
+		args = append(args, rules.Limit)
+	}
+	return query.String(), args, nil
+}
+
+// compileCondition compiles the given condition on one of the given fields
+// into an SQL expression and returns it along with its arguments.
+func compileCondition(c library.Condition, fields map[string]ruleField) (string, []interface{}, error) {
+	field, ok := fields[c.Field]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown rule field %q", c.Field)
+	}
+
+	n, ok := ruleOperators[field.kind][c.Operator]
+	if !ok {
+		return "", nil, fmt.Errorf("operator %q does not apply to rule field %q", c.Operator, c.Field)
+	}
+	if n < 0 && len(c.Values) == 0 {
+		return "", nil, fmt.Errorf("operator %q takes at least one value", c.Operator)
+	}
+	if n >= 0 && len(c.Values) != n {
+		return "", nil, fmt.Errorf("operator %q takes %d values, got %d", c.Operator, n, len(c.Values))
+	}
+
+	args := make([]interface{}, len(c.Values))
+	for i, value := range c.Values {
+		switch {
+		case field.kind == numberField:
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return "", nil, fmt.Errorf("rule field %q: %q is not a number", c.Field, value)
+			}
+			if scale, ok := ruleScales[c.Field]; ok {
+				number *= scale
+			}
+			args[i] = number
+		case c.Operator == "inTheLast":
+			days, err := strconv.Atoi(value)
+			if err != nil || days < 0 {
+				return "", nil, fmt.Errorf("rule field %q: %q is not a number of days", c.Field, value)
+			}
+			args[i] = time.Now().UTC().AddDate(0, 0, -days).Format(time.RFC3339)
+		default:
+			args[i] = value
+		}
+	}
+
+	// Dates are compared to the precision of the value they are compared
+	// with, so that every date in 1999 is at most "1999" and is "1999".
+	// Negations select missing values too, which no value equals.
+	expr := func(i int) string {
+		if field.kind == dateField && c.Operator != "inTheLast" {
+			return fmt.Sprintf(`substr(%s, 1, %d)`, field.expr, len(c.Values[i]))
+		}
+		return field.expr
+	}
+
+	switch c.Operator {
+	case "is":
+		if field.kind == textField {
+			return expr(0) + ` = ? COLLATE NOCASE`, args, nil
+		}
+		return expr(0) + ` = ?`, args, nil
+	case "isNot":
+		if field.kind == textField {
+			return `(` + expr(0) + ` <> ? COLLATE NOCASE OR ` + field.expr + ` IS NULL)`, args, nil
+		}
+		return `(` + expr(0) + ` <> ? OR ` + field.expr + ` IS NULL)`, args, nil
+	case "isAnyOf", "isNoneOf":
+		in := expr(0)
+		if field.kind == textField {
+			in += ` COLLATE NOCASE`
+		}
+		list := ` IN (` + strings.TrimSuffix(strings.Repeat(`?, `, len(args)), `, `) + `)`
+		if c.Operator == "isNoneOf" {
+			return `(` + in + ` NOT` + list + ` OR ` + field.expr + ` IS NULL)`, args, nil
+		}
+		return in + list, args, nil
+	case "isEmpty", "isNotEmpty":
+		empty := `IFNULL(` + field.expr + `, '') = ''`
+		if field.kind == numberField {
+			empty = `IFNULL(` + field.expr + `, 0) = 0`
+		}
+		if c.Operator == "isNotEmpty" {
+			return `NOT ` + empty, nil, nil
+		}
+		return empty, nil, nil
+	case "contains":
+		return expr(0) + ` LIKE ? ESCAPE '\'`, []interface{}{`%` + escapeLike(c.Values[0]) + `%`}, nil
+	case "notContains":
+		return `(` + expr(0) + ` NOT LIKE ? ESCAPE '\' OR ` + field.expr + ` IS NULL)`, []interface{}{`%` + escapeLike(c.Values[0]) + `%`}, nil
+	case "startsWith":
+		return expr(0) + ` LIKE ? ESCAPE '\'`, []interface{}{escapeLike(c.Values[0]) + `%`}, nil
+	case "endsWith":
+		return expr(0) + ` LIKE ? ESCAPE '\'`, []interface{}{`%` + escapeLike(c.Values[0])}, nil
+	case "lessThan", "before":
+		return expr(0) + ` < ?`, args, nil
+	case "atMost":
+		return expr(0) + ` <= ?`, args, nil
+	case "moreThan", "after", "inTheLast":
+		return expr(0) + ` > ?`, args, nil
+	case "atLeast":
+		return expr(0) + ` >= ?`, args, nil
+	default:
+		return `(` + expr(0) + ` >= ? AND ` + expr(1) + ` <= ?)`, args, nil
+	}
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern in the given value.
+func escapeLike(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(value)
+}
@@ -0,0 +1,256 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// TestSmartPlaylistRules checks that the songs of smart playlists are selected,
+// sorted and limited by their rules each time they are read.
+func TestSmartPlaylistRules(t *testing.T) {
+	dir := t.TempDir()
+	for _, song := range []struct{ name, genre, year string }{
+		{"A", "Jazz", "1955"},
+		{"B", "Jazz", "1960"},
+		{"C", "Jazz", "1966"},
+		{"D", "Rock", "1960"},
+		{"E", "Jazz", ""},
+	} {
+		writeTestFile(t, filepath.Join(dir, song.name+".mp3"), "title", song.name, "genre", song.genre, "year", song.year)
+	}
+	ls := openTestService(t)
+	_, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	IDs := make(map[string]string)
+	for _, name := range []string{"A", "B", "C", "D", "E"} {
+		IDs[name] = queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = ?`, name)
+	}
+	_, err = ls.Session.PlayService().RecordPlay(&library.PlayAttributes{SongID: IDs["C"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ls.Session.RatingService().Rate("songs", IDs["D"], 4.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jazz := library.Condition{Field: "genre", Operator: "is", Values: []string{"jazz"}}
+	fifties := library.Condition{Field: "year", Operator: "between", Values: []string{"1955", "1965"}}
+	tests := []struct {
+		name  string
+		rules library.SmartRules
+		want  []string
+	}{
+		{"all", library.SmartRules{Conditions: []library.Condition{jazz, fifties}, Sort: "-year"}, []string{"B", "A"}},
+		{"limit", library.SmartRules{Conditions: []library.Condition{jazz, fifties}, Sort: "-year", Limit: 1}, []string{"B"}},
+		{"any", library.SmartRules{Match: "any", Conditions: []library.Condition{
+			{Field: "genre", Operator: "is", Values: []string{"Rock"}},
+			{Field: "year", Operator: "is", Values: []string{"1966"}}}, Sort: "name"}, []string{"C", "D"}},
+		{"none", library.SmartRules{Conditions: []library.Condition{
+			{Field: "name", Operator: "isNoneOf", Values: []string{"a", "b"}}}, Sort: "-name"}, []string{"E", "D", "C"}},
+		{"earlier year", library.SmartRules{Conditions: []library.Condition{
+			{Field: "year", Operator: "lessThan", Values: []string{"1960"}}}}, []string{"A"}},
+		{"empty", library.SmartRules{Conditions: []library.Condition{
+			{Field: "year", Operator: "isEmpty"}}}, []string{"E"}},
+		{"release date", library.SmartRules{Conditions: []library.Condition{
+			{Field: "releaseDate", Operator: "before", Values: []string{"1960"}}}}, []string{"A"}},
+		{"added lately", library.SmartRules{Conditions: []library.Condition{
+			{Field: "dateAdded", Operator: "inTheLast", Values: []string{"30"}}}, Sort: "name"}, []string{"A", "B", "C", "D", "E"}},
+		{"played", library.SmartRules{Conditions: []library.Condition{
+			{Field: "playCount", Operator: "atLeast", Values: []string{"1"}}}}, []string{"C"}},
+		{"rated", library.SmartRules{Conditions: []library.Condition{
+			{Field: "rating", Operator: "moreThan", Values: []string{"4"}}}}, []string{"D"}},
+		{"no conditions", library.SmartRules{Sort: "-genre,name", Limit: 2}, []string{"D", "A"}},
+	}
+
+	playlists := ls.Session.PlaylistService()
+	for _, tt := range tests {
+		rules := tt.rules
+		p, err := playlists.CreatePlaylist(&library.PlaylistAttributes{Name: tt.name, Rules: &rules})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if names := playlistSongNames(t, ls, p.ID); !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%s: playlist has songs %v, want %v", tt.name, names, tt.want)
+		}
+		if p.Attributes.SongCount != len(tt.want) {
+			t.Errorf("%s: playlist has song count %d, want %d", tt.name, p.Attributes.SongCount, len(tt.want))
+		}
+	}
+}
+
+// TestSmartPlaylistIsLive checks that a smart playlist selects songs added
+// after it was created, and that its songs cannot be changed by hand.
+func TestSmartPlaylistIsLive(t *testing.T) {
+	ls := openTestService(t)
+	dir := scanTestLibrary(t, ls)
+	playlists := ls.Session.PlaylistService()
+	p, err := playlists.CreatePlaylist(&library.PlaylistAttributes{Name: "Rock", Rules: &library.SmartRules{
+		Conditions: []library.Condition{{Field: "genre", Operator: "is", Values: []string{"Rock"}}},
+		Sort:       "name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "4.mp3"), "title", "Four", "artist", "Bob", "genre", "Rock")
+	_, err = ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := playlistSongNames(t, ls, p.ID); !reflect.DeepEqual(names, []string{"Four", "One", "Two"}) {
+		t.Errorf("playlist has songs %v, want [Four One Two]", names)
+	}
+
+	err = playlists.InsertSong(p.ID, queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'Three'`), -1)
+	if !errors.Is(err, library.ErrSmartPlaylist) {
+		t.Errorf("InsertSong into a smart playlist returned %v, want ErrSmartPlaylist", err)
+	}
+}
+
+// TestSmartPlaylistInvalidRules checks that rules that cannot be compiled are
+// refused when a playlist is created.
+func TestSmartPlaylistInvalidRules(t *testing.T) {
+	ls := openTestService(t)
+	tests := []library.SmartRules{
+		{Match: "some"},
+		{Conditions: []library.Condition{{Field: "mood", Operator: "is", Values: []string{"happy"}}}},
+		{Conditions: []library.Condition{{Field: "name", Operator: "between", Values: []string{"a", "b"}}}},
+		{Conditions: []library.Condition{{Field: "year", Operator: "is", Values: []string{"nineteen"}}}},
+		{Conditions: []library.Condition{{Field: "year", Operator: "between", Values: []string{"1955"}}}},
+		{Conditions: []library.Condition{{Field: "genre", Operator: "isAnyOf"}}},
+		{Conditions: []library.Condition{{Field: "dateAdded", Operator: "inTheLast", Values: []string{"-3"}}}},
+		{Sort: "mood"},
+		{Limit: -1},
+	}
+	for i, rules := range tests {
+		rules := rules
+		_, err := ls.Session.PlaylistService().CreatePlaylist(&library.PlaylistAttributes{Name: fmt.Sprint(i), Rules: &rules})
+		if err == nil {
+			t.Errorf("CreatePlaylist accepted rules %+v", rules)
+		}
+	}
+}
+
+// TestSmartPlaylistCleared checks that updating a smart playlist with empty
+// rules makes it a regular playlist whose songs can be changed, and that
+// updating it without rules leaves its rules alone.
+func TestSmartPlaylistCleared(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	playlists := ls.Session.PlaylistService()
+	p, err := playlists.CreatePlaylist(&library.PlaylistAttributes{Name: "Rock", Rules: &library.SmartRules{
+		Conditions: []library.Condition{{Field: "genre", Operator: "is", Values: []string{"Rock"}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = playlists.UpdatePlaylist(p.ID, &library.PlaylistAttributes{Name: "Still rock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	smart, err := playlists.Playlist(p.ID)
+	if err != nil || smart.Attributes.Rules == nil || smart.Attributes.SongCount != 2 {
+		t.Fatalf("renamed smart playlist is %+v (%v), want its rules and 2 songs", smart, err)
+	}
+
+	err = playlists.UpdatePlaylist(p.ID, &library.PlaylistAttributes{Rules: &library.SmartRules{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	regular, err := playlists.Playlist(p.ID)
+	if err != nil || regular.Attributes.Rules != nil || regular.Attributes.SongCount != 0 || regular.Attributes.Name != "Still rock" {
+		t.Fatalf("cleared playlist is %+v (%v), want a regular playlist named Still rock without songs", regular, err)
+	}
+
+	three := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'Three'`)
+	err = playlists.InsertSong(p.ID, three, -1)
+	if err != nil {
+		t.Fatalf("InsertSong into a cleared playlist returned %v", err)
+	}
+	if names := playlistSongNames(t, ls, p.ID); !reflect.DeepEqual(names, []string{"Three"}) {
+		t.Errorf("cleared playlist has songs %v, want [Three]", names)
+	}
+
+	empty, err := playlists.CreatePlaylist(&library.PlaylistAttributes{Name: "Empty", Rules: &library.SmartRules{}})
+	if err != nil || empty.Attributes.Rules != nil {
+		t.Errorf("CreatePlaylist with empty rules returned %+v (%v), want a regular playlist", empty, err)
+	}
+}
+
+// TestConditionEdges checks that durations are compared to the millisecond,
+// that negations select songs missing the value, and that the values of a
+// repeated parameter are taken whole.
+func TestConditionEdges(t *testing.T) {
+	ls := openTestService(t)
+	for _, song := range []library.SongAttributes{
+		{FilePath: "/music/1.mp3", Name: "Short", GenreName: "Rock", ReleaseDate: "1999", DurationInMillis: 179000},
+		{FilePath: "/music/2.mp3", Name: "Edge", GenreName: "Rhythm, Blues", DurationInMillis: 180900},
+		{FilePath: "/music/3.mp3", Name: "Long", GenreName: "Jazz", ReleaseDate: "2004", DurationInMillis: 181000},
+	} {
+		song := song
+		addTestSong(t, ls, &song, &library.AlbumAttributes{Name: song.Name})
+	}
+
+	tests := []struct {
+		query url.Values
+		want  []string
+	}{
+		{url.Values{"filter[duration][lt]": {"180"}}, []string{"Short"}},
+		{url.Values{"filter[duration][lte]": {"180.9"}}, []string{"Edge", "Short"}},
+		{url.Values{"filter[duration][gt]": {"180"}}, []string{"Edge", "Long"}},
+		{url.Values{"filter[year][ne]": {"1999"}}, []string{"Edge", "Long"}},
+		{url.Values{"filter[year][nin]": {"1999", "2004"}}, []string{"Edge"}},
+		{url.Values{"filter[releaseDate][ne]": {"2004"}}, []string{"Edge", "Short"}},
+		{url.Values{"filter[genre][in]": {"Rhythm, Blues"}}, []string{"Edge"}},
+		{url.Values{"filter[genre][in]": {"rhythm, blues", "Jazz"}}, []string{"Edge", "Long"}},
+		{url.Values{"filter[genre][nin]": {"Rhythm, Blues"}}, []string{"Long", "Short"}},
+	}
+	for _, tt := range tests {
+		f, err := library.ParseSongQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseSongQuery(%v) returned %v", tt.query, err)
+			continue
+		}
+		f.Sort = "name"
+		songs, _, err := ls.Session.SongService().FilterSongs(f)
+		if err != nil {
+			t.Errorf("%v: %v", tt.query, err)
+			continue
+		}
+		names := []string{}
+		for _, s := range songs {
+			names = append(names, s.Attributes.Name)
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%v selected %v, want %v", tt.query, names, tt.want)
+		}
+	}
+
+	songs, err := ls.Session.SongService().Songs(map[string]string{"filter[genre][in]": "Rock, Jazz", "sort": "name"})
+	if err != nil || len(songs) != 2 || songs[0].Attributes.Name != "Long" || songs[1].Attributes.Name != "Short" {
+		t.Errorf("Songs with a list separated by commas returned %d songs (%v), want Long and Short", len(songs), err)
+	}
+	for _, query := range []url.Values{
+		{"filter[name][eq]": {"Short", "Long"}},
+		{"filter[year][between]": {"1999"}},
+		{"sort": {"name", "-name"}},
+	} {
+		f, err := library.ParseSongQuery(query)
+		if err == nil {
+			_, _, err = ls.Session.SongService().FilterSongs(f)
+		}
+		if err == nil {
+			t.Errorf("%v selected songs, want an error", query)
+		}
+	}
+}
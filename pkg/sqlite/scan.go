@@ -0,0 +1,692 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeremybouzigard/library"
+	"github.com/jeremybouzigard/metadata/pkg/metadata"
+)
+
+// fingerprintSize is the number of bytes read from each end of a file to
+// compute its content fingerprint.
+const fingerprintSize = 64 * 1024
+
+// readMetadata reads the tags of the audio file at the given path. It is a
+// variable so that tests can scan files without real tags.
+var readMetadata = func(ms *metadata.Service, path string) (*metadata.Metadata, error) {
+	return ms.Metadata(path)
+}
+
+// ScanStage identifies the stage of a scan in which a file failed.
+type ScanStage string
+
+// Stages of a scan in which a file may fail.
+const (
+	StageWalk        ScanStage = "walk"
+	StageMetadata    ScanStage = "metadata"
+	StageGenre       ScanStage = "genre"
+	StageArtist      ScanStage = "artist"
+	StageAlbum       ScanStage = "album"
+	StageSong        ScanStage = "song"
+	StageDiscography ScanStage = "discography"
+)
+
+// ScanFailure describes a file that a scan failed to import.
+type ScanFailure struct {
+	Path  string
+	Stage ScanStage
+	Err   error
+}
+
+// Error returns the failure as a string.
+func (f *ScanFailure) Error() string {
+	return fmt.Sprintf("%s: %s: %v", f.Stage, f.Path, f.Err)
+}
+
+// Unwrap returns the underlying error of the failure.
+func (f *ScanFailure) Unwrap() error {
+	return f.Err
+}
+
+// MarshalJSON encodes the failure with its underlying error as a string.
+func (f *ScanFailure) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Path  string    `json:"path"`
+		Stage ScanStage `json:"stage"`
+		Error string    `json:"error"`
+	}{f.Path, f.Stage, f.Err.Error()})
+}
+
+// ScanReport summarizes the changes a scan made to the library and lists every
+// file it failed to import.
+type ScanReport struct {
+	Path      string         `json:"path"`
+	Added     int            `json:"added"`
+	Updated   int            `json:"updated"`
+	Unchanged int            `json:"unchanged"`
+	Moved     int            `json:"moved"`
+	Deleted   int            `json:"deleted"`
+	Failures  []*ScanFailure `json:"failures,omitempty"`
+
+	// Number of resources pruned because they no longer have any files.
+	AlbumsPruned  int64 `json:"albumsPruned"`
+	ArtistsPruned int64 `json:"artistsPruned"`
+	GenresPruned  int64 `json:"genresPruned"`
+}
+
+// songFile represents the properties of the file a song was read from.
+type songFile struct {
+	id          string
+	path        string
+	size        int64
+	modTime     int64
+	fingerprint string
+	root        string
+	rootPath    string
+}
+
+// ScanOptions configures how a scan reads and records files.
+type ScanOptions struct {
+	// Workers is the number of files whose metadata is read concurrently.
+	// Defaults to the number of CPUs.
+	Workers int
+
+	// BatchSize is the number of files the writer records at a time.
+	// Defaults to 64.
+	BatchSize int
+
+	// Progress, if set, is called from the writer after each batch of files
+	// is recorded and once more when the scan ends.
+	Progress func(ScanProgress)
+
+	// Extensions lists the extensions of the audio files to scan. Defaults
+	// to DefaultExtensions.
+	Extensions []string
+
+	// Exclude lists glob patterns of files and directories to leave out of
+	// the scan, matched against both their names and their paths relative to
+	// the library root the scanned path lies within. Patterns may also be
+	// listed in an IgnoreFile in any directory.
+	Exclude []string
+
+	// IncludeHidden includes files and directories whose names start with a
+	// dot, which are otherwise left out.
+	IncludeHidden bool
+
+	// MaxDepth limits how many directory levels beneath the library root the
+	// scan descends, so that 1 scans only the files directly within the root,
+	// whichever path within it is scanned. Zero means no limit.
+	MaxDepth int
+
+	// FollowSymlinks follows symbolic links to files and directories. Each
+	// directory is scanned at most once, so links cannot cause loops.
+	FollowSymlinks bool
+
+	// ImportRatings gives songs that have not been rated the rating read from
+	// the POPM or FMPS rating tags of their files. FMPS ratings must contain
+	// a decimal point, as values without one are read as POPM ratings.
+	ImportRatings bool
+}
+
+// ScanProgress reports how far a scan has progressed.
+type ScanProgress struct {
+	Path          string `json:"path"`
+	FilesSeen     int    `json:"filesSeen"`
+	FilesImported int    `json:"filesImported"`
+	FilesSkipped  int    `json:"filesSkipped"`
+	Errors        int    `json:"errors"`
+}
+
+// withDefaults returns a copy of the options with unset values defaulted.
+func (opts *ScanOptions) withDefaults() ScanOptions {
+	var o ScanOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Workers < 1 {
+		o.Workers = runtime.NumCPU()
+	}
+	if o.BatchSize < 1 {
+		o.BatchSize = 64
+	}
+	if len(o.Extensions) == 0 {
+		o.Extensions = DefaultExtensions
+	}
+	return o
+}
+
+// scanJob represents a file found by the walk of a scan.
+type scanJob struct {
+	seq   int
+	path  string
+	info  os.FileInfo
+	known *songFile
+	err   error
+}
+
+// scanResult represents the outcome of reading a file found by a scan.
+type scanResult struct {
+	*scanJob
+	file    *songFile
+	changed bool
+	stage   ScanStage
+	genre   library.GenreAttributes
+	artist  library.ArtistAttributes
+	album   library.AlbumAttributes
+	song    library.SongAttributes
+	rating  float64
+}
+
+// scanner applies the files found beneath a path to the library within the
+// current session transaction. File metadata is read by a pool of workers and
+// recorded by a single writer in the order the files were walked, so the
+// library ends up the same as if the files had been read one at a time.
+type scanner struct {
+	ctx        context.Context
+	session    *Session
+	root       string
+	opts       ScanOptions
+	walker     *walker
+	known      map[string]*songFile
+	moved      map[string]bool
+	unreadable []string
+	report     *ScanReport
+}
+
+// newScanner returns a new instance of a scanner for the given path within the
+// library root with the given ID, loaded with the songs already recorded
+// beneath the path. The ignore files of the directories from the root down to
+// the path apply to the scan.
+func newScanner(ctx context.Context, s *Session, path string, rootID string, opts *ScanOptions) (*scanner, error) {
+	o := opts.withDefaults()
+	base := path
+	if len(rootID) > 0 {
+		root, err := s.RootService.Root(rootID)
+		if err != nil {
+			return nil, err
+		}
+		if root != nil {
+			base = root.Attributes.Path
+		}
+	}
+	w, err := newWalker(path, base, &o)
+	if err != nil {
+		return nil, err
+	}
+
+	known, err := s.songService.files(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &scanner{
+		ctx:     ctx,
+		session: s,
+		root:    rootID,
+		opts:    o,
+		walker:  w,
+		known:   known,
+		moved:   make(map[string]bool),
+		report:  &ScanReport{Path: path}}
+	return sc, nil
+}
+
+// scan scans the given path, which lies within the library root with the given
+// ID, in a transaction of its own. If the ID is empty, the path is added as a
+// library root within the transaction. If the scan fails or its context is
+// cancelled, every change it made is rolled back and no report is returned.
+func (s *Session) scan(ctx context.Context, path string, rootID string, opts *ScanOptions) (*ScanReport, error) {
+	s = s.bind(ctx)
+	err := s.BeginTx()
+	if err != nil {
+		s.Logger.Println(err)
+		return nil, err
+	}
+
+	// Scans import the ratings of songs for the acting user.
+	err = s.checkUser()
+	if err != nil {
+		s.RollbackTx()
+		return nil, err
+	}
+
+	if len(rootID) == 0 {
+		root, err := s.RootService.Add(path)
+		if err != nil {
+			s.RollbackTx()
+			return nil, err
+		}
+		rootID = root.ID
+	}
+
+	sc, err := newScanner(ctx, s, path, rootID, opts)
+	if err != nil {
+		s.RollbackTx()
+		return nil, err
+	}
+
+	err = sc.scan()
+	if err == nil {
+		err = s.RootService.scanned(rootID)
+	}
+	if err != nil {
+		s.Logger.Println(err)
+		s.RollbackTx()
+		return nil, err
+	}
+
+	err = s.CommitTx()
+	if err != nil {
+		s.Logger.Println(err)
+		return nil, err
+	}
+	return sc.report, nil
+}
+
+// scan walks the path of the scanner, applying every file found to the library,
+// and then removes the songs whose files no longer exist. If the context of the
+// scanner is cancelled, the scan stops and returns the context error.
+func (sc *scanner) scan() error {
+	jobs := make(chan *scanJob, sc.opts.Workers)
+	results := make(chan *scanResult, sc.opts.Workers)
+
+	walkErr := make(chan error, 1)
+	go func() {
+		walkErr <- sc.walk(jobs)
+		close(jobs)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < sc.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ms := metadata.Service{}
+			for job := range jobs {
+				results <- sc.read(&ms, job)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	sc.write(results)
+	defer sc.progress()
+
+	err := <-walkErr
+	if err != nil {
+		return err
+	}
+	err = sc.ctx.Err()
+	if err != nil {
+		return err
+	}
+	return sc.finish()
+}
+
+// walk sends a job for every audio file beneath the path of the scanner.
+func (sc *scanner) walk(jobs chan<- *scanJob) error {
+	seq := 0
+	return sc.walker.walk(func(path string, f os.FileInfo, err error) error {
+		if ctxErr := sc.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err == nil && f.IsDir() {
+			return nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			sc.unreadable = append(sc.unreadable, path)
+		}
+
+		known := sc.known[path]
+		delete(sc.known, path)
+
+		jobs <- &scanJob{seq: seq, path: path, info: f, known: known, err: err}
+		seq++
+		return nil
+	})
+}
+
+// read determines whether the file of the given job has changed since the last
+// scan and, if so, reads its metadata.
+func (sc *scanner) read(ms *metadata.Service, job *scanJob) *scanResult {
+	res := &scanResult{scanJob: job, stage: StageMetadata}
+	if job.err != nil {
+		res.stage = StageWalk
+		return res
+	}
+	if err := sc.ctx.Err(); err != nil {
+		res.err = err
+		return res
+	}
+
+	res.file = &songFile{
+		path:    job.path,
+		size:    job.info.Size(),
+		modTime: job.info.ModTime().UnixNano(),
+		root:    sc.root}
+	if job.known != nil && job.known.size == res.file.size && job.known.modTime == res.file.modTime {
+		return res
+	}
+
+	res.file.fingerprint, res.err = fingerprint(job.path, res.file.size)
+	if res.err != nil {
+		return res
+	}
+	if job.known != nil && job.known.fingerprint == res.file.fingerprint {
+		return res
+	}
+
+	metadata, err := readMetadata(ms, job.path)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	res.changed = true
+
+	res.genre = library.GenreAttributes{
+		Name: metadata.Genre}
+
+	res.artist = library.ArtistAttributes{
+		Name: metadata.Artist,
+		Sort: metadata.ArtistSort}
+
+	res.album = library.AlbumAttributes{
+		Name:        metadata.Album,
+		Sort:        metadata.AlbumSort,
+		ArtistName:  metadata.Artist,
+		ArtistSort:  metadata.ArtistSort,
+		GenreName:   metadata.Genre,
+		ReleaseDate: metadata.Year}
+
+	res.song = library.SongAttributes{
+		FilePath:         job.path,
+		FileBase:         filepath.Base(job.path),
+		FileDir:          filepath.Dir(job.path),
+		ArtistName:       metadata.Artist,
+		ArtistSort:       metadata.ArtistSort,
+		Name:             metadata.Title,
+		Sort:             metadata.TitleSort,
+		GenreName:        metadata.Genre,
+		TrackNumber:      metadata.Track,
+		TrackTotal:       metadata.TrackTotal,
+		DiscNumber:       metadata.Disc,
+		DiscTotal:        metadata.DiscTotal,
+		DurationInMillis: int(metadata.Duration / time.Millisecond),
+		Composer:         metadata.Composer,
+		ComposerSort:     metadata.ComposerSort,
+		Conductor:        metadata.Conductor,
+		ReleaseDate:      metadata.Year,
+		Lyrics:           metadata.Lyrics,
+		Comments:         metadata.Comment}
+
+	if sc.opts.ImportRatings {
+		res.rating, _ = parseRating(metadata.Rating)
+	}
+	return res
+}
+
+// write records the results read by the workers in batches, in the order their
+// files were walked. Once the context of the scanner is cancelled, remaining
+// results are discarded.
+func (sc *scanner) write(results <-chan *scanResult) {
+	pending := make(map[int]*scanResult)
+	batch := make([]*scanResult, 0, sc.opts.BatchSize)
+	next := 0
+
+	for res := range results {
+		if sc.ctx.Err() != nil {
+			continue
+		}
+
+		pending[res.seq] = res
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			batch = append(batch, r)
+			if len(batch) == sc.opts.BatchSize {
+				sc.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+	if sc.ctx.Err() == nil {
+		sc.flush(batch)
+	}
+}
+
+// flush records a batch of results in the library.
+func (sc *scanner) flush(batch []*scanResult) {
+	for _, res := range batch {
+		stage, err := sc.apply(res)
+		if err != nil {
+			f := &ScanFailure{Path: res.path, Stage: stage, Err: err}
+			sc.session.Logger.Println(f)
+			sc.report.Failures = append(sc.report.Failures, f)
+		}
+	}
+	sc.progress()
+}
+
+// progress reports the progress of the scan to the progress callback, if any.
+func (sc *scanner) progress() {
+	if sc.opts.Progress == nil {
+		return
+	}
+
+	r := sc.report
+	sc.opts.Progress(ScanProgress{
+		Path:          r.Path,
+		FilesSeen:     r.Added + r.Updated + r.Unchanged + r.Moved + len(r.Failures),
+		FilesImported: r.Added + r.Updated + r.Moved,
+		FilesSkipped:  r.Unchanged,
+		Errors:        len(r.Failures)})
+}
+
+// apply adds the file of the given result to the library if it is new, moves
+// the song of a missing file with the same content to it if there is one,
+// updates its song if the file has changed since the last scan, and otherwise
+// leaves the library untouched. If the file fails, apply returns the stage it failed
+// in along with the error.
+func (sc *scanner) apply(res *scanResult) (ScanStage, error) {
+	if res.err != nil {
+		return res.stage, res.err
+	}
+
+	if !res.changed {
+		sc.report.Unchanged++
+		if res.file.fingerprint == "" {
+			return "", nil
+		}
+		return StageSong, sc.session.songService.updateFile(res.known.id, res.file)
+	}
+
+	if res.known == nil {
+		moved, err := sc.move(res.file)
+		if err != nil {
+			return StageSong, err
+		}
+		if moved {
+			sc.report.Moved++
+			return "", nil
+		}
+	}
+
+	err := sc.session.genreService.CreateGenre(&res.genre)
+	if err != nil {
+		return StageGenre, err
+	}
+	resolved, err := sc.session.ArtistAliasService.Resolve(&res.artist)
+	if err != nil {
+		return StageArtist, err
+	}
+	if resolved {
+		res.album.ArtistName, res.album.ArtistSort = res.artist.Name, res.artist.Sort
+		res.song.ArtistName, res.song.ArtistSort = res.artist.Name, res.artist.Sort
+	}
+
+	err = sc.session.artistService.CreateArtist(&res.artist)
+	if err != nil {
+		return StageArtist, err
+	}
+	err = sc.session.albumService.CreateAlbum(&res.album)
+	if err != nil {
+		return StageAlbum, err
+	}
+
+	if res.known != nil {
+		err = sc.session.songService.updateSong(res.known.id, &res.song, res.file)
+		if err != nil {
+			return StageSong, err
+		}
+		err = sc.session.SongDiscogService.deleteSongDiscogs(res.known.id)
+		if err != nil {
+			return StageDiscography, err
+		}
+		sc.report.Updated++
+	} else {
+		err = sc.session.songService.createSong(&res.song, res.file)
+		if err != nil {
+			return StageSong, err
+		}
+		sc.report.Added++
+	}
+
+	err = sc.session.AlbumDiscogService.CreateAlbumDiscog(&res.album)
+	if err != nil {
+		return StageDiscography, err
+	}
+	err = sc.session.SongDiscogService.CreateSongDiscog(&res.song, &res.album)
+	if err != nil {
+		return StageDiscography, err
+	}
+
+	if res.rating > 0 {
+		err = sc.session.ratingService.importRating(res.song.FilePath, res.rating)
+		if err != nil {
+			return StageSong, err
+		}
+	}
+	return "", nil
+}
+
+// move looks for a song whose file has the same content as the given file but
+// no longer exists and, if there is one, moves the song to the given file so
+// that it keeps its ID. Songs of library roots that are missing, such as
+// unmounted drives, are left alone, since their files may only be out of
+// reach. move reports whether a song was moved.
+func (sc *scanner) move(sf *songFile) (bool, error) {
+	candidates, err := sc.session.songService.filesByFingerprint(sf.fingerprint)
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range candidates {
+		if c.path == sf.path {
+			continue
+		}
+		_, err := os.Lstat(c.path)
+		if !os.IsNotExist(err) {
+			continue
+		}
+		if len(c.rootPath) > 0 {
+			_, err := os.Stat(c.rootPath)
+			if err != nil {
+				continue
+			}
+		}
+
+		err = sc.session.songService.moveSong(c.id, sf)
+		if err != nil {
+			return false, err
+		}
+		sc.moved[c.path] = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// finish deletes the songs whose files were not found by the scan and prunes
+// the albums, artists and genres left without any files. Songs beneath paths
+// the scan failed to read, such as directories it lacks permission to list,
+// are kept, since their files may still exist.
+func (sc *scanner) finish() error {
+	for _, sf := range sc.known {
+		if sc.moved[sf.path] || sc.unread(sf.path) {
+			continue
+		}
+
+		err := sc.session.songService.deleteSong(sf.id)
+		if err != nil {
+			return err
+		}
+		sc.report.Deleted++
+	}
+	sc.known = nil
+
+	return sc.session.prune(sc.report)
+}
+
+// unread reports whether the given path lies at or beneath a path that the scan
+// failed to read.
+func (sc *scanner) unread(path string) bool {
+	for _, dir := range sc.unreadable {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// fingerprint returns a fingerprint of the content of the file at the given
+// path, computed from its size and the data at either end of the file.
+func fingerprint(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%d:", size)
+
+	if size <= 2*fingerprintSize {
+		_, err = io.Copy(h, f)
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	_, err = io.CopyN(h, f, fingerprintSize)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Seek(-fingerprintSize, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.CopyN(h, f, fingerprintSize)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,343 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// TestParallelScanMatchesSerial checks that a scan that reads files with many
+// workers and records them in small batches leaves the library the same as a
+// scan that reads them one at a time.
+func TestParallelScanMatchesSerial(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 40; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("artist%d", i%5), fmt.Sprintf("album%d", i%7), fmt.Sprintf("%02d.mp3", i))
+		writeTestFile(t, path,
+			"title", fmt.Sprintf("Song %d", i),
+			"artist", fmt.Sprintf("Artist %d", i%5),
+			"album", fmt.Sprintf("Album %d", i%7),
+			"genre", fmt.Sprintf("Genre %d", i%3),
+			"year", fmt.Sprintf("%d", 1990+i%4),
+			"track", fmt.Sprintf("%d", i%12+1))
+	}
+	writeTestFile(t, filepath.Join(dir, "notes.txt"))
+
+	var dumps []map[string][]string
+	for _, opts := range []*ScanOptions{
+		{Workers: 1, BatchSize: 1},
+		{Workers: 8, BatchSize: 3},
+	} {
+		ls := openTestService(t)
+		report, err := ls.Scan(dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Added != 40 || len(report.Failures) > 0 {
+			t.Fatalf("scan with %d workers added %d songs with failures %v, want 40", opts.Workers, report.Added, report.Failures)
+		}
+		dumps = append(dumps, dumpLibrary(t, ls))
+	}
+
+	if len(dumps[0]["songs"]) != 40 || len(dumps[0]["albums"]) == 0 {
+		t.Fatalf("serial scan recorded %d songs and %d albums", len(dumps[0]["songs"]), len(dumps[0]["albums"]))
+	}
+	if !reflect.DeepEqual(dumps[0], dumps[1]) {
+		for table := range dumps[0] {
+			if !reflect.DeepEqual(dumps[0][table], dumps[1][table]) {
+				t.Errorf("table %s differs:\nserial:   %v\nparallel: %v", table, dumps[0][table], dumps[1][table])
+			}
+		}
+	}
+}
+
+// TestCancelledScan checks that a cancelled scan rolls back every change it
+// made, including adding its path as a library root.
+func TestCancelledScan(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 10; i++ {
+		writeTestFile(t, filepath.Join(dir, fmt.Sprintf("%d.mp3", i)), "title", fmt.Sprintf("Song %d", i))
+	}
+
+	ls := openTestService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	report, err := ls.ScanContext(ctx, dir, &ScanOptions{
+		Workers:   1,
+		BatchSize: 1,
+		Progress:  func(ScanProgress) { cancel() }})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ScanContext returned %v, want context.Canceled", err)
+	}
+	if report != nil {
+		t.Errorf("ScanContext reported %+v for a scan that was rolled back", report)
+	}
+
+	for table, want := range map[string]int{"songs": 0, "library_roots": 0} {
+		var n int
+		err := ls.Session.db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n)
+		if err != nil || n != want {
+			t.Errorf("table %s has %d rows (%v), want %d", table, n, err, want)
+		}
+	}
+}
+
+// TestScanLeavesSongsOfMissingRoots checks that a copy of a file of a library
+// root that is missing, such as an unmounted drive, is added as a new song
+// rather than taking over the song of the missing root.
+func TestScanLeavesSongsOfMissingRoots(t *testing.T) {
+	dir := t.TempDir()
+	nas, local := filepath.Join(dir, "nas"), filepath.Join(dir, "local")
+	writeTestFile(t, filepath.Join(nas, "1.mp3"), "title", "One")
+	writeTestFile(t, filepath.Join(nas, "2.mp3"), "title", "Two")
+	writeTestFile(t, filepath.Join(local, "3.mp3"), "title", "Three")
+
+	ls := openTestService(t)
+	for _, path := range []string{nas, local} {
+		_, err := ls.Scan(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A file moved between roots that are both present keeps its song.
+	err := os.Rename(filepath.Join(nas, "2.mp3"), filepath.Join(local, "2.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := ls.Scan(local, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Moved != 1 {
+		t.Fatalf("scan moved %d songs, want 1", report.Moved)
+	}
+
+	err = os.Rename(nas, nas+".unmounted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(local, "1.mp3"), "title", "One")
+	report, err = ls.Scan(local, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 1 || report.Moved != 0 {
+		t.Fatalf("scan added %d and moved %d songs, want 1 and 0", report.Added, report.Moved)
+	}
+
+	songs, err := ls.Session.SongService().Songs(map[string]string{"filter[filePath]": filepath.Join(nas, "1.mp3")})
+	if err != nil || len(songs) != 1 {
+		t.Fatalf("Songs found %d songs of the missing root (%v), want 1", len(songs), err)
+	}
+}
+
+// TestScanKeepsSongsOfUnreadableDirectories checks that a rescan that cannot
+// read a directory reports it and keeps the songs beneath it.
+func TestScanKeepsSongsOfUnreadableDirectories(t *testing.T) {
+	dir := t.TempDir()
+	locked := filepath.Join(dir, "locked")
+	writeTestFile(t, filepath.Join(dir, "1.mp3"), "title", "One")
+	writeTestFile(t, filepath.Join(locked, "2.mp3"), "title", "Two")
+	writeTestFile(t, filepath.Join(locked, "deep", "3.mp3"), "title", "Three")
+
+	ls := openTestService(t)
+	_, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chmod(locked, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+	if _, err := os.ReadDir(locked); err == nil {
+		t.Skip("directory permissions are not enforced for this user")
+	}
+
+	report, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := false
+	for _, f := range report.Failures {
+		failed = failed || f.Path == locked && f.Stage == StageWalk
+	}
+	if report.Deleted != 0 || !failed {
+		t.Fatalf("rescan deleted %d songs with failures %v, want none deleted and a walk failure of %s", report.Deleted, report.Failures, locked)
+	}
+
+	songs, err := ls.Session.SongService().Songs(map[string]string{})
+	if err != nil || len(songs) != 3 {
+		t.Fatalf("Songs found %d songs after the rescan (%v), want 3", len(songs), err)
+	}
+}
+
+// TestIncrementalRescan checks that a rescan skips unchanged files, updates
+// changed ones in place and deletes the songs of removed files along with the
+// albums, artists and genres left without files.
+func TestIncrementalRescan(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "1.mp3"), "title", "One", "artist", "Ann", "album", "First", "genre", "Rock")
+	writeTestFile(t, filepath.Join(dir, "2.mp3"), "title", "Two", "artist", "Ann", "album", "First", "genre", "Rock")
+	writeTestFile(t, filepath.Join(dir, "3.mp3"), "title", "Three", "artist", "Bob", "album", "Second", "genre", "Jazz")
+
+	ls := openTestService(t)
+	report, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 3 {
+		t.Fatalf("first scan added %d songs, want 3", report.Added)
+	}
+	songs, err := ls.Session.SongService().Songs(map[string]string{"filter[filePath]": filepath.Join(dir, "2.mp3")})
+	if err != nil || len(songs) != 1 {
+		t.Fatalf("Songs found %d songs (%v), want 1", len(songs), err)
+	}
+	ID := songs[0].ID
+
+	report, err = ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Unchanged != 3 || report.Added+report.Updated+report.Deleted != 0 {
+		t.Fatalf("rescan of unchanged files reported %+v, want 3 unchanged", report)
+	}
+
+	// A file touched without changing its content is left alone.
+	later := time.Now().Add(time.Hour)
+	err = os.Chtimes(filepath.Join(dir, "1.mp3"), later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "2.mp3"), "title", "Two (Remastered)", "artist", "Ann", "album", "First", "genre", "Rock")
+	err = os.Remove(filepath.Join(dir, "3.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ScanReport{Path: dir, Updated: 1, Unchanged: 1, Deleted: 1, AlbumsPruned: 1, ArtistsPruned: 1, GenresPruned: 1}
+	if !reflect.DeepEqual(*report, want) {
+		t.Fatalf("rescan reported %+v, want %+v", *report, want)
+	}
+
+	s, err := ls.Session.SongService().Song(ID)
+	if err != nil || s == nil || s.Attributes.Name != "Two (Remastered)" {
+		t.Fatalf("Song(%s) returned %+v (%v), want the updated song", ID, s, err)
+	}
+	dump := dumpLibrary(t, ls)
+	for table, want := range map[string]int{"songs": 2, "albums": 1, "artists": 1, "genres": 1} {
+		if len(dump[table]) != want {
+			t.Errorf("table %s has %d rows, want %d", table, len(dump[table]), want)
+		}
+	}
+}
+
+// TestScanReportsFailureStages checks that a scan imports the files it can and
+// reports every other file along with the stage it failed in.
+func TestScanReportsFailureStages(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "ok.mp3"), "title", "Fine", "artist", "Ann", "album", "First", "genre", "Rock")
+	writeTestFile(t, filepath.Join(dir, "metadata.mp3"), "error", "bad frame")
+	writeTestFile(t, filepath.Join(dir, "genre.mp3"), "title", "A", "genre", "Broken")
+	writeTestFile(t, filepath.Join(dir, "artist.mp3"), "title", "B", "artist", "Broken")
+	writeTestFile(t, filepath.Join(dir, "album.mp3"), "title", "C", "artist", "Ann", "album", "Broken")
+	writeTestFile(t, filepath.Join(dir, "song.mp3"), "title", "Broken", "artist", "Ann")
+	writeTestFile(t, filepath.Join(dir, "discography.mp3"), "title", "Discography", "artist", "Ann")
+	err := os.MkdirAll(filepath.Join(dir, "sub", IgnoreFile), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ls := openTestService(t)
+	for _, trigger := range []string{
+		`CREATE TRIGGER fail_genre BEFORE INSERT ON genres WHEN NEW.genre_name = 'Broken'
+		 BEGIN SELECT RAISE(ABORT, 'broken genre'); END`,
+		`CREATE TRIGGER fail_artist BEFORE INSERT ON artists WHEN NEW.artist_name = 'Broken'
+		 BEGIN SELECT RAISE(ABORT, 'broken artist'); END`,
+		`CREATE TRIGGER fail_album BEFORE INSERT ON albums WHEN NEW.album_name = 'Broken'
+		 BEGIN SELECT RAISE(ABORT, 'broken album'); END`,
+		`CREATE TRIGGER fail_song BEFORE INSERT ON songs WHEN NEW.song_name = 'Broken'
+		 BEGIN SELECT RAISE(ABORT, 'broken song'); END`,
+		`CREATE TRIGGER fail_discography BEFORE INSERT ON song_discographies
+		 WHEN (SELECT song_name FROM songs WHERE song_id = NEW.song_id) = 'Discography'
+		 BEGIN SELECT RAISE(ABORT, 'broken discography'); END`,
+	} {
+		_, err := ls.Session.db.Exec(trigger)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stages := make(map[string]ScanStage)
+	for _, f := range report.Failures {
+		if f.Err == nil {
+			t.Errorf("failure of %s has no error", f.Path)
+		}
+		stages[f.Path] = f.Stage
+	}
+	want := map[string]ScanStage{
+		filepath.Join(dir, "metadata.mp3"):    StageMetadata,
+		filepath.Join(dir, "genre.mp3"):       StageGenre,
+		filepath.Join(dir, "artist.mp3"):      StageArtist,
+		filepath.Join(dir, "album.mp3"):       StageAlbum,
+		filepath.Join(dir, "song.mp3"):        StageSong,
+		filepath.Join(dir, "discography.mp3"): StageDiscography,
+		filepath.Join(dir, "sub", IgnoreFile): StageWalk,
+	}
+	if !reflect.DeepEqual(stages, want) {
+		t.Errorf("scan failed with stages %v, want %v", stages, want)
+	}
+	if report.Added != 2 {
+		t.Errorf("scan added %d songs, want the song that failed its discography and the fine one", report.Added)
+	}
+}
+
+// TestScanOptionsApplyFromRoot checks that exclude patterns and the maximum
+// depth are measured from the library root when a path within it is scanned,
+// so that the scan finds what a scan of the whole root finds beneath the path.
+func TestScanOptionsApplyFromRoot(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"1.mp3", "a/2.mp3", "a/b/3.mp3", "live/4.mp3", "a/live/5.mp3"} {
+		writeTestFile(t, filepath.Join(dir, filepath.FromSlash(name)), "title", name)
+	}
+	opts := &ScanOptions{Exclude: []string{"a/live"}, MaxDepth: 2}
+	want := []string{"1.mp3", "a/2.mp3", "live/4.mp3"}
+
+	ls := openTestService(t)
+	for _, path := range []string{"", "a", "a/b", "a/b/3.mp3", "a/live", "a/live/5.mp3"} {
+		_, err := ls.Scan(filepath.Join(dir, filepath.FromSlash(path)), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		songs, err := ls.Session.SongService().Songs(map[string]string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, s := range songs {
+			names = append(names, s.Attributes.Name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("after a scan of %q the library holds %v, want %v", path, names, want)
+		}
+	}
+}
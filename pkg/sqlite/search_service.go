@@ -0,0 +1,336 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// SearchService manages interactions with the full-text search index. The
+// index is made of an FTS5 table for each type of resource, whose rowids are
+// the IDs of the resources, and is kept in sync with the library by triggers.
+// The index is only kept while SQLite is built with FTS5; otherwise, the
+// library works without it and searches fail with ErrSearchUnavailable.
+type SearchService struct {
+	session *Session
+}
+
+// NewSearchService returns a new instance of a SearchService that operates
+// within the given session.
+func NewSearchService(s *Session) SearchService {
+	service := SearchService{session: s}
+	return service
+}
+
+// searchTokenizer folds case and diacritics so that "beyonce" matches
+// "Beyoncé", and searchPrefix indexes short prefixes for prefix queries.
+const (
+	searchTokenizer = `tokenize = "unicode61 remove_diacritics 2"`
+	searchPrefix    = `prefix = '2 3'`
+)
+
+// Each of these select the rows of an index table for the resources that meet
+// the condition appended to them.
+const (
+	artistSearchRows = `
+		SELECT artist_id,
+		       IFNULL(artist_name, '')
+		  FROM artists
+		 WHERE `
+	albumSearchRows = `
+		SELECT albums.album_id,
+		       IFNULL(albums.album_name, ''),
+		       IFNULL(artists.artist_name, '')
+		  FROM albums
+		       LEFT JOIN artists ON albums.artist_id = artists.artist_id
+		 WHERE `
+	songSearchRows = `
+		SELECT songs.song_id,
+		       IFNULL(songs.song_name, ''),
+		       IFNULL(artists.artist_name, ''),
+		       IFNULL((SELECT albums.album_name
+		                 FROM song_discographies AS sd
+		                      INNER JOIN albums ON sd.album_id = albums.album_id
+		                WHERE sd.song_id = songs.song_id), ''),
+		       IFNULL(songs.lyrics, '')
+		  FROM songs
+		       LEFT JOIN artists ON songs.artist_id = artists.artist_id
+		 WHERE `
+)
+
+// searchTriggers lists the triggers that keep the index in sync, by name and
+// by the event and statements of each.
+var searchTriggers = [][3]string{
+	{"artists_search_insert", `AFTER INSERT ON artists`, `
+		INSERT INTO artist_search (rowid, name)` + artistSearchRows + `artist_id = NEW.artist_id;`},
+	{"artists_search_update", `AFTER UPDATE OF artist_name ON artists`, `
+		DELETE FROM artist_search WHERE rowid = OLD.artist_id;
+		INSERT INTO artist_search (rowid, name)` + artistSearchRows + `artist_id = NEW.artist_id;
+		DELETE FROM album_search WHERE rowid IN (SELECT album_id FROM albums WHERE artist_id = NEW.artist_id);
+		INSERT INTO album_search (rowid, name, artist)` + albumSearchRows + `albums.artist_id = NEW.artist_id;
+		DELETE FROM song_search WHERE rowid IN (SELECT song_id FROM songs WHERE artist_id = NEW.artist_id);
+		INSERT INTO song_search (rowid, name, artist, album, lyrics)` + songSearchRows + `songs.artist_id = NEW.artist_id;`},
+	{"artists_search_delete", `AFTER DELETE ON artists`, `
+		DELETE FROM artist_search WHERE rowid = OLD.artist_id;`},
+	{"albums_search_insert", `AFTER INSERT ON albums`, `
+		INSERT INTO album_search (rowid, name, artist)` + albumSearchRows + `albums.album_id = NEW.album_id;`},
+	{"albums_search_update", `AFTER UPDATE OF album_name, artist_id ON albums`, `
+		DELETE FROM album_search WHERE rowid = OLD.album_id;
+		INSERT INTO album_search (rowid, name, artist)` + albumSearchRows + `albums.album_id = NEW.album_id;
+		DELETE FROM song_search WHERE rowid IN (SELECT song_id FROM song_discographies WHERE album_id = NEW.album_id);
+		INSERT INTO song_search (rowid, name, artist, album, lyrics)` + songSearchRows + `songs.song_id IN (SELECT song_id FROM song_discographies WHERE album_id = NEW.album_id);`},
+	{"albums_search_delete", `AFTER DELETE ON albums`, `
+		DELETE FROM album_search WHERE rowid = OLD.album_id;`},
+	{"songs_search_insert", `AFTER INSERT ON songs`, `
+		INSERT INTO song_search (rowid, name, artist, album, lyrics)` + songSearchRows + `songs.song_id = NEW.song_id;`},
+	{"songs_search_update", `AFTER UPDATE OF song_name, artist_id, lyrics ON songs`, `
+		DELETE FROM song_search WHERE rowid = OLD.song_id;
+		INSERT INTO song_search (rowid, name, artist, album, lyrics)` + songSearchRows + `songs.song_id = NEW.song_id;`},
+	{"songs_search_delete", `AFTER DELETE ON songs`, `
+		DELETE FROM song_search WHERE rowid = OLD.song_id;`},
+	{"song_discographies_search_insert", `AFTER INSERT ON song_discographies`, `
+		DELETE FROM song_search WHERE rowid = NEW.song_id;
+		INSERT INTO song_search (rowid, name, artist, album, lyrics)` + songSearchRows + `songs.song_id = NEW.song_id;`},
+	{"song_discographies_search_update", `AFTER UPDATE ON song_discographies`, `
+		DELETE FROM song_search WHERE rowid IN (OLD.song_id, NEW.song_id);
+		INSERT INTO song_search (rowid, name, artist, album, lyrics)` + songSearchRows + `songs.song_id IN (OLD.song_id, NEW.song_id);`},
+	{"song_discographies_search_delete", `AFTER DELETE ON song_discographies`, `
+		DELETE FROM song_search WHERE rowid = OLD.song_id;
+		INSERT INTO song_search (rowid, name, artist, album, lyrics)` + songSearchRows + `songs.song_id = OLD.song_id;`},
+}
+
+// CreateTable creates the 'artist_search', 'album_search' and 'song_search'
+// tables along with the triggers that keep them in sync, and returns any
+// errors. The tables require SQLite to be built with FTS5.
+func (service *SearchService) CreateTable() (sql.Result, error) {
+	creates := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS artist_search USING fts5 (name, ` + searchTokenizer + `, ` + searchPrefix + `)`,
+		`CREATE VIRTUAL TABLE IF NOT EXISTS album_search USING fts5 (name, artist, ` + searchTokenizer + `, ` + searchPrefix + `)`,
+		`CREATE VIRTUAL TABLE IF NOT EXISTS song_search USING fts5 (name, artist, album, lyrics, ` + searchTokenizer + `, ` + searchPrefix + `)`,
+	}
+	for _, t := range searchTriggers {
+		creates = append(creates, fmt.Sprintf(
+			`CREATE TRIGGER IF NOT EXISTS %s %s BEGIN %s
+			 END`, t[0], t[1], t[2]))
+	}
+
+	var result sql.Result
+	for _, create := range creates {
+		var err error
+		result, err = service.session.tx.Exec(create)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// DropTable drops the search tables and their triggers and returns any errors.
+// Without FTS5, only the triggers can be dropped.
+func (service *SearchService) DropTable() (sql.Result, error) {
+	available, err := service.available()
+	if err != nil {
+		return nil, err
+	}
+
+	var drops []string
+	for _, t := range searchTriggers {
+		drops = append(drops, `DROP TRIGGER IF EXISTS `+t[0])
+	}
+	if available {
+		drops = append(drops,
+			`DROP TABLE IF EXISTS artist_search`,
+			`DROP TABLE IF EXISTS album_search`,
+			`DROP TABLE IF EXISTS song_search`)
+	}
+
+	var result sql.Result
+	for _, drop := range drops {
+		var err error
+		result, err = service.session.tx.Exec(drop)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// available reports whether SQLite is built with FTS5, which the search index
+// requires.
+func (service *SearchService) available() (bool, error) {
+	var available bool
+	err := service.session.conn().QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&available)
+	return available, err
+}
+
+// maintained reports whether the triggers that keep the index in sync exist.
+func (service *SearchService) maintained() (bool, error) {
+	var n int
+	query := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?`
+	err := service.session.conn().QueryRow(query, searchTriggers[0][0]).Scan(&n)
+	return n > 0, err
+}
+
+// update keeps the search index when SQLite is built with FTS5, creating and
+// rebuilding it if it is not being maintained, such as when the library was
+// last opened by a build without FTS5. Otherwise, update drops the triggers of
+// the index, which could not fire without FTS5, so that the library can still
+// be changed.
+func (service *SearchService) update() error {
+	available, err := service.available()
+	if err != nil {
+		return err
+	}
+	maintained, err := service.maintained()
+	if err != nil || available == maintained {
+		return err
+	}
+
+	return service.session.inTx(func() error {
+		if !available {
+			for _, t := range searchTriggers {
+				_, err := service.session.tx.Exec(`DROP TRIGGER IF EXISTS ` + t[0])
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		_, err := service.CreateTable()
+		if err != nil {
+			return err
+		}
+		return service.reindex()
+	})
+}
+
+// reindex rebuilds the search tables from the library.
+func (service *SearchService) reindex() error {
+	reindexes := []string{
+		`DELETE FROM artist_search`,
+		`INSERT INTO artist_search (rowid, name)` + artistSearchRows + `1`,
+		`DELETE FROM album_search`,
+		`INSERT INTO album_search (rowid, name, artist)` + albumSearchRows + `1`,
+		`DELETE FROM song_search`,
+		`INSERT INTO song_search (rowid, name, artist, album, lyrics)` + songSearchRows + `1`,
+	}
+	for _, reindex := range reindexes {
+		_, err := service.session.tx.Exec(reindex)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchTables lists the index tables searched for each type of resource, by
+// resource type, table and the bm25 weights of its columns. Names weigh more
+// than the artists and albums they belong to, which weigh more than lyrics.
+var searchTables = [][3]string{
+	{"artists", "artist_search", "1.0"},
+	{"albums", "album_search", "10.0, 2.0"},
+	{"songs", "song_search", "10.0, 2.0, 2.0, 1.0"},
+}
+
+// Search queries the search tables for the artists, albums and songs that match
+// the given query and returns them along with any error.
+func (service *SearchService) Search(query string, limit int) (*library.SearchResults, error) {
+	results := &library.SearchResults{}
+
+	available, err := service.available()
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, err
+	}
+	if !available {
+		return results, fmt.Errorf("%w: SQLite is built without FTS5", library.ErrSearchUnavailable)
+	}
+
+	match := matchExpr(query)
+	if len(match) == 0 {
+		return results, nil
+	}
+
+	for _, t := range searchTables {
+		hits, err := service.search(t[0], t[1], t[2], match, limit)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return results, err
+		}
+
+		switch t[0] {
+		case "artists":
+			results.Artists = hits
+		case "albums":
+			results.Albums = hits
+		case "songs":
+			results.Songs = hits
+		}
+	}
+	return results, nil
+}
+
+// search queries the given search table for the hits of the given match
+// expression, ranked by bm25 with the given weights.
+func (service *SearchService) search(resourceType, table, weights, match string, limit int) ([]*library.SearchHit, error) {
+	var results []*library.SearchHit
+
+	query := fmt.Sprintf(
+		`SELECT rowid,
+		        name,
+		        snippet(%[1]s, -1, '<mark>', '</mark>', '...', 12),
+		        -bm25(%[1]s, %[2]s) AS relevance
+		   FROM %[1]s
+		  WHERE %[1]s MATCH ?
+		  ORDER BY relevance DESC, rowid`, table, weights)
+	args := []interface{}{match}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := service.session.conn().Query(query, args...)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		h := library.SearchHit{Type: resourceType}
+		err := rows.Scan(
+			&h.ID,
+			&h.Name,
+			&h.Snippet,
+			&h.Rank)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, &h)
+	}
+	return results, rows.Err()
+}
+
+// matchExpr returns the FTS5 query that matches text in which every word of
+// the given query starts a word. Words are quoted so that no character of the
+// query is read as FTS5 syntax.
+func matchExpr(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+	})
+
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = `"` + w + `"*`
+	}
+	return strings.Join(terms, ` `)
+}
+
+// SearchContext calls Search within the given context.
+func (service *SearchService) SearchContext(ctx context.Context, query string, limit int) (*library.SearchResults, error) {
+	return service.session.bind(ctx).searchService.Search(query, limit)
+}
@@ -0,0 +1,154 @@
+package sqlite
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// searchTestNames returns the names of the given hits, checking that each is
+// of the given type and that they are ordered from the most relevant.
+func searchTestNames(t *testing.T, resourceType string, hits []*library.SearchHit) []string {
+	t.Helper()
+
+	names := []string{}
+	for i, h := range hits {
+		if h.Type != resourceType {
+			t.Errorf("hit %s has type %q among the %s", h.Name, h.Type, resourceType)
+		}
+		if i > 0 && h.Rank > hits[i-1].Rank {
+			t.Errorf("hit %s ranks %v after %s at %v", h.Name, h.Rank, hits[i-1].Name, hits[i-1].Rank)
+		}
+		names = append(names, h.Name)
+	}
+	return names
+}
+
+// TestSearch checks that searches match the starts of words regardless of case
+// and diacritics, group and rank their hits by type, and follow the changes
+// made to the library. Builds without FTS5 must refuse to search.
+func TestSearch(t *testing.T) {
+	ls := openTestService(t)
+	addTestSong(t, ls,
+		&library.SongAttributes{FilePath: "/music/1.mp3", Name: "Halo", ArtistName: "Beyoncé", Lyrics: "remember those walls I built"},
+		&library.AlbumAttributes{Name: "Sasha Fierce"})
+	addTestSong(t, ls,
+		&library.SongAttributes{FilePath: "/music/2.mp3", Name: "Walls", ArtistName: "Ann", Lyrics: "a halo of morning light"},
+		&library.AlbumAttributes{Name: "First"})
+	addTestSong(t, ls,
+		&library.SongAttributes{FilePath: "/music/3.mp3", Name: "Sunrise", ArtistName: "Halogen"},
+		&library.AlbumAttributes{Name: "Halcyon Days"})
+
+	available, err := ls.Session.searchService.available()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := ls.Session.SearchService()
+	results, err := search.Search("beyonce", 0)
+	if !available {
+		if !errors.Is(err, library.ErrSearchUnavailable) {
+			t.Fatalf("Search without FTS5 returned %v, want ErrSearchUnavailable", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query   string
+		limit   int
+		artists []string
+		albums  []string
+		songs   []string
+	}{
+		{"beyonce", 0, []string{"Beyoncé"}, []string{"Sasha Fierce"}, []string{"Halo"}},
+		{"BEYONCÉ", 0, []string{"Beyoncé"}, []string{"Sasha Fierce"}, []string{"Halo"}},
+		{"hal", 0, []string{"Halogen"}, []string{"Halcyon Days"}, []string{"Halo", "Sunrise", "Walls"}},
+		{"hal", 1, []string{"Halogen"}, []string{"Halcyon Days"}, []string{"Halo"}},
+		{"halo", 0, []string{"Halogen"}, []string{"Halcyon Days"}, []string{"Halo", "Sunrise", "Walls"}},
+		{"halog", 0, []string{"Halogen"}, []string{"Halcyon Days"}, []string{"Sunrise"}},
+		{"beyonce halo", 0, []string{}, []string{}, []string{"Halo"}},
+		{"alo", 0, []string{}, []string{}, []string{}},
+		{`"light" OR NOT* ann:`, 0, []string{}, []string{}, []string{}},
+		{"morning light", 0, []string{}, []string{}, []string{"Walls"}},
+	}
+	for _, tt := range tests {
+		results, err := search.Search(tt.query, tt.limit)
+		if err != nil {
+			t.Errorf("Search(%q) returned %v", tt.query, err)
+			continue
+		}
+		got := [][]string{
+			searchTestNames(t, "artists", results.Artists),
+			searchTestNames(t, "albums", results.Albums),
+			searchTestNames(t, "songs", results.Songs),
+		}
+		if want := [][]string{tt.artists, tt.albums, tt.songs}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Search(%q, %d) found %v, want %v", tt.query, tt.limit, got, want)
+		}
+	}
+
+	results, err = search.Search("light", 0)
+	if err != nil || len(results.Songs) != 1 || !strings.Contains(results.Songs[0].Snippet, "<mark>light</mark>") {
+		t.Errorf("Search of lyrics returned %+v (%v), want a snippet marking light", results.Songs, err)
+	}
+	results, err = search.Search("bey", 0)
+	if err != nil || len(results.Artists) != 1 || results.Artists[0].Snippet != "<mark>Beyoncé</mark>" {
+		t.Errorf("Search of a prefix returned %+v (%v), want the snippet <mark>Beyoncé</mark>", results.Artists, err)
+	}
+
+	// The index follows renames, merges and deletes.
+	ann := queryTestID(t, ls, `SELECT artist_id FROM artists WHERE artist_name = 'Ann'`)
+	beyonce := queryTestID(t, ls, `SELECT artist_id FROM artists WHERE artist_name = 'Beyoncé'`)
+	walls := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'Walls'`)
+	halo := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'Halo'`)
+	steps := []struct {
+		name   string
+		change func() error
+		query  string
+		want   [][]string
+	}{
+		{"renaming a song",
+			func() error {
+				return ls.Session.SongService().UpdateSong(walls, &library.SongAttributes{Name: "Candles"})
+			},
+			"candles", [][]string{{}, {}, {"Candles"}}},
+		{"renaming an artist",
+			func() error {
+				return ls.Session.ArtistService().UpdateArtist(ann, &library.ArtistAttributes{Name: "Annie"})
+			},
+			"annie", [][]string{{"Annie"}, {"First"}, {"Candles"}}},
+		{"merging artists",
+			func() error { return ls.Session.ArtistService().MergeArtists(beyonce, ann) },
+			"beyonce", [][]string{{"Beyoncé"}, {"First", "Sasha Fierce"}, {"Candles", "Halo"}}},
+		{"merging artists, for the merged name",
+			func() error { return nil },
+			"annie", [][]string{{}, {}, {}}},
+		{"deleting a song",
+			func() error { return ls.Session.SongService().DeleteSong(halo) },
+			"halo", [][]string{{"Halogen"}, {"Halcyon Days"}, {"Sunrise", "Candles"}}},
+	}
+	for _, step := range steps {
+		err := step.change()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		results, err := search.Search(step.query, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		got := [][]string{
+			searchTestNames(t, "artists", results.Artists),
+			searchTestNames(t, "albums", results.Albums),
+			searchTestNames(t, "songs", results.Songs),
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("after %s, Search(%q) found %v, want %v", step.name, step.query, got, step.want)
+		}
+	}
+}
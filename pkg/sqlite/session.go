@@ -1,6 +1,7 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"github.com/jeremybouzigard/library"
 	"log"
@@ -9,8 +10,10 @@ import (
 
 // Session represents an open connection to the database.
 type Session struct {
-	db     *sql.DB
-	tx     *sql.Tx
+	db     boundDB
+	tx     *boundTx
+	ctx    context.Context
+	user   string
 	Logger *log.Logger
 
 	// Services
@@ -18,37 +21,224 @@ type Session struct {
 	artistService      ArtistService
 	genreService       GenreService
 	songService        SongService
+	playlistService    PlaylistService
+	playService        PlayService
+	ratingService      RatingService
+	tagService         TagService
+	userService        UserService
+	searchService      SearchService
 	LibraryService     library.Service
 	AlbumDiscogService AlbumDiscogService
 	SongDiscogService  SongDiscogService
+	RootService        RootService
+	ArtistAliasService ArtistAliasService
+}
+
+// queryer is implemented by both the database and its transactions.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// boundDB binds the calls of the database to the context of a session.
+type boundDB struct {
+	*sql.DB
+	ctx context.Context
+}
+
+// Exec calls ExecContext with the context of the session.
+func (db boundDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.ExecContext(db.ctx, query, args...)
+}
+
+// Query calls QueryContext with the context of the session.
+func (db boundDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.QueryContext(db.ctx, query, args...)
+}
+
+// QueryRow calls QueryRowContext with the context of the session.
+func (db boundDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRowContext(db.ctx, query, args...)
+}
+
+// Begin calls BeginTx with the context of the session.
+func (db boundDB) Begin() (*sql.Tx, error) {
+	return db.DB.BeginTx(db.ctx, nil)
+}
+
+// boundTx binds the calls of a transaction to the context of a session.
+type boundTx struct {
+	*sql.Tx
+	ctx context.Context
+}
+
+// Exec calls ExecContext with the context of the session.
+func (tx *boundTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(tx.ctx, query, args...)
+}
+
+// Query calls QueryContext with the context of the session.
+func (tx *boundTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(tx.ctx, query, args...)
+}
+
+// QueryRow calls QueryRowContext with the context of the session.
+func (tx *boundTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(tx.ctx, query, args...)
+}
+
+// Prepare calls PrepareContext with the context of the session. Statements
+// prepared within the transaction must still be executed with the context.
+func (tx *boundTx) Prepare(query string) (*sql.Stmt, error) {
+	return tx.Tx.PrepareContext(tx.ctx, query)
 }
 
 // newSession returns a new instance of a Session attached to the database.
 func newSession(db *sql.DB) *Session {
+	ctx := context.Background()
 	s := &Session{
-		db:     db,
+		db:     boundDB{DB: db, ctx: ctx},
+		ctx:    ctx,
 		Logger: log.New(os.Stderr, "", log.LstdFlags)}
 	s.genreService = NewGenreService(s)
 	s.artistService = NewArtistService(s)
 	s.albumService = NewAlbumService(s)
 	s.songService = NewSongService(s)
+	s.playlistService = NewPlaylistService(s)
+	s.playService = NewPlayService(s)
+	s.ratingService = NewRatingService(s)
+	s.tagService = NewTagService(s)
+	s.userService = NewUserService(s)
+	s.searchService = NewSearchService(s)
 	s.AlbumDiscogService = NewAlbumDiscogService(s)
 	s.SongDiscogService = NewSongDiscogService(s)
+	s.RootService = NewRootService(s)
+	s.ArtistAliasService = NewArtistAliasService(s)
 	return s
 }
 
+// WithUser returns a new session on the same database in which the user with
+// the given ID is acting. Playlists, plays and ratings are read and recorded
+// for the acting user; when no user is acting, they are shared. Recording them
+// returns library.ErrNotFound if there is no user with the given ID.
+func (s *Session) WithUser(ID string) *Session {
+	u := newSession(s.db.DB)
+	u.Logger = s.Logger
+	u.user = ID
+	u.setContext(s.ctx)
+	return u
+}
+
+// WithContext returns a new session on the same database in which the user
+// acting in the given context is acting, if any, as in WithUser, and whose
+// calls to the database are cancelled along with the context.
+func (s *Session) WithContext(ctx context.Context) *Session {
+	u := s.WithUser(s.contextUser(ctx))
+	u.setContext(ctx)
+	return u
+}
+
+// bind returns a copy of the session for the context variants of service
+// methods, in which the user is resolved from the given context as in
+// WithContext and whose calls to the database are bound to the context. The
+// copy shares the database, transaction and prepared statements of the
+// session.
+func (s *Session) bind(ctx context.Context) *Session {
+	b := *s
+	b.user = s.contextUser(ctx)
+	if s.tx != nil {
+		b.tx = &boundTx{Tx: s.tx.Tx}
+	}
+	b.setContext(ctx)
+	b.attach()
+	return &b
+}
+
+// contextUser returns the ID of the user acting in the given context, or of
+// the user acting in the session if no user is acting in the context.
+func (s *Session) contextUser(ctx context.Context) string {
+	if ID := library.UserFromContext(ctx); len(ID) > 0 {
+		return ID
+	}
+	return s.user
+}
+
+// attach points the services of the session, which may have been copied from
+// another session, at the session.
+func (s *Session) attach() {
+	s.albumService.session = s
+	s.artistService.session = s
+	s.genreService.session = s
+	s.songService.session = s
+	s.playlistService.session = s
+	s.playService.session = s
+	s.ratingService.session = s
+	s.tagService.session = s
+	s.userService.session = s
+	s.searchService.session = s
+	s.AlbumDiscogService.session = s
+	s.SongDiscogService.session = s
+	s.RootService.session = s
+	s.ArtistAliasService.session = s
+}
+
+// setContext binds the calls of the session to the database to the given
+// context.
+func (s *Session) setContext(ctx context.Context) {
+	s.ctx = ctx
+	s.db.ctx = ctx
+	if s.tx != nil {
+		s.tx.ctx = ctx
+	}
+}
+
+// User returns the ID of the user acting in the session, or an empty string if
+// no user is.
+func (s *Session) User() string {
+	return s.user
+}
+
+// checkUser returns library.ErrNotFound if a user is acting in the session but
+// there is no such user, so that nothing is recorded for them.
+func (s *Session) checkUser() error {
+	if len(s.user) == 0 {
+		return nil
+	}
+
+	var n int
+	err := s.conn().QueryRow(`SELECT COUNT(*) FROM users WHERE user_id = ?`, s.user).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return library.ErrNotFound
+	}
+	return nil
+}
+
+// userID returns the ID under which the state of the acting user is stored,
+// which is 0 when no user is acting.
+func (s *Session) userID() string {
+	if len(s.user) == 0 {
+		return "0"
+	}
+	return s.user
+}
+
 // BeginTx starts a transaction within a Session.
 func (s *Session) BeginTx() error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
-	s.tx = tx
+	s.tx = &boundTx{Tx: tx, ctx: s.ctx}
 	return nil
 }
 
 // CommitTx commits the transaction within a Session.
 func (s *Session) CommitTx() error {
+	s.closeStatements()
 	err := s.tx.Commit()
 	if err != nil {
 		return err
@@ -57,6 +247,119 @@ func (s *Session) CommitTx() error {
 	return nil
 }
 
+// RollbackTx aborts the transaction within a Session.
+func (s *Session) RollbackTx() error {
+	s.closeStatements()
+	err := s.tx.Rollback()
+	s.tx = nil
+	return err
+}
+
+// inTx calls fn within the current transaction if there is one. Otherwise, fn
+// is called within a new transaction that is committed if fn succeeds and
+// rolled back if it fails.
+func (s *Session) inTx(fn func() error) error {
+	if s.tx != nil {
+		return fn()
+	}
+
+	err := s.BeginTx()
+	if err != nil {
+		s.Logger.Println(err)
+		return err
+	}
+
+	err = fn()
+	if err != nil {
+		s.RollbackTx()
+		return err
+	}
+	return s.CommitTx()
+}
+
+// ids executes the given query, which selects a single column of IDs, within
+// the current transaction and returns the IDs.
+func (s *Session) ids(query string, args ...interface{}) ([]string, error) {
+	var results []string
+
+	rows, err := s.tx.Query(query, args...)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ID string
+		err := rows.Scan(&ID)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, ID)
+	}
+	return results, rows.Err()
+}
+
+// conn returns the current transaction if there is one, or the database
+// otherwise.
+func (s *Session) conn() queryer {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// prune deletes the albums, artists and genres left without any songs, along
+// with the ratings and tags of deleted resources, and adds the number of each deleted
+// to the given report.
+func (s *Session) prune(report *ScanReport) error {
+	_, err := s.AlbumDiscogService.prune()
+	if err != nil {
+		return err
+	}
+
+	n, err := s.albumService.prune()
+	if err != nil {
+		return err
+	}
+	report.AlbumsPruned += n
+
+	n, err = s.artistService.prune()
+	if err != nil {
+		return err
+	}
+	report.ArtistsPruned += n
+
+	_, err = s.ArtistAliasService.prune()
+	if err != nil {
+		return err
+	}
+
+	n, err = s.genreService.prune()
+	if err != nil {
+		return err
+	}
+	report.GenresPruned += n
+
+	err = s.ratingService.prune()
+	if err != nil {
+		return err
+	}
+	return s.tagService.prune()
+}
+
+// closeStatements closes the prepared statements held by each service, which
+// are bound to the transaction they were prepared in.
+func (s *Session) closeStatements() {
+	s.genreService.Close()
+	s.artistService.Close()
+	s.albumService.Close()
+	s.songService.Close()
+	s.playService.Close()
+	s.AlbumDiscogService.Close()
+	s.SongDiscogService.Close()
+	s.ArtistAliasService.Close()
+}
+
 // GenreService returns a genre service associated with this session.
 func (s *Session) GenreService() library.GenreService {
 	return &s.genreService
@@ -76,3 +379,33 @@ func (s *Session) ArtistService() library.ArtistService {
 func (s *Session) SongService() library.SongService {
 	return &s.songService
 }
+
+// PlaylistService returns a playlist service associated with this session.
+func (s *Session) PlaylistService() library.PlaylistService {
+	return &s.playlistService
+}
+
+// PlayService returns a play service associated with this session.
+func (s *Session) PlayService() library.PlayService {
+	return &s.playService
+}
+
+// RatingService returns a rating service associated with this session.
+func (s *Session) RatingService() library.RatingService {
+	return &s.ratingService
+}
+
+// TagService returns a tag service associated with this session.
+func (s *Session) TagService() library.TagService {
+	return &s.tagService
+}
+
+// UserService returns a user service associated with this session.
+func (s *Session) UserService() library.UserService {
+	return &s.userService
+}
+
+// SearchService returns a search service associated with this session.
+func (s *Session) SearchService() library.SearchService {
+	return &s.searchService
+}
@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// TestContextUser checks that the context variants of service methods act for
+// the user acting in the context, as sessions made by WithContext do.
+func TestContextUser(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "1.mp3"), "title", "One")
+
+	ls := openTestService(t)
+	_, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	songs, err := ls.Session.SongService().Songs(map[string]string{})
+	if err != nil || len(songs) != 1 {
+		t.Fatalf("Songs found %d songs (%v), want 1", len(songs), err)
+	}
+	ID := songs[0].ID
+	users := createTestUsers(t, ls, "Alice", "Bob")
+
+	err = ls.Session.WithUser(users[0]).RatingService().Rate("songs", ID, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := library.ContextWithUser(context.Background(), users[0])
+	for name, session := range map[string]*Session{
+		"root session":   ls.Session,
+		"other user":     ls.Session.WithUser(users[1]),
+		"context user":   ls.Session.WithContext(ctx),
+		"session's user": ls.Session.WithUser(users[0]),
+	} {
+		bound, err := session.SongService().SongContext(ctx, ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bound.Attributes.Rating != 4 {
+			t.Errorf("SongContext on the %s returned rating %v, want 4", name, bound.Attributes.Rating)
+		}
+	}
+
+	// Without a user in the context, the user of the session acts.
+	s, err := ls.Session.WithUser(users[0]).SongService().SongContext(context.Background(), ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Attributes.Rating != 4 {
+		t.Errorf("SongContext without a context user returned rating %v, want 4", s.Attributes.Rating)
+	}
+}
+
+// TestContextCancelled checks that the context variants of service methods
+// fail once their context is cancelled.
+func TestContextCancelled(t *testing.T) {
+	ls := openTestService(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ls.Session.SongService().SongsContext(ctx, map[string]string{})
+	if err == nil {
+		t.Error("SongsContext with a cancelled context succeeded")
+	}
+	_, err = ls.Session.SongService().SongsContext(context.Background(), map[string]string{})
+	if err != nil {
+		t.Errorf("SongsContext after a cancelled call returned %v", err)
+	}
+}
+
+// TestContextVariantsOfUserServices checks that the context variants of the
+// playlist, play and rating services record for the user acting in the
+// context, and that the context variants of other services fail once their
+// context is cancelled.
+func TestContextVariantsOfUserServices(t *testing.T) {
+	ls := openTestService(t)
+	dir := scanTestLibrary(t, ls)
+	IDs := createTestUsers(t, ls, "Alice")
+	songID := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'One'`)
+
+	ctx := library.ContextWithUser(context.Background(), IDs[0])
+	p, err := ls.Session.PlaylistService().CreatePlaylistContext(ctx, &library.PlaylistAttributes{Name: "Mix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ls.Session.PlaylistService().InsertSongContext(ctx, p.ID, songID, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ls.Session.PlayService().RecordPlayContext(ctx, &library.PlayAttributes{SongID: songID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ls.Session.RatingService().RateContext(ctx, "songs", songID, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"playlists", "plays", "ratings"} {
+		if n := queryTestInt(t, ls, `SELECT COUNT(*) FROM `+table+` WHERE user_id = ?`, IDs[0]); n != 1 {
+			t.Errorf("%s holds %d rows of the context user, want 1", table, n)
+		}
+	}
+	songs, err := ls.Session.PlaylistService().PlaylistSongsContext(ctx, p.ID)
+	if err != nil || len(songs) != 1 {
+		t.Errorf("PlaylistSongsContext found %d songs (%v), want 1", len(songs), err)
+	}
+	_, err = ls.Session.PlaylistService().PlaylistSongsContext(context.Background(), p.ID)
+	if err != library.ErrNotFound {
+		t.Errorf("PlaylistSongsContext without the user returned %v, want %v", err, library.ErrNotFound)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	for name, call := range map[string]func() error{
+		"PlaylistsContext": func() error {
+			_, err := ls.Session.PlaylistService().PlaylistsContext(cancelled)
+			return err
+		},
+		"PlaysContext": func() error {
+			_, err := ls.Session.PlayService().PlaysContext(cancelled, songID, 0)
+			return err
+		},
+		"LoveContext": func() error {
+			return ls.Session.RatingService().LoveContext(cancelled, "songs", songID, true)
+		},
+		"TagsContext": func() error {
+			_, err := ls.Session.TagService().TagsContext(cancelled)
+			return err
+		},
+		"UsersContext": func() error {
+			_, err := ls.Session.UserService().UsersContext(cancelled)
+			return err
+		},
+		"ListContext": func() error {
+			_, err := ls.Session.RootService.ListContext(cancelled)
+			return err
+		},
+		"RelocateContext": func() error {
+			_, err := ls.RelocateContext(cancelled, dir, filepath.Join(dir, "moved"))
+			return err
+		},
+		"ExportPlaylistContext": func() error {
+			return ls.ExportPlaylistContext(cancelled, p.ID, filepath.Join(dir, "Mix.m3u8"))
+		},
+	} {
+		if err := call(); err == nil {
+			t.Errorf("%s with a cancelled context succeeded", name)
+		}
+	}
+}
@@ -73,7 +73,8 @@ func (sds *SongDiscogService) CreateSongDiscog(sa *library.SongAttributes, aa *l
 		sds.insert = stmt
 	}
 
-	_, err := sds.insert.Exec(
+	_, err := sds.insert.ExecContext(
+		sds.session.ctx,
 		sa.ArtistName, sa.ArtistSort,
 		sa.FilePath,
 		aa.Name, aa.Sort)
@@ -85,6 +86,43 @@ func (sds *SongDiscogService) CreateSongDiscog(sa *library.SongAttributes, aa *l
 	return nil
 }
 
+// updateArtist links the song with the given ID to its current artist.
+func (sds *SongDiscogService) updateArtist(songID string) error {
+	update :=
+		`UPDATE OR REPLACE song_discographies 
+		               SET artist_id = (SELECT artist_id 
+		                                  FROM songs 
+		                                 WHERE song_id = ?) 
+		             WHERE song_id = ?`
+	_, err := sds.session.tx.Exec(update, songID, songID)
+	if err != nil {
+		sds.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// clearAlbum unlinks songs from the album with the given ID.
+func (sds *SongDiscogService) clearAlbum(albumID string) error {
+	update := `UPDATE song_discographies SET album_id = NULL WHERE album_id = ?`
+	_, err := sds.session.tx.Exec(update, albumID)
+	if err != nil {
+		sds.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// deleteSongDiscogs deletes the records that link the song with the given ID.
+func (sds *SongDiscogService) deleteSongDiscogs(songID string) error {
+	_, err := sds.session.tx.Exec(`DELETE FROM song_discographies WHERE song_id = ?`, songID)
+	if err != nil {
+		sds.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
 // Close closes all open statements.
 func (sds *SongDiscogService) Close() error {
 	if sds.insert != nil {
@@ -93,6 +131,7 @@ func (sds *SongDiscogService) Close() error {
 			sds.session.Logger.Println(err)
 			return err
 		}
+		sds.insert = nil
 	}
 
 	return nil
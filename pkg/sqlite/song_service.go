@@ -2,7 +2,10 @@ package sqlite
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"path/filepath"
+	"strings"
 
 	"github.com/jeremybouzigard/library"
 )
@@ -33,7 +36,9 @@ func (ss *SongService) CreateTable() (sql.Result, error) {
 			genre_id           INTEGER,
 			release_date       TEXT,
 			track_number       INTEGER,
+			track_total        INTEGER,
 			disc_number        INTEGER,
+			disc_total         INTEGER,
 			duration_in_millis INTEGER,
 			artist_sort        TEXT,
 			composer_name      TEXT,
@@ -41,12 +46,38 @@ func (ss *SongService) CreateTable() (sql.Result, error) {
 			conductor          TEXT,
 			song_name_sort     TEXT,
 			lyrics             TEXT,
+			comments           TEXT,
+			file_size          INTEGER,
+			file_mtime         INTEGER,
+			fingerprint        TEXT,
+			root_id            INTEGER,
+			date_added         TEXT,
 			FOREIGN KEY('artist_id') REFERENCES artists('artist_id'),
-			FOREIGN KEY('genre_id')  REFERENCES genres('genre_id')
+			FOREIGN KEY('genre_id')  REFERENCES genres('genre_id'),
+			FOREIGN KEY('root_id')   REFERENCES library_roots('root_id')
 		)`
 	return ss.session.tx.Exec(create)
 }
 
+// CreateIndexes creates the indexes of the 'songs' table and returns any
+// errors.
+func (ss *SongService) CreateIndexes() (sql.Result, error) {
+	index := `CREATE INDEX IF NOT EXISTS songs_file_path ON songs (file_path)`
+	result, err := ss.session.tx.Exec(index)
+	if err != nil {
+		return result, err
+	}
+
+	index = `CREATE INDEX IF NOT EXISTS songs_fingerprint ON songs (fingerprint)`
+	result, err = ss.session.tx.Exec(index)
+	if err != nil {
+		return result, err
+	}
+
+	index = `CREATE INDEX IF NOT EXISTS songs_root_id ON songs (root_id)`
+	return ss.session.tx.Exec(index)
+}
+
 // DropTable drops the 'songs' table and returns any errors.
 func (ss *SongService) DropTable() (sql.Result, error) {
 	drop := `DROP TABLE IF EXISTS songs`
@@ -55,6 +86,11 @@ func (ss *SongService) DropTable() (sql.Result, error) {
 
 // CreateSong inserts a new song.
 func (ss *SongService) CreateSong(sa *library.SongAttributes) error {
+	return ss.createSong(sa, &songFile{})
+}
+
+// createSong inserts a new song along with the properties of its file.
+func (ss *SongService) createSong(sa *library.SongAttributes, sf *songFile) error {
 	if ss.insert == nil {
 		stmt, err := ss.PrepareInsert()
 		if err != nil {
@@ -64,7 +100,8 @@ func (ss *SongService) CreateSong(sa *library.SongAttributes) error {
 		ss.insert = stmt
 	}
 
-	_, err := ss.insert.Exec(
+	_, err := ss.insert.ExecContext(
+		ss.session.ctx,
 		sa.FilePath,
 		sa.FileBase,
 		sa.FileDir,
@@ -73,9 +110,21 @@ func (ss *SongService) CreateSong(sa *library.SongAttributes) error {
 		sa.GenreName,
 		sa.ReleaseDate,
 		sa.TrackNumber,
-		sa.TrackNumber,
-		sa.TrackNumber,
+		nullable(sa.TrackTotal),
+		nullable(sa.DiscNumber),
+		nullable(sa.DiscTotal),
+		sa.DurationInMillis,
+		nullable(sa.Composer),
+		nullable(sa.ComposerSort),
+		nullable(sa.Conductor),
+		nullable(sa.Sort),
 		sa.Lyrics,
+		nullable(sa.Comments),
+		sf.size,
+		sf.modTime,
+		sf.fingerprint,
+		nullable(sf.root),
+		now(),
 		sa.FilePath)
 
 	if err != nil {
@@ -97,9 +146,21 @@ func (ss *SongService) PrepareInsert() (*sql.Stmt, error) {
 		              genre_id, 
 		              release_date, 
 		              track_number, 
+		              track_total, 
 		              disc_number, 
+		              disc_total, 
 		              duration_in_millis, 
-		              lyrics) 
+		              composer_name, 
+		              composer_sort, 
+		              conductor, 
+		              song_name_sort, 
+		              lyrics, 
+		              comments, 
+		              file_size, 
+		              file_mtime, 
+		              fingerprint, 
+		              root_id, 
+		              date_added) 
 		                       SELECT ?, 
 		                              ?, 
 		                              ?, 
@@ -115,6 +176,18 @@ func (ss *SongService) PrepareInsert() (*sql.Stmt, error) {
 		                              ?, 
 		                              ?, 
 		                              ?, 
+		                              ?, 
+		                              ?, 
+		                              ?, 
+		                              ?, 
+		                              ?, 
+		                              ?, 
+		                              ?, 
+		                              ?, 
+		                              ?, 
+		                              ?, 
+		                              ?, 
+		                              ?, 
 		                              ? 
 		             WHERE NOT EXISTS (SELECT 1 
 		                                FROM songs 
@@ -122,31 +195,465 @@ func (ss *SongService) PrepareInsert() (*sql.Stmt, error) {
 	return ss.session.tx.Prepare(insert)
 }
 
-// Song queries the 'songs' table for a song  with the given ID and returns the
-// result along with any error.
-func (ss *SongService) Song(ID string) (*library.Song, error) {
-	var s library.Song
+// UpdateSong updates the song with the given ID with the given attributes.
+// Empty attributes are left unchanged. The artist and genre named by the
+// attributes are created if they do not exist, and any artists, albums and
+// genres left without songs are deleted.
+func (ss *SongService) UpdateSong(ID string, sa *library.SongAttributes) error {
+	return ss.session.inTx(func() error {
+		if len(sa.GenreName) > 0 {
+			err := ss.session.genreService.CreateGenre(&library.GenreAttributes{
+				Name: sa.GenreName})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(sa.ArtistName) > 0 {
+			err := ss.session.artistService.CreateArtist(&library.ArtistAttributes{
+				Name: sa.ArtistName,
+				Sort: sa.ArtistSort})
+			if err != nil {
+				return err
+			}
+		}
+
+		update :=
+			`UPDATE songs 
+			    SET artist_id = COALESCE((SELECT artist_id 
+			                                FROM artists 
+			                               WHERE artist_name = NULLIF(?, '') 
+			                                 AND artist_sort = ?), artist_id), 
+			        song_name = COALESCE(NULLIF(?, ''), song_name), 
+			        genre_id = COALESCE((SELECT genre_id 
+			                               FROM genres 
+			                              WHERE genre_name = NULLIF(?, '')), genre_id), 
+			        release_date = COALESCE(NULLIF(?, ''), release_date), 
+			        track_number = COALESCE(NULLIF(?, ''), track_number), 
+			        track_total = COALESCE(NULLIF(?, ''), track_total), 
+			        disc_number = COALESCE(NULLIF(?, ''), disc_number), 
+			        disc_total = COALESCE(NULLIF(?, ''), disc_total), 
+			        duration_in_millis = COALESCE(NULLIF(?, 0), duration_in_millis), 
+			        composer_name = COALESCE(NULLIF(?, ''), composer_name), 
+			        composer_sort = COALESCE(NULLIF(?, ''), composer_sort), 
+			        conductor = COALESCE(NULLIF(?, ''), conductor), 
+			        song_name_sort = COALESCE(NULLIF(?, ''), song_name_sort), 
+			        lyrics = COALESCE(NULLIF(?, ''), lyrics), 
+			        comments = COALESCE(NULLIF(?, ''), comments) 
+			  WHERE song_id = ?`
+		result, err := ss.session.tx.Exec(update,
+			sa.ArtistName, sa.ArtistSort,
+			sa.Name,
+			sa.GenreName,
+			sa.ReleaseDate,
+			sa.TrackNumber,
+			sa.TrackTotal,
+			sa.DiscNumber,
+			sa.DiscTotal,
+			sa.DurationInMillis,
+			sa.Composer,
+			sa.ComposerSort,
+			sa.Conductor,
+			sa.Sort,
+			sa.Lyrics,
+			sa.Comments,
+			ID)
+		if err == nil {
+			err = found(result)
+		}
+		if err != nil {
+			ss.session.Logger.Println(err)
+			return err
+		}
+
+		err = ss.session.SongDiscogService.updateArtist(ID)
+		if err != nil {
+			return err
+		}
+		return ss.session.prune(&ScanReport{})
+	})
+}
+
+// DeleteSong deletes the song with the given ID, along with any artists,
+// albums and genres left without songs. The file of the song is left
+// untouched, so the song is added again by the next scan that finds the file.
+func (ss *SongService) DeleteSong(ID string) error {
+	return ss.session.inTx(func() error {
+		err := ss.deleteSong(ID)
+		if err != nil {
+			return err
+		}
+		return ss.session.prune(&ScanReport{})
+	})
+}
+
+// updateSong replaces the tag data and file properties of the song with the
+// given ID.
+func (ss *SongService) updateSong(ID string, sa *library.SongAttributes, sf *songFile) error {
+	update :=
+		`UPDATE songs 
+		    SET file_base = ?, 
+		        file_dir = ?, 
+		        artist_id = (SELECT artist_id 
+		                       FROM artists 
+		                      WHERE artist_name = ? 
+		                        AND artist_sort = ?), 
+		        song_name = ?, 
+		        genre_id = (SELECT genre_id 
+		                      FROM genres 
+		                     WHERE genre_name = ?), 
+		        release_date = ?, 
+		        track_number = ?, 
+		        track_total = ?, 
+		        disc_number = ?, 
+		        disc_total = ?, 
+		        duration_in_millis = ?, 
+		        composer_name = ?, 
+		        composer_sort = ?, 
+		        conductor = ?, 
+		        song_name_sort = ?, 
+		        lyrics = ?, 
+		        comments = ?, 
+		        file_size = ?, 
+		        file_mtime = ?, 
+		        fingerprint = ?, 
+		        root_id = ? 
+		  WHERE song_id = ?`
+	_, err := ss.session.tx.Exec(update,
+		sa.FileBase,
+		sa.FileDir,
+		sa.ArtistName, sa.ArtistSort,
+		sa.Name,
+		sa.GenreName,
+		sa.ReleaseDate,
+		sa.TrackNumber,
+		nullable(sa.TrackTotal),
+		nullable(sa.DiscNumber),
+		nullable(sa.DiscTotal),
+		sa.DurationInMillis,
+		nullable(sa.Composer),
+		nullable(sa.ComposerSort),
+		nullable(sa.Conductor),
+		nullable(sa.Sort),
+		sa.Lyrics,
+		nullable(sa.Comments),
+		sf.size,
+		sf.modTime,
+		sf.fingerprint,
+		nullable(sf.root),
+		ID)
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// updateFile records new file properties for the song with the given ID.
+func (ss *SongService) updateFile(ID string, sf *songFile) error {
+	update :=
+		`UPDATE songs 
+		    SET file_size = ?, 
+		        file_mtime = ?, 
+		        fingerprint = ? 
+		  WHERE song_id = ?`
+	_, err := ss.session.tx.Exec(update, sf.size, sf.modTime, sf.fingerprint, ID)
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// moveSong records that the song with the given ID has moved to the given file.
+func (ss *SongService) moveSong(ID string, sf *songFile) error {
+	update :=
+		`UPDATE songs 
+		    SET file_path = ?, 
+		        file_base = ?, 
+		        file_dir = ?, 
+		        file_size = ?, 
+		        file_mtime = ?, 
+		        fingerprint = ?, 
+		        root_id = ? 
+		  WHERE song_id = ?`
+	_, err := ss.session.tx.Exec(update,
+		sf.path,
+		filepath.Base(sf.path),
+		filepath.Dir(sf.path),
+		sf.size,
+		sf.modTime,
+		sf.fingerprint,
+		nullable(sf.root),
+		ID)
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// deleteSong deletes the song with the given ID along with the records that
+// link it to its artists and album, its entries in playlists and its plays.
+func (ss *SongService) deleteSong(ID string) error {
+	err := ss.session.SongDiscogService.deleteSongDiscogs(ID)
+	if err != nil {
+		return err
+	}
+
+	err = ss.session.playlistService.deleteSongEntries(ID)
+	if err != nil {
+		return err
+	}
+
+	err = ss.session.playService.deleteSongPlays(ID)
+	if err != nil {
+		return err
+	}
+
+	result, err := ss.session.tx.Exec(`DELETE FROM songs WHERE song_id = ?`, ID)
+	if err == nil {
+		err = found(result)
+	}
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// relocate rewrites the paths of the songs whose files lie beneath the given
+// old directory so that they lie beneath the given new directory instead, and
+// returns the files relocated keyed by their new paths.
+func (ss *SongService) relocate(oldDir, newDir string) (map[string]*songFile, error) {
+	results := make(map[string]*songFile)
+
+	query :=
+		`SELECT song_id, 
+		        file_path 
+		   FROM songs 
+		  WHERE substr(file_path, 1, length(?) + 1) = ? || ?`
+	rows, err := ss.session.tx.Query(query, oldDir, oldDir, string(filepath.Separator))
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sf songFile
+		err := rows.Scan(&sf.id, &sf.path)
+		if err != nil {
+			ss.session.Logger.Println(err)
+			return results, err
+		}
+		sf.path = newDir + sf.path[len(oldDir):]
+		results[sf.path] = &sf
+	}
+	err = rows.Err()
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return results, err
+	}
+
+	update :=
+		`UPDATE songs 
+		    SET file_path = ? || substr(file_path, length(?) + 1), 
+		        file_dir = ? || substr(file_dir, length(?) + 1) 
+		  WHERE substr(file_path, 1, length(?) + 1) = ? || ?`
+	_, err = ss.session.tx.Exec(update,
+		newDir, oldDir,
+		newDir, oldDir,
+		oldDir, oldDir, string(filepath.Separator))
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return results, err
+	}
+	return results, nil
+}
+
+// setRoot records that the song with the given ID lies within the library root
+// with the given ID.
+func (ss *SongService) setRoot(ID string, rootID string) error {
+	_, err := ss.session.tx.Exec(`UPDATE songs SET root_id = ? WHERE song_id = ?`, rootID, ID)
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// files queries the 'songs' table for the files recorded at or beneath the
+// given path and returns them keyed by file path.
+func (ss *SongService) files(path string) (map[string]*songFile, error) {
+	results := make(map[string]*songFile)
+
+	prefix := strings.TrimSuffix(path, string(filepath.Separator)) + string(filepath.Separator)
+	query :=
+		`SELECT song_id, 
+		        file_path, 
+		        file_size, 
+		        file_mtime, 
+		        fingerprint 
+		   FROM songs 
+		  WHERE file_path = ? 
+		     OR substr(file_path, 1, length(?)) = ?`
+	rows, err := ss.session.tx.Query(query, path, prefix, prefix)
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sf songFile
+		var size, modTime sql.NullInt64
+		var fingerprint sql.NullString
+		err := rows.Scan(&sf.id, &sf.path, &size, &modTime, &fingerprint)
+		if err != nil {
+			ss.session.Logger.Println(err)
+			return results, err
+		}
+		sf.size = size.Int64
+		sf.modTime = modTime.Int64
+		sf.fingerprint = fingerprint.String
+		results[sf.path] = &sf
+	}
+	return results, rows.Err()
+}
+
+// filesByRoot queries the 'songs' table for the files recorded for the library
+// root with the given ID and returns them keyed by file path.
+func (ss *SongService) filesByRoot(rootID string) (map[string]*songFile, error) {
+	results := make(map[string]*songFile)
+
+	query := `SELECT song_id, file_path FROM songs WHERE root_id = ?`
+	rows, err := ss.session.tx.Query(query, rootID)
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		sf := songFile{root: rootID}
+		err := rows.Scan(&sf.id, &sf.path)
+		if err != nil {
+			ss.session.Logger.Println(err)
+			return results, err
+		}
+		results[sf.path] = &sf
+	}
+	return results, rows.Err()
+}
+
+// filesByFingerprint queries the 'songs' table for the files recorded with the
+// given content fingerprint, along with the paths of their library roots.
+func (ss *SongService) filesByFingerprint(fingerprint string) ([]*songFile, error) {
+	var results []*songFile
+
 	query :=
-		`SELECT
+		`SELECT songs.song_id, 
+		        songs.file_path, 
+		        IFNULL(library_roots.root_path, '') 
+		   FROM songs 
+		        LEFT JOIN library_roots ON songs.root_id = library_roots.root_id 
+		  WHERE songs.fingerprint = ? 
+		  ORDER BY songs.song_id`
+	rows, err := ss.session.tx.Query(query, fingerprint)
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		sf := songFile{fingerprint: fingerprint}
+		err := rows.Scan(&sf.id, &sf.path, &sf.rootPath)
+		if err != nil {
+			ss.session.Logger.Println(err)
+			return results, err
+		}
+		results = append(results, &sf)
+	}
+	return results, rows.Err()
+}
+
+// songColumns lists the columns read by scanSong.
+const songColumns = `
 		  songs.song_id,
 		  songs.file_path,
 		  songs.file_base,
 		  songs.file_dir,
 		  artists.artist_name,
 		  artists.artist_sort,
-		  genres.genre_name,
+		  IFNULL(genres.genre_name, ''),
 		  songs.song_name,
 		  songs.release_date,
 		  songs.track_number,
-		  songs.lyrics
-		FROM
-		  song_discographies
+		  IFNULL(songs.track_total, ''),
+		  IFNULL(songs.disc_number, ''),
+		  IFNULL(songs.disc_total, ''),
+		  IFNULL(songs.duration_in_millis, 0),
+		  IFNULL(songs.composer_name, ''),
+		  IFNULL(songs.composer_sort, ''),
+		  IFNULL(songs.conductor, ''),
+		  IFNULL(songs.song_name_sort, ''),
+		  songs.lyrics,
+		  IFNULL(songs.comments, ''),
+		  IFNULL(songs.date_added, ''),
+		  ` + songPlayCount + `,
+		  ` + songSkipCount + `,
+		  IFNULL(` + songLastPlayed + `, ''),
+		  IFNULL(ratings.rating, 0),
+		  IFNULL(ratings.loved, 0)`
+
+// songPlayCount, songSkipCount and songLastPlayed count and date the plays of
+// a song by the acting user of songTables. Each looks up the plays of the song
+// alone through the index of plays by user and song.
+const (
+	songPlayCount = `(SELECT COUNT(*) FROM plays
+		             WHERE plays.user_id = acting.user_id
+		               AND plays.song_id = songs.song_id
+		               AND plays.skipped = 0)`
+	songSkipCount = `(SELECT COUNT(*) FROM plays
+		             WHERE plays.user_id = acting.user_id
+		               AND plays.song_id = songs.song_id
+		               AND plays.skipped <> 0)`
+	songLastPlayed = `(SELECT MAX(plays.played_at) FROM plays
+		              WHERE plays.user_id = acting.user_id
+		                AND plays.song_id = songs.song_id)`
+)
+
+// songTables joins the tables that songColumns are read from. The play counts
+// and ratings read are those of the acting user, whose ID is the argument that
+// songArgs adds to queries.
+const songTables = `
+		  (SELECT CAST(? AS INTEGER) AS user_id) AS acting
+		  CROSS JOIN song_discographies
 		  INNER JOIN songs ON song_discographies.song_id = songs.song_id
 		  INNER JOIN artists ON song_discographies.artist_id = artists.artist_id
-		  INNER JOIN genres ON songs.genre_id = genres.genre_id
-		WHERE 
-		  songs.song_id = ?`
-	err := ss.session.db.QueryRow(query, ID).Scan(
+		  LEFT JOIN albums ON song_discographies.album_id = albums.album_id
+		  LEFT JOIN genres ON songs.genre_id = genres.genre_id
+		  LEFT JOIN ratings ON ratings.user_id = acting.user_id
+		                   AND ratings.resource_type = 'songs'
+		                   AND ratings.resource_id = songs.song_id`
+
+// songArgs returns the argument of songTables for the acting user followed by
+// the given arguments.
+func (s *Session) songArgs(args ...interface{}) []interface{} {
+	return append([]interface{}{s.userID()}, args...)
+}
+
+// rowScanner is implemented by both sql.Row and sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSong reads a song from a row that selects songColumns.
+func scanSong(row rowScanner) (*library.Song, error) {
+	var s library.Song
+	err := row.Scan(
 		&s.ID,
 		&s.Attributes.FilePath,
 		&s.Attributes.FileBase,
@@ -157,15 +664,56 @@ func (ss *SongService) Song(ID string) (*library.Song, error) {
 		&s.Attributes.Name,
 		&s.Attributes.ReleaseDate,
 		&s.Attributes.TrackNumber,
-		&s.Attributes.Lyrics)
+		&s.Attributes.TrackTotal,
+		&s.Attributes.DiscNumber,
+		&s.Attributes.DiscTotal,
+		&s.Attributes.DurationInMillis,
+		&s.Attributes.Composer,
+		&s.Attributes.ComposerSort,
+		&s.Attributes.Conductor,
+		&s.Attributes.Sort,
+		&s.Attributes.Lyrics,
+		&s.Attributes.Comments,
+		&s.Attributes.DateAdded,
+		&s.Attributes.PlayCount,
+		&s.Attributes.SkipCount,
+		&s.Attributes.LastPlayed,
+		&s.Attributes.Rating,
+		&s.Attributes.Loved)
+	s.Type = "songs"
+	return &s, err
+}
+
+// scanSongs reads every song from rows that select songColumns.
+func scanSongs(rows *sql.Rows) ([]*library.Song, error) {
+	var results []*library.Song
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := scanSong(rows)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, s)
+	}
+	return results, rows.Err()
+}
+
+// Song queries the 'songs' table for a song  with the given ID and returns the
+// result along with any error.
+func (ss *SongService) Song(ID string) (*library.Song, error) {
+	query := `SELECT` + songColumns + ` FROM` + songTables + `
+		WHERE 
+		  songs.song_id = ?`
+	s, err := scanSong(ss.session.db.QueryRow(query, ss.session.songArgs(ID)...))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		ss.session.Logger.Println(err)
-		return &s, err
+		return s, err
 	}
-	return &s, nil
+	return s, nil
 }
 
 // Songs queries the 'songs' table for all songs that meet the given
@@ -179,26 +727,10 @@ func (ss *SongService) Songs(queries map[string]string) ([]*library.Song, error)
 		return results, err
 	}
 
-	for rows.Next() {
-		var s library.Song
-		err := rows.Scan(
-			&s.ID,
-			&s.Attributes.FilePath,
-			&s.Attributes.FileBase,
-			&s.Attributes.FileDir,
-			&s.Attributes.ArtistName,
-			&s.Attributes.ArtistSort,
-			&s.Attributes.GenreName,
-			&s.Attributes.Name,
-			&s.Attributes.ReleaseDate,
-			&s.Attributes.TrackNumber,
-			&s.Attributes.Lyrics)
-		s.Type = "songs"
-		if err != nil {
-			ss.session.Logger.Println(err)
-			return results, err
-		}
-		results = append(results, &s)
+	results, err = scanSongs(rows)
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return results, err
 	}
 
 	if len(results) < 1 {
@@ -208,29 +740,119 @@ func (ss *SongService) Songs(queries map[string]string) ([]*library.Song, error)
 	return results, nil
 }
 
-// Query executes a query for artists that meet the given predicate criteria and
-// returns the results along with any error.
+// SongsPage queries the 'songs' table for a page of the songs that meet the
+// given criteria, as Query reads them, and returns the result along with the
+// page and any error.
+func (ss *SongService) SongsPage(queries map[string]string) ([]*library.Song, *library.Page, error) {
+	f, err := library.ParseSongFilter(queries)
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return nil, nil, err
+	}
+	return ss.FilterSongs(f)
+}
+
+// FilterSongs queries the 'songs' table for the page of songs that the given
+// filter selects and returns the result along with the page and any error.
+func (ss *SongService) FilterSongs(f *library.SongFilter) ([]*library.Song, *library.Page, error) {
+	var results []*library.Song
+
+	p, c, err := ss.filter(f)
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return results, nil, err
+	}
+
+	total, err := countRows(ss.session.db, songTables+c.where(), ss.session.songArgs(c.args...))
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return results, nil, err
+	}
+
+	p.filter(c)
+	query := bytes.NewBufferString(`SELECT` + songColumns + p.columns() + ` FROM` + songTables + c.where())
+	args := p.order(query, c.args, 1)
+	rows, err := ss.session.db.Query(query.String(), ss.session.songArgs(args...)...)
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return results, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := scanSong(p.scanner(rows))
+		if err != nil {
+			ss.session.Logger.Println(err)
+			return results, nil, err
+		}
+		if p.more() {
+			break
+		}
+		results = append(results, s)
+	}
+	if err := rows.Err(); err != nil {
+		ss.session.Logger.Println(err)
+		return results, nil, err
+	}
+
+	page, err := p.page(total)
+	if err != nil {
+		ss.session.Logger.Println(err)
+		return results, nil, err
+	}
+	return results, page, nil
+}
+
+// Query executes a query for songs that meet the given predicate criteria,
+// which are parsed by library.ParseSongFilter, and returns the results along
+// with any error.
 func (ss *SongService) Query(predicates map[string]string) (*sql.Rows, error) {
-	query := bytes.NewBufferString(
-		`SELECT
-		  songs.song_id,
-		  songs.file_path,
-		  songs.file_base,
-		  songs.file_dir,
-		  artists.artist_name,
-		  artists.artist_sort,
-		  genres.genre_name,
-		  songs.song_name,
-		  songs.release_date,
-		  songs.track_number,
-		  songs.lyrics
-		FROM
-		  song_discographies
-		  INNER JOIN songs ON song_discographies.song_id = songs.song_id
-		  INNER JOIN artists ON song_discographies.artist_id = artists.artist_id
-		  INNER JOIN genres ON songs.genre_id = genres.genre_id`)
-	query, args := Where(query, predicates)
-	return ss.session.db.Query(query.String(), args...)
+	f, err := library.ParseSongFilter(predicates)
+	if err != nil {
+		return nil, err
+	}
+
+	p, c, err := ss.filter(f)
+	if err != nil {
+		return nil, err
+	}
+
+	p.filter(c)
+	query := bytes.NewBufferString(`SELECT` + songColumns + ` FROM` + songTables + c.where())
+	args := p.order(query, c.args, 0)
+	return ss.session.db.Query(query.String(), ss.session.songArgs(args...)...)
+}
+
+// filter returns the pager and the conditions of the given filter, which are
+// read from songTables.
+func (ss *SongService) filter(f *library.SongFilter) (*pager, *conditions, error) {
+	err := f.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := newPager(&f.Filter, ruleFields, "songs.song_id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := songConditions(f)
+	return p, c, err
+}
+
+// songConditions returns the conditions of the given song filter.
+func songConditions(f *library.SongFilter) (*conditions, error) {
+	c := &conditions{}
+	if len(f.ArtistID) > 0 {
+		c.add(`artists.artist_id = ?`, f.ArtistID)
+	}
+	if len(f.AlbumID) > 0 {
+		c.add(`albums.album_id = ?`, f.AlbumID)
+	}
+	if len(f.GenreID) > 0 {
+		c.add(`genres.genre_id = ?`, f.GenreID)
+	}
+	return c, c.filter(&f.Filter, "songs", ruleFields)
 }
 
 // Close closes all open statements.
@@ -241,7 +863,43 @@ func (ss *SongService) Close() error {
 			ss.session.Logger.Println(err)
 			return err
 		}
+		ss.insert = nil
 	}
 
 	return nil
 }
+
+// SongContext calls Song within the given context.
+func (ss *SongService) SongContext(ctx context.Context, ID string) (*library.Song, error) {
+	return ss.session.bind(ctx).songService.Song(ID)
+}
+
+// SongsContext calls Songs within the given context.
+func (ss *SongService) SongsContext(ctx context.Context, queries map[string]string) ([]*library.Song, error) {
+	return ss.session.bind(ctx).songService.Songs(queries)
+}
+
+// SongsPageContext calls SongsPage within the given context.
+func (ss *SongService) SongsPageContext(ctx context.Context, queries map[string]string) ([]*library.Song, *library.Page, error) {
+	return ss.session.bind(ctx).songService.SongsPage(queries)
+}
+
+// FilterSongsContext calls FilterSongs within the given context.
+func (ss *SongService) FilterSongsContext(ctx context.Context, f *library.SongFilter) ([]*library.Song, *library.Page, error) {
+	return ss.session.bind(ctx).songService.FilterSongs(f)
+}
+
+// CreateSongContext calls CreateSong within the given context.
+func (ss *SongService) CreateSongContext(ctx context.Context, sa *library.SongAttributes) error {
+	return ss.session.bind(ctx).songService.CreateSong(sa)
+}
+
+// UpdateSongContext calls UpdateSong within the given context.
+func (ss *SongService) UpdateSongContext(ctx context.Context, ID string, sa *library.SongAttributes) error {
+	return ss.session.bind(ctx).songService.UpdateSong(ID, sa)
+}
+
+// DeleteSongContext calls DeleteSong within the given context.
+func (ss *SongService) DeleteSongContext(ctx context.Context, ID string) error {
+	return ss.session.bind(ctx).songService.DeleteSong(ID)
+}
@@ -0,0 +1,142 @@
+package sqlite
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// TestUpdateSong checks that an update changes only the given attributes of a
+// song, creates the artist it names and deletes the artist left without songs.
+func TestUpdateSong(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	ID := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'Two'`)
+
+	err := ls.Session.SongService().UpdateSong(ID, &library.SongAttributes{Name: "Deux", ArtistName: "Cat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ls.Session.SongService().Song(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Attributes.Name != "Deux" || s.Attributes.ArtistName != "Cat" || s.Attributes.GenreName != "Rock" || s.Attributes.TrackNumber != "2" {
+		t.Errorf("updated song has attributes %+v, want Deux by Cat with its genre and track kept", s.Attributes)
+	}
+
+	err = ls.Session.SongService().UpdateSong(ID, &library.SongAttributes{ArtistName: "Ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := queryTestInt(t, ls, `SELECT COUNT(*) FROM artists WHERE artist_name = 'Cat'`); n != 0 {
+		t.Errorf("artists has %d rows for Cat, want the artist left without songs deleted", n)
+	}
+
+	err = ls.Session.SongService().UpdateSong("999", &library.SongAttributes{Name: "None"})
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("UpdateSong of an unknown song returned %v, want ErrNotFound", err)
+	}
+}
+
+// TestDeleteSong checks that deleting the last song of an artist deletes the
+// artist along with the album and genre left without songs, and that the next
+// scan adds the song again.
+func TestDeleteSong(t *testing.T) {
+	ls := openTestService(t)
+	dir := scanTestLibrary(t, ls)
+	ID := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'Three'`)
+
+	err := ls.Session.SongService().DeleteSong(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM songs`:                                    2,
+		`SELECT COUNT(*) FROM song_discographies WHERE song_id = ` + ID: 0,
+		`SELECT COUNT(*) FROM artists WHERE artist_name = 'Bob'`:        0,
+		`SELECT COUNT(*) FROM albums WHERE album_name = 'Second'`:       0,
+		`SELECT COUNT(*) FROM album_discographies`:                      1,
+		`SELECT COUNT(*) FROM genres WHERE genre_name = 'Jazz'`:         0,
+		`SELECT COUNT(*) FROM artists WHERE artist_name = 'Ann'`:        1,
+	} {
+		if n := queryTestInt(t, ls, query); n != want {
+			t.Errorf("%s = %d, want %d", query, n, want)
+		}
+	}
+
+	err = ls.Session.SongService().DeleteSong(ID)
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("DeleteSong of a deleted song returned %v, want ErrNotFound", err)
+	}
+
+	report, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 1 {
+		t.Errorf("rescan added %d songs, want the deleted song", report.Added)
+	}
+}
+
+// TestScanStoresSongFields checks that a scan stores every field read from the
+// tags of a file, and that songs are read with them.
+func TestScanStoresSongFields(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "1.mp3"),
+		"title", "Symphony No. 5", "titleSort", "Symphony 5",
+		"artist", "Orchestra", "album", "Symphonies", "year", "1808",
+		"track", "3", "trackTotal", "4", "disc", "1", "discTotal", "2",
+		"duration", "7m20.5s",
+		"composer", "Ludwig van Beethoven", "composerSort", "Beethoven, Ludwig van",
+		"conductor", "Carlos Kleiber", "comment", "Remastered")
+
+	ls := openTestService(t)
+	_, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	songs, err := ls.Session.SongService().Songs(map[string]string{})
+	if err != nil || len(songs) != 1 {
+		t.Fatalf("Songs found %d songs (%v), want 1", len(songs), err)
+	}
+
+	got := songs[0].Attributes
+	want := library.SongAttributes{
+		Name:             "Symphony No. 5",
+		Sort:             "Symphony 5",
+		TrackNumber:      "3",
+		TrackTotal:       "4",
+		DiscNumber:       "1",
+		DiscTotal:        "2",
+		DurationInMillis: 440500,
+		Composer:         "Ludwig van Beethoven",
+		ComposerSort:     "Beethoven, Ludwig van",
+		Conductor:        "Carlos Kleiber",
+		Comments:         "Remastered",
+	}
+	for name, values := range map[string][2]interface{}{
+		"name":          {got.Name, want.Name},
+		"sort name":     {got.Sort, want.Sort},
+		"track number":  {got.TrackNumber, want.TrackNumber},
+		"track total":   {got.TrackTotal, want.TrackTotal},
+		"disc number":   {got.DiscNumber, want.DiscNumber},
+		"disc total":    {got.DiscTotal, want.DiscTotal},
+		"duration":      {got.DurationInMillis, want.DurationInMillis},
+		"composer":      {got.Composer, want.Composer},
+		"composer sort": {got.ComposerSort, want.ComposerSort},
+		"conductor":     {got.Conductor, want.Conductor},
+		"comments":      {got.Comments, want.Comments},
+	} {
+		if values[0] != values[1] {
+			t.Errorf("song has %s %v, want %v", name, values[0], values[1])
+		}
+	}
+
+	s, err := ls.Session.SongService().Song(songs[0].ID)
+	if err != nil || s.Attributes != got {
+		t.Errorf("Song returned %+v (%v), want the attributes read by Songs", s, err)
+	}
+}
@@ -2,47 +2,122 @@ package sqlite
 
 import (
 	"bytes"
-	"fmt"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jeremybouzigard/library"
 
 	_ "github.com/mattn/go-sqlite3" // Registers database driver.
 )
 
-// Where appends WHERE clauses to the query using the given predicates.
+// Where appends WHERE clauses to the query using the given predicates, which
+// are artistID, albumID, genreID, minRating and loved, and returns the query
+// along with the arguments of the clauses.
+//
+// Deprecated: Use the filters of the services, such as FilterSongs, instead.
 func Where(query *bytes.Buffer, predicates map[string]string) (*bytes.Buffer, []interface{}) {
-	args := []interface{}{}
-
-	artistID := predicates["artistID"]
-	if len(artistID) > 0 {
-		if len(args) > 0 {
-			query.WriteString(` AND artists.artist_id = ?`)
-		} else {
-			query.WriteString(` WHERE artists.artist_id = ?`)
-		}
-		args = append(args, artistID)
+	f := &library.SongFilter{
+		ArtistID: predicates["artistID"],
+		AlbumID:  predicates["albumID"],
+		GenreID:  predicates["genreID"],
+	}
+	if minRating, err := strconv.ParseFloat(predicates["minRating"], 64); err == nil {
+		f.MinRating = minRating
+	}
+	if loved := predicates["loved"]; len(loved) > 0 {
+		isLoved := loved == "true" || loved == "1"
+		f.Loved = &isLoved
 	}
 
-	albumID := predicates["albumID"]
-	if len(albumID) > 0 {
-		if len(args) > 0 {
-			query.WriteString(` AND albums.album_id = ?`)
-		} else {
-			query.WriteString(` WHERE albums.album_id = ?`)
+	// Without tags or conditions, the filter cannot fail to compile.
+	c, _ := songConditions(f)
+	query.WriteString(c.where())
+	return query, c.args
+}
+
+// conditions collects the conditions of a WHERE clause along with their
+// arguments.
+type conditions struct {
+	exprs []string
+	args  []interface{}
+}
+
+// add adds the given condition along with its arguments.
+func (c *conditions) add(expr string, args ...interface{}) {
+	c.exprs = append(c.exprs, expr)
+	c.args = append(c.args, args...)
+}
+
+// filter adds the conditions of the given filter that apply to resources of
+// every type, comparing the given fields. The ratings of the resources must be
+// joined as 'ratings'.
+func (c *conditions) filter(f *library.Filter, resourceType string, fields map[string]ruleField) error {
+	if f.MinRating > 0 {
+		c.add(`IFNULL(ratings.rating, 0) >= ?`, f.MinRating)
+	}
+	if f.Loved != nil {
+		c.add(`IFNULL(ratings.loved, 0) = ?`, *f.Loved)
+	}
+	if len(f.Tags) > 0 {
+		clause, args, err := tagFilter(f.Tags, resourceType)
+		if err != nil {
+			return err
 		}
-		args = append(args, albumID)
+		c.add(clause, args...)
 	}
-
-	genreID := predicates["genreID"]
-	if len(genreID) > 0 {
-		if len(args) > 0 {
-			query.WriteString(` AND genres.genre_id = ?`)
-		} else {
-			query.WriteString(` WHERE genres.genre_id = ?`)
+	for _, condition := range f.Conditions {
+		clause, args, err := compileCondition(condition, fields)
+		if err != nil {
+			return err
 		}
-		args = append(args, genreID)
+		c.add(clause, args...)
 	}
+	return nil
+}
+
+// where returns the WHERE clause of the conditions, or an empty string if
+// there are none.
+func (c *conditions) where() string {
+	if len(c.exprs) == 0 {
+		return ``
+	}
+	return ` WHERE ` + strings.Join(c.exprs, ` AND `)
+}
 
-	fmt.Println(query)
-	return query, args
+// resourceTables maps the resource types that may be rated and tagged onto the
+// tables and ID columns of their resources.
+var resourceTables = map[string][2]string{
+	"songs":   {"songs", "song_id"},
+	"albums":  {"albums", "album_id"},
+	"artists": {"artists", "artist_id"},
+}
+
+// nullable returns the given value, or nil if the value is empty so that it is
+// stored as NULL.
+func nullable(value string) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	return value
+}
+
+// now returns the current time formatted for storage.
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// found returns library.ErrNotFound if the given result affected no rows.
+func found(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return library.ErrNotFound
+	}
+	return nil
 }
 
 // Select executes the given query and returns the results represented by a
@@ -0,0 +1,346 @@
+package sqlite
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeremybouzigard/library"
+	"github.com/jeremybouzigard/metadata/pkg/metadata"
+)
+
+func init() {
+	readMetadata = readTestMetadata
+}
+
+// readTestMetadata reads the tags of a file written by writeTestFile. A file
+// with an "error" tag fails to be read with the tag as its error.
+func readTestMetadata(ms *metadata.Service, path string) (*metadata.Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := &metadata.Metadata{}
+	fields := map[string]*string{
+		"title":        &m.Title,
+		"titleSort":    &m.TitleSort,
+		"artist":       &m.Artist,
+		"album":        &m.Album,
+		"genre":        &m.Genre,
+		"year":         &m.Year,
+		"track":        &m.Track,
+		"trackTotal":   &m.TrackTotal,
+		"disc":         &m.Disc,
+		"discTotal":    &m.DiscTotal,
+		"composer":     &m.Composer,
+		"composerSort": &m.ComposerSort,
+		"conductor":    &m.Conductor,
+		"comment":      &m.Comment,
+		"rating":       &m.Rating,
+	}
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		kv := strings.SplitN(lines.Text(), "=", 2)
+		if kv[0] == "error" && len(kv) == 2 {
+			return nil, errors.New(kv[1])
+		}
+		if kv[0] == "duration" && len(kv) == 2 {
+			m.Duration, err = time.ParseDuration(kv[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		if field, ok := fields[kv[0]]; ok && len(kv) == 2 {
+			*field = kv[1]
+		}
+	}
+	return m, lines.Err()
+}
+
+// writeTestFile writes a file with the given tags, given as alternating keys
+// and values, that readTestMetadata reads. Files with the same path and tags
+// have the same content.
+func writeTestFile(t *testing.T, path string, tags ...string) {
+	t.Helper()
+
+	var content strings.Builder
+	fmt.Fprintf(&content, "path=%s\n", filepath.Base(path))
+	for i := 0; i+1 < len(tags); i += 2 {
+		fmt.Fprintf(&content, "%s=%s\n", tags[i], tags[i+1])
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = os.WriteFile(path, []byte(content.String()), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dumpLibrary returns the rows of every table of the library, leaving out the
+// search index and the columns that record when rows were written.
+func dumpLibrary(t *testing.T, ls *Service) map[string][]string {
+	t.Helper()
+
+	dump := make(map[string][]string)
+	tables, err := ls.Session.db.Query(
+		`SELECT name FROM sqlite_master
+		  WHERE type = 'table' AND name NOT LIKE '%search%' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for tables.Next() {
+		var name string
+		tables.Scan(&name)
+		names = append(names, name)
+	}
+	tables.Close()
+
+	for _, name := range names {
+		rows, err := ls.Session.db.Query(`SELECT * FROM ` + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		columns, _ := rows.Columns()
+		for rows.Next() {
+			values := make([]sql.NullString, len(columns))
+			dest := make([]interface{}, len(columns))
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			err := rows.Scan(dest...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var row []string
+			for i, c := range columns {
+				switch c {
+				case "date_added", "last_scanned", "date_rated", "date_created", "date_modified":
+					continue
+				}
+				row = append(row, c+"="+values[i].String)
+			}
+			dump[name] = append(dump[name], strings.Join(row, " "))
+		}
+		rows.Close()
+		sort.Strings(dump[name])
+	}
+	return dump
+}
+
+// openTestService opens a new library in a temporary directory, which is
+// closed when the test ends.
+func openTestService(t *testing.T) *Service {
+	t.Helper()
+
+	ls := NewService(filepath.Join(t.TempDir(), "library.db"))
+	ls.client.Logger = log.New(io.Discard, "", 0)
+	err := ls.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls.Session.Logger = ls.client.Logger
+	t.Cleanup(func() { ls.Close() })
+	return &ls
+}
+
+// addTestSong adds a song along with its artist, album and genre to the
+// library, as a scan would.
+func addTestSong(t *testing.T, ls *Service, song *library.SongAttributes, album *library.AlbumAttributes) {
+	t.Helper()
+
+	s := ls.Session
+	err := s.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if s.tx != nil {
+			s.RollbackTx()
+		}
+	}()
+
+	if song.FileBase == "" {
+		song.FileBase = filepath.Base(song.FilePath)
+		song.FileDir = filepath.Dir(song.FilePath)
+	}
+	album.ArtistName, album.ArtistSort = song.ArtistName, song.ArtistSort
+	album.GenreName = song.GenreName
+
+	steps := []func() error{
+		func() error { return s.genreService.CreateGenre(&library.GenreAttributes{Name: song.GenreName}) },
+		func() error {
+			return s.artistService.CreateArtist(&library.ArtistAttributes{Name: song.ArtistName, Sort: song.ArtistSort})
+		},
+		func() error { return s.albumService.CreateAlbum(album) },
+		func() error { return s.songService.CreateSong(song) },
+		func() error { return s.AlbumDiscogService.CreateAlbumDiscog(album) },
+		func() error { return s.SongDiscogService.CreateSongDiscog(song, album) },
+		s.CommitTx,
+	}
+	for _, step := range steps {
+		err := step()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// scanTestLibrary scans a library of three songs: "One" and "Two" by Ann on
+// the Rock album "First", and "Three" by Bob on the Jazz album "Second". It
+// returns the scanned directory.
+func scanTestLibrary(t *testing.T, ls *Service) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "1.mp3"), "title", "One", "artist", "Ann", "album", "First", "genre", "Rock", "track", "1")
+	writeTestFile(t, filepath.Join(dir, "2.mp3"), "title", "Two", "artist", "Ann", "album", "First", "genre", "Rock", "track", "2")
+	writeTestFile(t, filepath.Join(dir, "3.mp3"), "title", "Three", "artist", "Bob", "album", "Second", "genre", "Jazz", "track", "1")
+	_, err := ls.Scan(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// queryTestInt returns the integer selected by the given query, such as a
+// count of rows.
+func queryTestInt(t *testing.T, ls *Service, query string, args ...interface{}) int {
+	t.Helper()
+
+	var n int
+	err := ls.Session.db.QueryRow(query, args...).Scan(&n)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+// queryTestID returns the ID selected by the given query.
+func queryTestID(t *testing.T, ls *Service, query string, args ...interface{}) string {
+	t.Helper()
+	return fmt.Sprint(queryTestInt(t, ls, query, args...))
+}
+
+// TestFilterInjection checks that hostile filter parameters are either
+// refused or compared as plain values, and leave the library untouched.
+func TestFilterInjection(t *testing.T) {
+	ls := openTestService(t)
+	addTestSong(t, ls,
+		&library.SongAttributes{FilePath: "/music/a.mp3", Name: "Alpha", ArtistName: "Ann", GenreName: "Rock", ReleaseDate: "1999"},
+		&library.AlbumAttributes{Name: "First"})
+	addTestSong(t, ls,
+		&library.SongAttributes{FilePath: "/music/b.mp3", Name: "Beta", ArtistName: "Bob", GenreName: "Jazz", ReleaseDate: "2004"},
+		&library.AlbumAttributes{Name: "Second"})
+
+	songs, _, err := ls.Session.SongService().SongsPage(map[string]string{"filter[name][eq]": "alpha"})
+	if err != nil || len(songs) != 1 {
+		t.Fatalf("SongsPage found %d songs (%v), want 1", len(songs), err)
+	}
+
+	hostileCursor := base64.RawURLEncoding.EncodeToString([]byte(`["0 OR 1=1; DROP TABLE songs"]`))
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		wantErr bool
+	}{
+		{"field quote", map[string]string{"filter[name'--][eq]": "x"}, true},
+		{"field expression", map[string]string{"filter[1=1) OR (1][eq]": "x"}, true},
+		{"empty field", map[string]string{"filter[][eq]": "x"}, true},
+		{"unclosed field", map[string]string{"filter[year": "1999"}, true},
+		{"unclosed operator", map[string]string{"filter[year][eq": "1999"}, true},
+		{"extra operator", map[string]string{"filter[year][eq][gt]": "1999"}, true},
+		{"trailing text", map[string]string{"filter[year]x": "1999"}, true},
+		{"operator quote", map[string]string{"filter[name][eq'--]": "x"}, true},
+		{"unknown operator", map[string]string{"filter[name][like]": "%"}, true},
+		{"value quote", map[string]string{"filter[name][eq]": "x' OR 1=1 --"}, false},
+		{"value quote no operator", map[string]string{"filter[name]": "x' OR '1'='1"}, false},
+		{"value percent", map[string]string{"filter[name][contains]": "%"}, false},
+		{"value underscore", map[string]string{"filter[name][contains]": "_"}, false},
+		{"value backslash", map[string]string{"filter[name][contains]": `\`}, false},
+		{"value percent prefix", map[string]string{"filter[name][prefix]": "%a"}, false},
+		{"value underscore suffix", map[string]string{"filter[name][suffix]": "_a"}, false},
+		{"value list quote", map[string]string{"filter[genre][in]": "x') OR ('1'='1"}, false},
+		{"value number", map[string]string{"filter[year][gt]": "1 OR 1=1"}, true},
+		{"value date", map[string]string{"filter[releaseDate][eq]": "1999' OR '1'='1"}, false},
+		{"sort statement", map[string]string{"sort": "name; DROP TABLE songs"}, true},
+		{"sort expression", map[string]string{"sort": "(SELECT 1)"}, true},
+		{"cursor garbage", map[string]string{"cursor": "not a cursor"}, true},
+		{"cursor json", map[string]string{"cursor": base64.RawURLEncoding.EncodeToString([]byte(`{"a":1}`))}, true},
+		{"cursor length", map[string]string{"cursor": base64.RawURLEncoding.EncodeToString([]byte(`[1, 2, 3]`))}, true},
+		{"cursor value", map[string]string{"cursor": hostileCursor}, false},
+		{"tags", map[string]string{"tags": "x' OR 1=1 --"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			songs, _, err := ls.Session.SongService().SongsPage(tt.params)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("SongsPage(%v) returned %d songs, want an error", tt.params, len(songs))
+				}
+			} else if err != nil {
+				t.Errorf("SongsPage(%v) returned error %v, want no songs", tt.params, err)
+			} else if len(songs) > 0 {
+				t.Errorf("SongsPage(%v) returned %d songs, want none", tt.params, len(songs))
+			}
+
+			_, _, err = ls.Session.AlbumService().AlbumsPage(tt.params)
+			if tt.wantErr && err == nil {
+				t.Errorf("AlbumsPage(%v) returned no error", tt.params)
+			}
+
+			for table, want := range map[string]int{"songs": 2, "albums": 2, "artists": 2, "genres": 2} {
+				var n int
+				err := ls.Session.db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n)
+				if err != nil || n != want {
+					t.Fatalf("table %s has %d rows (%v), want %d", table, n, err, want)
+				}
+			}
+		})
+	}
+}
+
+// TestWhere checks that the deprecated Where compiles the predicates it has
+// always accepted.
+func TestWhere(t *testing.T) {
+	tests := []struct {
+		predicates map[string]string
+		wantQuery  string
+		wantArgs   []interface{}
+	}{
+		{map[string]string{}, ``, nil},
+		{map[string]string{"artistID": "1", "genreID": "3"}, ` WHERE artists.artist_id = ? AND genres.genre_id = ?`, []interface{}{"1", "3"}},
+		{map[string]string{"albumID": "2", "minRating": "4"}, ` WHERE albums.album_id = ? AND IFNULL(ratings.rating, 0) >= ?`, []interface{}{"2", 4.0}},
+		{map[string]string{"minRating": "high"}, ``, nil},
+		{map[string]string{"loved": "1"}, ` WHERE IFNULL(ratings.loved, 0) = ?`, []interface{}{true}},
+		{map[string]string{"loved": "no"}, ` WHERE IFNULL(ratings.loved, 0) = ?`, []interface{}{false}},
+	}
+
+	for _, tt := range tests {
+		query, args := Where(bytes.NewBufferString(`SELECT 1`), tt.predicates)
+		if query.String() != `SELECT 1`+tt.wantQuery {
+			t.Errorf("Where(%v) query = %q, want %q", tt.predicates, query, `SELECT 1`+tt.wantQuery)
+		}
+		if fmt.Sprint(args) != fmt.Sprint(tt.wantArgs) {
+			t.Errorf("Where(%v) args = %v, want %v", tt.predicates, args, tt.wantArgs)
+		}
+	}
+}
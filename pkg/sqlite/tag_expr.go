@@ -0,0 +1,166 @@
+package sqlite
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tagFilter compiles the given tag expression into an SQL expression that
+// holds for resources of the given type whose tags satisfy it, and returns it
+// along with its arguments. Tag expressions combine tag names with AND, OR,
+// NOT and parentheses, as in "workout AND NOT (slow OR \"needs retag\")".
+// Names containing spaces or parentheses are quoted. AND binds more tightly
+// than OR.
+func tagFilter(expr string, resourceType string) (string, []interface{}, error) {
+	table, ok := resourceTables[resourceType]
+	if !ok {
+		return "", nil, fmt.Errorf("resources of type %q cannot be tagged", resourceType)
+	}
+
+	tokens, err := tokenizeTags(expr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p := &tagParser{
+		tokens:       tokens,
+		resourceType: resourceType,
+		column:       table[0] + "." + table[1],
+		query:        &bytes.Buffer{}}
+	err = p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q in tag expression", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return p.query.String(), p.args, nil
+}
+
+// tagToken represents a word of a tag expression. Quoted tokens are always
+// tag names.
+type tagToken struct {
+	text   string
+	quoted bool
+}
+
+// is reports whether the token is the given operator or parenthesis.
+func (t tagToken) is(op string) bool {
+	return !t.quoted && strings.EqualFold(t.text, op)
+}
+
+// tokenizeTags splits the given tag expression into tokens.
+func tokenizeTags(expr string) ([]tagToken, error) {
+	var tokens []tagToken
+
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, tagToken{text: string(r)})
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				j++
+			}
+			if j == len(runes) {
+				return nil, fmt.Errorf("unterminated quote in tag expression")
+			}
+			tokens = append(tokens, tagToken{text: string(runes[i+1 : j]), quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && runes[j] != '(' && runes[j] != ')' && runes[j] != '"' {
+				j++
+			}
+			tokens = append(tokens, tagToken{text: string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// tagParser compiles tokens of a tag expression by recursive descent.
+type tagParser struct {
+	tokens       []tagToken
+	pos          int
+	resourceType string
+	column       string
+	query        *bytes.Buffer
+	args         []interface{}
+}
+
+// accept consumes the next token if it is the given operator.
+func (p *tagParser) accept(op string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].is(op) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// or compiles terms joined by OR.
+func (p *tagParser) or() error {
+	p.query.WriteString(`(`)
+	err := p.and()
+	for err == nil && p.accept("OR") {
+		p.query.WriteString(` OR `)
+		err = p.and()
+	}
+	p.query.WriteString(`)`)
+	return err
+}
+
+// and compiles factors joined by AND.
+func (p *tagParser) and() error {
+	err := p.not()
+	for err == nil && p.accept("AND") {
+		p.query.WriteString(` AND `)
+		err = p.not()
+	}
+	return err
+}
+
+// not compiles a tag name or parenthesized expression, negated by any NOT
+// before it.
+func (p *tagParser) not() error {
+	if p.accept("NOT") {
+		p.query.WriteString(`NOT `)
+		return p.not()
+	}
+
+	if p.accept("(") {
+		err := p.or()
+		if err != nil {
+			return err
+		}
+		if !p.accept(")") {
+			return fmt.Errorf("missing ) in tag expression")
+		}
+		return nil
+	}
+
+	if p.pos == len(p.tokens) {
+		return fmt.Errorf("tag expression ends early")
+	}
+	t := p.tokens[p.pos]
+	if t.is(")") || t.is("AND") || t.is("OR") {
+		return fmt.Errorf("unexpected %q in tag expression", t.text)
+	}
+	p.pos++
+
+	p.query.WriteString(`EXISTS (SELECT 1
+		  FROM taggings
+		  INNER JOIN tags ON taggings.tag_id = tags.tag_id
+		 WHERE taggings.resource_type = ?
+		   AND taggings.resource_id = ` + p.column + `
+		   AND tags.tag_name = ?)`)
+	p.args = append(p.args, p.resourceType, t.text)
+	return nil
+}
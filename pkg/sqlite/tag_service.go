@@ -0,0 +1,240 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// TagService manages interactions with the tag data source.
+type TagService struct {
+	session *Session
+}
+
+// NewTagService returns a new instance of a TagService that operates within
+// the given session.
+func NewTagService(s *Session) TagService {
+	service := TagService{session: s}
+	return service
+}
+
+// CreateTable creates the 'tags' and 'taggings' tables and returns any errors.
+func (service *TagService) CreateTable() (sql.Result, error) {
+	create :=
+		`CREATE TABLE IF NOT EXISTS tags (
+			tag_id   INTEGER PRIMARY KEY,
+			tag_name TEXT    UNIQUE NOT NULL COLLATE NOCASE
+		)`
+	result, err := service.session.tx.Exec(create)
+	if err != nil {
+		return result, err
+	}
+
+	create =
+		`CREATE TABLE IF NOT EXISTS taggings (
+			tag_id        INTEGER NOT NULL,
+			resource_type TEXT    NOT NULL,
+			resource_id   INTEGER NOT NULL,
+			PRIMARY KEY('tag_id','resource_type','resource_id'),
+			FOREIGN KEY('tag_id') REFERENCES tags('tag_id')
+		)`
+	result, err = service.session.tx.Exec(create)
+	if err != nil {
+		return result, err
+	}
+
+	index := `CREATE INDEX IF NOT EXISTS taggings_resource ON taggings (resource_type, resource_id)`
+	return service.session.tx.Exec(index)
+}
+
+// DropTable drops the 'tags' and 'taggings' tables and returns any errors.
+func (service *TagService) DropTable() (sql.Result, error) {
+	drop := `DROP TABLE IF EXISTS taggings`
+	result, err := service.session.tx.Exec(drop)
+	if err != nil {
+		return result, err
+	}
+
+	drop = `DROP TABLE IF EXISTS tags`
+	return service.session.tx.Exec(drop)
+}
+
+// AddTag attaches the tag with the given name to the resource of the given type
+// and ID, creating the tag if it does not exist.
+func (service *TagService) AddTag(resourceType string, ID string, name string) error {
+	table, ok := resourceTables[resourceType]
+	if !ok {
+		return fmt.Errorf("resources of type %q cannot be tagged", resourceType)
+	}
+
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return fmt.Errorf("tag name is required")
+	}
+
+	return service.session.inTx(func() error {
+		_, err := service.session.tx.Exec(`INSERT OR IGNORE INTO tags (tag_name) VALUES (?)`, name)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+
+		insert := fmt.Sprintf(
+			`INSERT OR IGNORE INTO taggings
+			                       (tag_id,
+			                        resource_type,
+			                        resource_id)
+			                SELECT (SELECT tag_id FROM tags WHERE tag_name = ?),
+			                       ?,
+			                       %[2]s
+			                  FROM %[1]s
+			                 WHERE %[2]s = ?`, table[0], table[1])
+		_, err = service.session.tx.Exec(insert, name, resourceType, ID)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+
+		// The resource exists if it has the tag, whether or not it was added.
+		var n int
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s = ?`, table[0], table[1])
+		err = service.session.tx.QueryRow(query, ID).Scan(&n)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		if n == 0 {
+			return library.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// RemoveTag detaches the tag with the given name from the resource of the given
+// type and ID. Tags left without resources are deleted.
+func (service *TagService) RemoveTag(resourceType string, ID string, name string) error {
+	return service.session.inTx(func() error {
+		remove :=
+			`DELETE FROM taggings
+			       WHERE resource_type = ?
+			         AND resource_id = ?
+			         AND tag_id = (SELECT tag_id FROM tags WHERE tag_name = ?)`
+		result, err := service.session.tx.Exec(remove, resourceType, ID, strings.TrimSpace(name))
+		if err == nil {
+			err = found(result)
+		}
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		return service.pruneTags()
+	})
+}
+
+// Tags queries the 'tags' table for all tags, along with the number of
+// resources each is attached to, and returns the result along with any error.
+func (service *TagService) Tags() ([]*library.Tag, error) {
+	query :=
+		`SELECT tags.tag_id,
+		        tags.tag_name,
+		        COUNT(taggings.tag_id)
+		   FROM tags
+		        LEFT JOIN taggings ON taggings.tag_id = tags.tag_id
+		  GROUP BY tags.tag_id
+		  ORDER BY tags.tag_name`
+	return service.query(query)
+}
+
+// ResourceTags queries the 'taggings' table for the tags attached to the
+// resource of the given type and ID, along with the number of resources each is
+// attached to, and returns the result along with any error.
+func (service *TagService) ResourceTags(resourceType string, ID string) ([]*library.Tag, error) {
+	query :=
+		`SELECT tags.tag_id,
+		        tags.tag_name,
+		        (SELECT COUNT(*) FROM taggings AS t WHERE t.tag_id = tags.tag_id)
+		   FROM taggings
+		        INNER JOIN tags ON taggings.tag_id = tags.tag_id
+		  WHERE taggings.resource_type = ?
+		    AND taggings.resource_id = ?
+		  ORDER BY tags.tag_name`
+	return service.query(query, resourceType, ID)
+}
+
+// query executes the given query for tags and returns the results.
+func (service *TagService) query(query string, args ...interface{}) ([]*library.Tag, error) {
+	var results []*library.Tag
+
+	rows, err := service.session.conn().Query(query, args...)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t library.Tag
+		err := rows.Scan(
+			&t.ID,
+			&t.Attributes.Name,
+			&t.Attributes.Count)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return results, err
+		}
+		t.Type = "tags"
+		results = append(results, &t)
+	}
+	return results, rows.Err()
+}
+
+// prune deletes the taggings of resources that no longer exist, and then the
+// tags left without resources.
+func (service *TagService) prune() error {
+	for resourceType, table := range resourceTables {
+		prune := fmt.Sprintf(
+			`DELETE FROM taggings
+			       WHERE resource_type = ?
+			         AND resource_id NOT IN (SELECT %s FROM %s)`, table[1], table[0])
+		_, err := service.session.tx.Exec(prune, resourceType)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+	}
+	return service.pruneTags()
+}
+
+// pruneTags deletes tags that are not attached to any resource.
+func (service *TagService) pruneTags() error {
+	prune := `DELETE FROM tags WHERE tag_id NOT IN (SELECT tag_id FROM taggings)`
+	_, err := service.session.tx.Exec(prune)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// AddTagContext calls AddTag within the given context.
+func (service *TagService) AddTagContext(ctx context.Context, resourceType string, ID string, name string) error {
+	return service.session.bind(ctx).tagService.AddTag(resourceType, ID, name)
+}
+
+// RemoveTagContext calls RemoveTag within the given context.
+func (service *TagService) RemoveTagContext(ctx context.Context, resourceType string, ID string, name string) error {
+	return service.session.bind(ctx).tagService.RemoveTag(resourceType, ID, name)
+}
+
+// TagsContext calls Tags within the given context.
+func (service *TagService) TagsContext(ctx context.Context) ([]*library.Tag, error) {
+	return service.session.bind(ctx).tagService.Tags()
+}
+
+// ResourceTagsContext calls ResourceTags within the given context.
+func (service *TagService) ResourceTagsContext(ctx context.Context, resourceType string, ID string) ([]*library.Tag, error) {
+	return service.session.bind(ctx).tagService.ResourceTags(resourceType, ID)
+}
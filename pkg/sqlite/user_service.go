@@ -0,0 +1,193 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// UserService manages interactions with the user data source.
+type UserService struct {
+	session *Session
+}
+
+// NewUserService returns a new instance of a UserService that operates within
+// the given session.
+func NewUserService(s *Session) UserService {
+	service := UserService{session: s}
+	return service
+}
+
+// CreateTable creates the 'users' table and returns any errors.
+func (service *UserService) CreateTable() (sql.Result, error) {
+	create :=
+		`CREATE TABLE IF NOT EXISTS users (
+			user_id      INTEGER PRIMARY KEY,
+			user_name    TEXT    UNIQUE NOT NULL COLLATE NOCASE,
+			date_created TEXT
+		)`
+	return service.session.tx.Exec(create)
+}
+
+// DropTable drops the 'users' table and returns any errors.
+func (service *UserService) DropTable() (sql.Result, error) {
+	drop := `DROP TABLE IF EXISTS users`
+	return service.session.tx.Exec(drop)
+}
+
+// CreateUser inserts a new user and returns it.
+func (service *UserService) CreateUser(attributes *library.UserAttributes) (*library.User, error) {
+	if len(attributes.Name) == 0 {
+		return nil, fmt.Errorf("user name is required")
+	}
+
+	var ID int64
+	err := service.session.inTx(func() error {
+		insert := `INSERT INTO users (user_name, date_created) VALUES (?, ?)`
+		result, err := service.session.tx.Exec(insert, attributes.Name, now())
+		if err != nil {
+			return err
+		}
+
+		ID, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		service.session.Logger.Println(err)
+		return nil, err
+	}
+
+	return service.User(fmt.Sprint(ID))
+}
+
+// UpdateUser updates the user with the given ID with the given attributes.
+// Empty attributes are left unchanged.
+func (service *UserService) UpdateUser(ID string, attributes *library.UserAttributes) error {
+	return service.session.inTx(func() error {
+		update :=
+			`UPDATE users
+			    SET user_name = COALESCE(NULLIF(?, ''), user_name)
+			  WHERE user_id = ?`
+		result, err := service.session.tx.Exec(update, attributes.Name, ID)
+		if err == nil {
+			err = found(result)
+		}
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		return nil
+	})
+}
+
+// DeleteUser deletes the user with the given ID along with their playlists,
+// plays and ratings.
+func (service *UserService) DeleteUser(ID string) error {
+	return service.session.inTx(func() error {
+		deletes := []string{
+			`DELETE FROM playlist_entries
+			       WHERE playlist_id IN (SELECT playlist_id FROM playlists WHERE user_id = ?)`,
+			`DELETE FROM playlists WHERE user_id = ?`,
+			`DELETE FROM plays WHERE user_id = ?`,
+			`DELETE FROM ratings WHERE user_id = ?`,
+		}
+		for _, d := range deletes {
+			_, err := service.session.tx.Exec(d, ID)
+			if err != nil {
+				service.session.Logger.Println(err)
+				return err
+			}
+		}
+
+		result, err := service.session.tx.Exec(`DELETE FROM users WHERE user_id = ?`, ID)
+		if err == nil {
+			err = found(result)
+		}
+		if err != nil {
+			service.session.Logger.Println(err)
+			return err
+		}
+		return nil
+	})
+}
+
+// User queries the 'users' table for a user with the given ID and returns the
+// result along with any error.
+func (service *UserService) User(ID string) (*library.User, error) {
+	var u library.User
+	var dateCreated sql.NullString
+
+	query := `SELECT user_id, user_name, date_created FROM users WHERE user_id = ?`
+	err := service.session.conn().QueryRow(query, ID).Scan(
+		&u.ID,
+		&u.Attributes.Name,
+		&dateCreated)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		service.session.Logger.Println(err)
+		return nil, err
+	}
+	u.Type = "users"
+	u.Attributes.DateCreated = dateCreated.String
+	return &u, nil
+}
+
+// Users queries the 'users' table for all users and returns the result along
+// with any error.
+func (service *UserService) Users() ([]*library.User, error) {
+	var results []*library.User
+
+	query := `SELECT user_id, user_name, date_created FROM users ORDER BY user_name`
+	rows, err := service.session.conn().Query(query)
+	if err != nil {
+		service.session.Logger.Println(err)
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u library.User
+		var dateCreated sql.NullString
+		err := rows.Scan(
+			&u.ID,
+			&u.Attributes.Name,
+			&dateCreated)
+		if err != nil {
+			service.session.Logger.Println(err)
+			return results, err
+		}
+		u.Type = "users"
+		u.Attributes.DateCreated = dateCreated.String
+		results = append(results, &u)
+	}
+	return results, rows.Err()
+}
+
+// CreateUserContext calls CreateUser within the given context.
+func (service *UserService) CreateUserContext(ctx context.Context, attributes *library.UserAttributes) (*library.User, error) {
+	return service.session.bind(ctx).userService.CreateUser(attributes)
+}
+
+// UpdateUserContext calls UpdateUser within the given context.
+func (service *UserService) UpdateUserContext(ctx context.Context, ID string, attributes *library.UserAttributes) error {
+	return service.session.bind(ctx).userService.UpdateUser(ID, attributes)
+}
+
+// DeleteUserContext calls DeleteUser within the given context.
+func (service *UserService) DeleteUserContext(ctx context.Context, ID string) error {
+	return service.session.bind(ctx).userService.DeleteUser(ID)
+}
+
+// UserContext calls User within the given context.
+func (service *UserService) UserContext(ctx context.Context, ID string) (*library.User, error) {
+	return service.session.bind(ctx).userService.User(ID)
+}
+
+// UsersContext calls Users within the given context.
+func (service *UserService) UsersContext(ctx context.Context) ([]*library.User, error) {
+	return service.session.bind(ctx).userService.Users()
+}
@@ -0,0 +1,205 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// createTestUsers creates a user for each of the given names and returns the
+// IDs of the users in the same order.
+func createTestUsers(t *testing.T, ls *Service, names ...string) []string {
+	t.Helper()
+
+	var IDs []string
+	for _, name := range names {
+		u, err := ls.Session.UserService().CreateUser(&library.UserAttributes{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		IDs = append(IDs, u.ID)
+	}
+	return IDs
+}
+
+// TestUserScoping checks that the playlists, plays and ratings of a user are
+// seen only by that user, and that a session without a user sees only those
+// recorded without one.
+func TestUserScoping(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	IDs := createTestUsers(t, ls, "Alice", "Bob")
+	alice, bob := ls.WithUser(IDs[0]), ls.WithUser(IDs[1])
+	songID := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'One'`)
+
+	for _, err := range []error{
+		alice.Session.RatingService().Rate("songs", songID, 5),
+		alice.Session.RatingService().Love("songs", songID, true),
+		bob.Session.RatingService().Rate("songs", songID, 2),
+		ls.Session.RatingService().Rate("songs", songID, 1),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := alice.Session.PlayService().RecordPlay(&library.PlayAttributes{SongID: songID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := alice.Session.PlaylistService().CreatePlaylist(&library.PlaylistAttributes{Name: "Alice's"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		ls        *Service
+		rating    float64
+		loved     bool
+		plays     int
+		playlists int
+	}{
+		{"Alice", alice, 5, true, 1, 1},
+		{"Bob", bob, 2, false, 0, 0},
+		{"no user", ls, 1, false, 0, 0},
+	}
+	for _, tt := range tests {
+		s, err := tt.ls.Session.SongService().Song(songID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Attributes.Rating != tt.rating || s.Attributes.Loved != tt.loved || s.Attributes.PlayCount != tt.plays {
+			t.Errorf("%s sees rating %v, loved %v and %d plays, want %v, %v and %d",
+				tt.name, s.Attributes.Rating, s.Attributes.Loved, s.Attributes.PlayCount, tt.rating, tt.loved, tt.plays)
+		}
+
+		songs, err := tt.ls.Session.SongService().Songs(map[string]string{"minRating": "4"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[bool]int{true: 1}[tt.rating >= 4]; len(songs) != want {
+			t.Errorf("%s found %d songs rated at least 4, want %d", tt.name, len(songs), want)
+		}
+
+		playlists, err := tt.ls.Session.PlaylistService().Playlists()
+		if err != nil || len(playlists) != tt.playlists {
+			t.Errorf("%s sees %d playlists (%v), want %d", tt.name, len(playlists), err, tt.playlists)
+		}
+	}
+
+	other, err := bob.Session.PlaylistService().Playlist(p.ID)
+	if err != nil || other != nil {
+		t.Errorf("Bob read the playlist of Alice: %+v (%v)", other, err)
+	}
+	for name, err := range map[string]error{
+		"UpdatePlaylist": bob.Session.PlaylistService().UpdatePlaylist(p.ID, &library.PlaylistAttributes{Name: "Bob's"}),
+		"InsertSong":     bob.Session.PlaylistService().InsertSong(p.ID, songID, -1),
+		"DeletePlaylist": bob.Session.PlaylistService().DeletePlaylist(p.ID),
+	} {
+		if !errors.Is(err, library.ErrNotFound) {
+			t.Errorf("%s by Bob of the playlist of Alice returned %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+// TestUnknownUser checks that nothing is recorded for a user who does not
+// exist, whether the user acts in the session or in the context.
+func TestUnknownUser(t *testing.T) {
+	ls := openTestService(t)
+	dir := scanTestLibrary(t, ls)
+	songID := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'One'`)
+
+	for name, s := range map[string]*Session{
+		"WithUser":    ls.Session.WithUser("42"),
+		"WithContext": ls.Session.WithContext(library.ContextWithUser(context.Background(), "42")),
+	} {
+		_, err := s.PlaylistService().CreatePlaylist(&library.PlaylistAttributes{Name: "Mix"})
+		if !errors.Is(err, library.ErrNotFound) {
+			t.Errorf("CreatePlaylist in a %s session returned %v, want ErrNotFound", name, err)
+		}
+		_, err = s.PlayService().RecordPlay(&library.PlayAttributes{SongID: songID})
+		if !errors.Is(err, library.ErrNotFound) {
+			t.Errorf("RecordPlay in a %s session returned %v, want ErrNotFound", name, err)
+		}
+		err = s.RatingService().Rate("songs", songID, 4)
+		if !errors.Is(err, library.ErrNotFound) {
+			t.Errorf("Rate in a %s session returned %v, want ErrNotFound", name, err)
+		}
+		err = s.RatingService().Love("songs", songID, true)
+		if !errors.Is(err, library.ErrNotFound) {
+			t.Errorf("Love in a %s session returned %v, want ErrNotFound", name, err)
+		}
+		_, err = s.scan(context.Background(), dir, "", nil)
+		if !errors.Is(err, library.ErrNotFound) {
+			t.Errorf("a scan in a %s session returned %v, want ErrNotFound", name, err)
+		}
+	}
+
+	ctx := library.ContextWithUser(context.Background(), "42")
+	_, err := ls.Session.PlaylistService().CreatePlaylistContext(ctx, &library.PlaylistAttributes{Name: "Mix"})
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("CreatePlaylistContext for an unknown context user returned %v, want ErrNotFound", err)
+	}
+
+	for _, table := range []string{"playlists", "plays", "ratings"} {
+		if n := queryTestInt(t, ls, `SELECT COUNT(*) FROM `+table); n != 0 {
+			t.Errorf("%s holds %d rows, want none", table, n)
+		}
+	}
+}
+
+// TestDeleteUser checks that deleting a user deletes their playlists, plays
+// and ratings and leaves those of other users.
+func TestDeleteUser(t *testing.T) {
+	ls := openTestService(t)
+	scanTestLibrary(t, ls)
+	IDs := createTestUsers(t, ls, "Alice", "Bob")
+	songID := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'One'`)
+
+	for _, ID := range append(IDs, "") {
+		s := ls.Session.WithUser(ID)
+		p, err := s.PlaylistService().CreatePlaylist(&library.PlaylistAttributes{Name: "Mix"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.PlaylistService().InsertSong(p.ID, songID, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.PlayService().RecordPlay(&library.PlayAttributes{SongID: songID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.RatingService().Rate("songs", songID, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := ls.Session.UserService().DeleteUser(IDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := ls.Session.UserService().User(IDs[0])
+	if err != nil || u != nil {
+		t.Errorf("User returned %+v (%v) for the deleted user", u, err)
+	}
+
+	for _, table := range []string{"playlists", "plays", "ratings"} {
+		for ID, want := range map[string]int{IDs[0]: 0, IDs[1]: 1, "0": 1} {
+			if n := queryTestInt(t, ls, `SELECT COUNT(*) FROM `+table+` WHERE user_id = ?`, ID); n != want {
+				t.Errorf("%s holds %d rows of user %s, want %d", table, n, ID, want)
+			}
+		}
+	}
+	if n := queryTestInt(t, ls, `SELECT COUNT(*) FROM playlist_entries`); n != 2 {
+		t.Errorf("playlist_entries holds %d rows, want the 2 of the remaining playlists", n)
+	}
+
+	err = ls.Session.UserService().DeleteUser(IDs[0])
+	if !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("DeleteUser of a deleted user returned %v, want ErrNotFound", err)
+	}
+}
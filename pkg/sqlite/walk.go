@@ -0,0 +1,290 @@
+package sqlite
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of the file that lists patterns of files to leave out
+// of scans of the directory it is in and the directories beneath it.
+const IgnoreFile = ".libraryignore"
+
+// DefaultExtensions lists the extensions of the audio files scanned when scan
+// options do not specify any.
+var DefaultExtensions = []string{
+	".aac", ".aif", ".aiff", ".alac", ".ape", ".dsf", ".flac", ".m4a",
+	".mp3", ".mp4", ".mpc", ".oga", ".ogg", ".opus", ".wav", ".wma", ".wv",
+}
+
+// ignoreRule represents a pattern read from an ignore file.
+type ignoreRule struct {
+	dir     string
+	pattern string
+}
+
+// walkFunc is called by a walker for every directory and audio file it finds,
+// and for every path it fails to read.
+type walkFunc func(path string, f os.FileInfo, err error) error
+
+// walker walks the audio files beneath a path as configured by scan options.
+// The path may lie beneath a base directory, such as the library root it is
+// within, in which case the path is left out of the walk if the ignore files
+// of the directories from the base down to the path leave it out, and exclude
+// patterns and the maximum depth are measured from the base, so that the walk
+// finds what a walk of the whole base would find beneath the path.
+type walker struct {
+	root       string
+	base       string
+	top        string
+	opts       *ScanOptions
+	extensions map[string]bool
+	visited    map[string]bool
+	fn         walkFunc
+}
+
+// newWalker returns a new instance of a walker for the given path, which lies
+// at or beneath the given base directory.
+func newWalker(root string, base string, opts *ScanOptions) (*walker, error) {
+	for _, pattern := range opts.Exclude {
+		_, err := filepath.Match(pattern, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	top := root
+	if len(base) > 0 {
+		rel, err := filepath.Rel(base, root)
+		if err == nil && !outside(rel) {
+			top = base
+		}
+	}
+
+	w := &walker{
+		root:       root,
+		base:       base,
+		top:        top,
+		opts:       opts,
+		extensions: make(map[string]bool),
+		visited:    make(map[string]bool)}
+	for _, ext := range opts.Extensions {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		w.extensions[strings.ToLower(ext)] = true
+	}
+	return w, nil
+}
+
+// walk calls fn for the root of the walker and for every directory and audio
+// file beneath it. If fn returns an error, the walk stops and returns it.
+func (w *walker) walk(fn walkFunc) error {
+	w.fn = fn
+	rules, skipped, err := w.ancestors()
+	if err != nil || skipped {
+		return err
+	}
+
+	f, err := os.Stat(w.root)
+	if err != nil {
+		return fn(w.root, nil, err)
+	}
+
+	depth := w.depth(w.root)
+	if !f.IsDir() {
+		if !f.Mode().IsRegular() || !w.extensions[strings.ToLower(filepath.Ext(w.root))] {
+			return nil
+		}
+		if w.opts.MaxDepth > 0 && depth > w.opts.MaxDepth {
+			return nil
+		}
+		return fn(w.root, f, nil)
+	}
+	if w.opts.MaxDepth > 0 && depth >= w.opts.MaxDepth {
+		return nil
+	}
+	return w.walkDir(w.root, f, depth, rules)
+}
+
+// depth returns the number of directories that the given path lies beneath
+// the directory that the walker measures depth from.
+func (w *walker) depth(path string) int {
+	rel, err := filepath.Rel(w.top, path)
+	if err != nil || rel == "." || outside(rel) {
+		return 0
+	}
+	return len(strings.Split(rel, string(filepath.Separator)))
+}
+
+// ancestors returns the rules read from the ignore files of the directories
+// from the base of the walker down to the parent of its root, and reports
+// whether the root, or any directory between the base and the root, is left
+// out by them or for being hidden.
+func (w *walker) ancestors() ([]ignoreRule, bool, error) {
+	if len(w.base) == 0 {
+		return nil, false, nil
+	}
+	rel, err := filepath.Rel(w.base, w.root)
+	if err != nil || rel == "." || outside(rel) {
+		return nil, false, nil
+	}
+
+	var rules []ignoreRule
+	dir := w.base
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		rules, err = readIgnoreFile(dir, rules)
+		if err != nil {
+			err = w.fn(filepath.Join(dir, IgnoreFile), nil, err)
+			if err != nil {
+				return rules, false, err
+			}
+		}
+
+		dir = filepath.Join(dir, name)
+		if w.skip(dir, rules) {
+			return rules, true, nil
+		}
+	}
+	return rules, false, nil
+}
+
+// walkDir walks the given directory, which lies the given number of
+// directories beneath the directory that the walker measures depth from,
+// leaving out paths matched by the given rules.
+func (w *walker) walkDir(dir string, f os.FileInfo, depth int, rules []ignoreRule) error {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return w.fn(dir, f, err)
+	}
+	if w.visited[real] {
+		return nil
+	}
+	w.visited[real] = true
+
+	err = w.fn(dir, f, nil)
+	if err != nil {
+		return err
+	}
+
+	rules, err = readIgnoreFile(dir, rules)
+	if err != nil {
+		err = w.fn(filepath.Join(dir, IgnoreFile), nil, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return w.fn(dir, f, err)
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if w.skip(path, rules) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if !w.opts.FollowSymlinks {
+				continue
+			}
+			info, err = os.Stat(path)
+		}
+		if err != nil {
+			err = w.fn(path, nil, err)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if info.IsDir() {
+			if w.opts.MaxDepth > 0 && depth+1 >= w.opts.MaxDepth {
+				continue
+			}
+			err = w.walkDir(path, info, depth+1, rules)
+		} else if info.Mode().IsRegular() && w.extensions[strings.ToLower(filepath.Ext(path))] {
+			err = w.fn(path, info, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skip reports whether the given path should be left out of the walk.
+func (w *walker) skip(path string, rules []ignoreRule) bool {
+	name := filepath.Base(path)
+	if !w.opts.IncludeHidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+
+	rel, err := filepath.Rel(w.top, path)
+	if err != nil {
+		rel = path
+	}
+	for _, pattern := range w.opts.Exclude {
+		if match(pattern, name, rel) {
+			return true
+		}
+	}
+
+	for _, rule := range rules {
+		rel, err := filepath.Rel(rule.dir, path)
+		if err != nil {
+			continue
+		}
+		if match(rule.pattern, name, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// outside reports whether the given relative path leads out of the directory
+// it is relative to.
+func outside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// match reports whether the given glob pattern matches either the name of a
+// path or the path relative to the directory the pattern applies to.
+func match(pattern, name, rel string) bool {
+	ok, _ := filepath.Match(pattern, name)
+	if ok {
+		return true
+	}
+	ok, _ = filepath.Match(pattern, filepath.ToSlash(rel))
+	return ok
+}
+
+// readIgnoreFile returns the given rules along with the rules read from the
+// ignore file in the given directory, if there is one. Each line of an ignore
+// file holds a glob pattern; blank lines and lines starting with '#' are left
+// out.
+func readIgnoreFile(dir string, rules []ignoreRule) ([]ignoreRule, error) {
+	f, err := os.Open(filepath.Join(dir, IgnoreFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rules, nil
+		}
+		return rules, err
+	}
+	defer f.Close()
+
+	results := append([]ignoreRule(nil), rules...)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		results = append(results, ignoreRule{dir: dir, pattern: strings.TrimSuffix(line, "/")})
+	}
+	return results, scanner.Err()
+}
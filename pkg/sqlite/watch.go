@@ -0,0 +1,220 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDelay is how long Watch waits for the file system to settle after an
+// event before applying the changes it has seen.
+var watchDelay = 2 * time.Second
+
+// Watch watches the given library roots, or every library root if none are
+// given, and keeps the library in sync with the files beneath them as they are
+// created, modified, renamed and deleted. Given roots that are not within a
+// library root already are added as roots and scanned before watching begins.
+// Bursts of events are collected until the file system has been quiet for a
+// moment and are then applied together in a single transaction; if they cannot
+// be applied, they are kept and tried again after the same delay. Watch blocks
+// until the context is cancelled and returns the context error. The session
+// must not be used for other writes while it is being watched.
+func (ls *Service) Watch(ctx context.Context, roots ...string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		ls.Session.Logger.Println(err)
+		return err
+	}
+	defer watcher.Close()
+
+	if len(roots) == 0 {
+		all, err := ls.Session.RootService.List()
+		if err != nil {
+			return err
+		}
+		for _, root := range all {
+			roots = append(roots, root.Attributes.Path)
+		}
+	}
+
+	for _, path := range roots {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+
+		root, err := ls.Session.RootService.rootFor(path)
+		if err != nil {
+			return err
+		}
+
+		err = ls.watchDir(watcher, path)
+		if err != nil {
+			return err
+		}
+
+		if root == nil {
+			_, err = ls.ScanContext(ctx, path, nil)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			path := filepath.Clean(event.Name)
+			if event.Op&fsnotify.Create != 0 {
+				f, err := os.Stat(path)
+				if err == nil && f.IsDir() {
+					ls.watchDir(watcher, path)
+				}
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			pending[path] = true
+			timer.Reset(watchDelay)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			ls.Session.Logger.Println(err)
+
+		case <-timer.C:
+			err := ls.sync(ctx, pending)
+			if err != nil {
+				ls.Session.Logger.Println(err)
+				timer.Reset(watchDelay)
+				continue
+			}
+			pending = make(map[string]bool)
+		}
+	}
+}
+
+// watchDir adds a watch for the given directory and every directory beneath it
+// that a scan would descend into.
+func (ls *Service) watchDir(watcher *fsnotify.Watcher, dir string) error {
+	base := dir
+	root, err := ls.Session.RootService.rootFor(dir)
+	if err != nil {
+		return err
+	}
+	if root != nil {
+		base = root.Attributes.Path
+	}
+
+	opts := (*ScanOptions)(nil).withDefaults()
+	w, err := newWalker(dir, base, &opts)
+	if err != nil {
+		return err
+	}
+
+	return w.walk(func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			ls.Session.Logger.Println(err)
+			return nil
+		}
+		if !f.IsDir() {
+			return nil
+		}
+
+		err = watcher.Add(path)
+		if err != nil {
+			ls.Session.Logger.Println(err)
+		}
+		return nil
+	})
+}
+
+// sync applies the current state of the given paths to the library in a single
+// transaction. Paths that still exist are rescanned, and songs beneath paths
+// that no longer exist are then deleted, unless a rescan found that they were
+// moved.
+func (ls *Service) sync(ctx context.Context, paths map[string]bool) error {
+	var existing, missing []string
+	for _, path := range topmost(paths) {
+		_, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			missing = append(missing, path)
+		} else {
+			existing = append(existing, path)
+		}
+	}
+
+	s := ls.Session.bind(ctx)
+	err := s.BeginTx()
+	if err != nil {
+		return err
+	}
+
+	for i, path := range append(existing, missing...) {
+		rootID := ""
+		root, err := s.RootService.rootFor(path)
+		if err != nil {
+			s.RollbackTx()
+			return err
+		}
+		if root != nil {
+			rootID = root.ID
+		}
+
+		sc, err := newScanner(ctx, s, path, rootID, nil)
+		if err != nil {
+			s.RollbackTx()
+			return err
+		}
+
+		if i < len(existing) {
+			err = sc.scan()
+		} else {
+			err = sc.finish()
+		}
+		if err != nil {
+			s.RollbackTx()
+			return err
+		}
+	}
+
+	return s.CommitTx()
+}
+
+// topmost returns the given paths in order, leaving out any path that lies
+// beneath another of the paths.
+func topmost(paths map[string]bool) []string {
+	var results []string
+	for path := range paths {
+		nested := false
+		for p, dir := path, filepath.Dir(path); dir != p; p, dir = dir, filepath.Dir(dir) {
+			if paths[dir] {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			results = append(results, path)
+		}
+	}
+	sort.Strings(results)
+	return results
+}
@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// TestSyncIgnoresFiles checks that files created within a watched root are
+// left out as a scan of the whole root would leave them out.
+func TestSyncIgnoresFiles(t *testing.T) {
+	root := t.TempDir()
+	err := os.WriteFile(filepath.Join(root, IgnoreFile), []byte("demo*\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(root, "album", "1.mp3"), "title", "One")
+
+	ls := openTestService(t)
+	_, err = ls.Scan(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := map[string]bool{}
+	for _, path := range []string{
+		filepath.Join(root, "album", "demo2.mp3"),
+		filepath.Join(root, "album", ".hidden.mp3"),
+		filepath.Join(root, "demos", "3.mp3"),
+		filepath.Join(root, ".hidden", "4.mp3"),
+		filepath.Join(root, "album", "5.mp3"),
+	} {
+		writeTestFile(t, path, "title", filepath.Base(path))
+		paths[path] = true
+	}
+	paths[filepath.Join(root, "demos")] = true
+	paths[filepath.Join(root, ".hidden")] = true
+
+	err = ls.sync(context.Background(), paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	songs, err := ls.Session.SongService().Songs(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range songs {
+		names = append(names, s.Attributes.Name)
+	}
+	if len(names) != 2 {
+		t.Fatalf("library has songs %v, want One and 5.mp3", names)
+	}
+}
+
+// waitForTestSongs waits for the library to hold songs at exactly the given
+// paths beneath the given root, failing the test if it does not within a few
+// seconds.
+func waitForTestSongs(t *testing.T, ls *Service, root string, want ...string) {
+	t.Helper()
+
+	sort.Strings(want)
+	var paths []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		songs, err := ls.Session.SongService().Songs(map[string]string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = []string{}
+		for _, s := range songs {
+			rel, _ := filepath.Rel(root, s.Attributes.FilePath)
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		sort.Strings(paths)
+		if reflect.DeepEqual(paths, want) {
+			return
+		}
+	}
+	t.Fatalf("library holds songs %v, want %v", paths, want)
+}
+
+// TestWatch checks that Watch scans a newly watched root, follows files as they
+// are created, renamed and removed, and retries changes it fails to apply.
+func TestWatch(t *testing.T) {
+	delay := watchDelay
+	watchDelay = 20 * time.Millisecond
+
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "1.mp3"), "title", "One")
+
+	ls := openTestService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ls.Watch(ctx, root) }()
+	defer func() {
+		cancel()
+		err := <-done
+		if err != context.Canceled {
+			t.Errorf("Watch returned %v, want %v", err, context.Canceled)
+		}
+		watchDelay = delay
+	}()
+
+	waitForTestSongs(t, ls, root, "1.mp3")
+	if n := queryTestInt(t, ls, `SELECT COUNT(*) FROM library_roots WHERE root_path = ?`, root); n != 1 {
+		t.Fatalf("library has %d roots at the watched path, want 1", n)
+	}
+
+	writeTestFile(t, filepath.Join(root, "album", "2.mp3"), "title", "Two")
+	waitForTestSongs(t, ls, root, "1.mp3", "album/2.mp3")
+	ID := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'Two'`)
+
+	err := os.Rename(filepath.Join(root, "album", "2.mp3"), filepath.Join(root, "album", "3.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForTestSongs(t, ls, root, "1.mp3", "album/3.mp3")
+	if moved := queryTestID(t, ls, `SELECT song_id FROM songs WHERE song_name = 'Two'`); moved != ID {
+		t.Errorf("renamed song has ID %s, want %s", moved, ID)
+	}
+
+	_, err = ls.Session.db.Exec(
+		`CREATE TRIGGER fail_delete BEFORE DELETE ON songs
+		 BEGIN SELECT RAISE(ABORT, 'broken delete'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(filepath.Join(root, "1.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * watchDelay)
+	waitForTestSongs(t, ls, root, "1.mp3", "album/3.mp3")
+
+	_, err = ls.Session.db.Exec(`DROP TRIGGER fail_delete`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForTestSongs(t, ls, root, "album/3.mp3")
+}
@@ -0,0 +1,32 @@
+package library
+
+import "context"
+
+// Play represents a play resource object, a single listen to a song.
+type Play struct {
+	Type       string         `json:"type,omitempty"`
+	ID         string         `json:"id,omitempty"`
+	Attributes PlayAttributes `json:"attributes,omitempty"`
+}
+
+// PlayAttributes represents information about the play resource object.
+// Skipped records that the song was skipped rather than listened to.
+type PlayAttributes struct {
+	SongID           string `json:"songId,omitempty"`
+	PlayedAt         string `json:"playedAt,omitempty"`
+	DurationInMillis int    `json:"durationInMillis,omitempty"`
+	Source           string `json:"source,omitempty"`
+	Skipped          bool   `json:"skipped,omitempty"`
+}
+
+// PlayService manages interactions with the play history data source.
+// Each method has a Context variant, as those of SongService.
+type PlayService interface {
+	Play(ID string) (*Play, error)
+	Plays(songID string, limit int) ([]*Play, error)
+	RecordPlay(attributes *PlayAttributes) (*Play, error)
+
+	PlayContext(ctx context.Context, ID string) (*Play, error)
+	PlaysContext(ctx context.Context, songID string, limit int) ([]*Play, error)
+	RecordPlayContext(ctx context.Context, attributes *PlayAttributes) (*Play, error)
+}
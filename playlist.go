@@ -0,0 +1,75 @@
+package library
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrSmartPlaylist is returned when changing the songs of a smart playlist,
+// whose songs are selected by its rules.
+var ErrSmartPlaylist = errors.New("library: songs of a smart playlist cannot be changed")
+
+// Playlist represents a playlist resource object.
+type Playlist struct {
+	Type       string             `json:"type,omitempty"`
+	ID         string             `json:"id,omitempty"`
+	Attributes PlaylistAttributes `json:"attributes,omitempty"`
+}
+
+// PlaylistAttributes represents information about the playlist resource object.
+type PlaylistAttributes struct {
+	Name         string      `json:"name,omitempty"`
+	Description  string      `json:"description,omitempty"`
+	SongCount    int         `json:"songCount,omitempty"`
+	DateCreated  string      `json:"dateCreated,omitempty"`
+	DateModified string      `json:"dateModified,omitempty"`
+	Rules        *SmartRules `json:"rules,omitempty"`
+}
+
+// SmartRules represents the rules that select the songs of a smart playlist.
+// Songs are selected when they meet all of the conditions, or any of them if
+// Match is "any". Sort names the field to order songs by, prefixed with '-'
+// for descending order, and Limit caps the number of songs when positive.
+// Empty rules, with no match, conditions, sort or limit, make a playlist a
+// regular one.
+type SmartRules struct {
+	Match      string      `json:"match,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"`
+	Sort       string      `json:"sort,omitempty"`
+	Limit      int         `json:"limit,omitempty"`
+}
+
+// Condition represents a comparison of a field with one or more values, such
+// as {"field": "year", "operator": "between", "values": ["1955", "1965"]}.
+type Condition struct {
+	Field    string   `json:"field"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// PlaylistService manages interactions with the playlist data source. Songs
+// within a playlist are ordered and addressed by their zero-based position; a
+// song may appear more than once. The songs of a smart playlist are selected
+// by its rules each time they are read. Playlists belong to the acting user.
+// Each method has a Context variant, as those of SongService.
+type PlaylistService interface {
+	Playlist(ID string) (*Playlist, error)
+	Playlists() ([]*Playlist, error)
+	CreatePlaylist(attributes *PlaylistAttributes) (*Playlist, error)
+	UpdatePlaylist(ID string, attributes *PlaylistAttributes) error
+	DeletePlaylist(ID string) error
+	PlaylistSongs(ID string) ([]*Song, error)
+	InsertSong(ID string, songID string, position int) error
+	MoveSong(ID string, from, to int) error
+	RemoveSong(ID string, position int) error
+
+	PlaylistContext(ctx context.Context, ID string) (*Playlist, error)
+	PlaylistsContext(ctx context.Context) ([]*Playlist, error)
+	CreatePlaylistContext(ctx context.Context, attributes *PlaylistAttributes) (*Playlist, error)
+	UpdatePlaylistContext(ctx context.Context, ID string, attributes *PlaylistAttributes) error
+	DeletePlaylistContext(ctx context.Context, ID string) error
+	PlaylistSongsContext(ctx context.Context, ID string) ([]*Song, error)
+	InsertSongContext(ctx context.Context, ID string, songID string, position int) error
+	MoveSongContext(ctx context.Context, ID string, from, to int) error
+	RemoveSongContext(ctx context.Context, ID string, position int) error
+}
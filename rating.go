@@ -0,0 +1,16 @@
+package library
+
+import "context"
+
+// RatingService manages the ratings and loved flags that users give to songs,
+// albums and artists, which are identified by their resource type and ID.
+// Ratings range from 0 to 5 in steps of a half star, where 0 clears the
+// rating.
+// Each method has a Context variant, as those of SongService.
+type RatingService interface {
+	Rate(resourceType string, ID string, rating float64) error
+	Love(resourceType string, ID string, loved bool) error
+
+	RateContext(ctx context.Context, resourceType string, ID string, rating float64) error
+	LoveContext(ctx context.Context, resourceType string, ID string, loved bool) error
+}
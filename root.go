@@ -0,0 +1,17 @@
+package library
+
+// Root represents a library root resource object, a directory whose files
+// make up the library.
+type Root struct {
+	Type       string         `json:"type,omitempty"`
+	ID         string         `json:"id,omitempty"`
+	Attributes RootAttributes `json:"attributes,omitempty"`
+}
+
+// RootAttributes represents information about the library root resource
+// object.
+type RootAttributes struct {
+	Path        string `json:"path,omitempty"`
+	DateAdded   string `json:"dateAdded,omitempty"`
+	LastScanned string `json:"lastScanned,omitempty"`
+}
@@ -0,0 +1,41 @@
+package library
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrSearchUnavailable is returned by searches when the library cannot keep a
+// search index.
+var ErrSearchUnavailable = errors.New("library: search unavailable")
+
+// SearchResults represents the resources that match a search, grouped by type
+// and ordered from the most to the least relevant.
+type SearchResults struct {
+	Artists []*SearchHit `json:"artists,omitempty"`
+	Albums  []*SearchHit `json:"albums,omitempty"`
+	Songs   []*SearchHit `json:"songs,omitempty"`
+}
+
+// SearchHit represents a resource that matches a search. Snippet is an excerpt
+// of the text that matched, with each match enclosed in <mark> and </mark>,
+// and Rank is its relevance, where higher ranks are more relevant.
+type SearchHit struct {
+	Type    string  `json:"type,omitempty"`
+	ID      string  `json:"id,omitempty"`
+	Name    string  `json:"name,omitempty"`
+	Snippet string  `json:"snippet,omitempty"`
+	Rank    float64 `json:"rank,omitempty"`
+}
+
+// SearchService searches the names of artists, albums and songs and the lyrics
+// of songs. Every word of the query must match the start of a word of the
+// text, regardless of case and diacritics. At most limit hits of each type are
+// returned if limit is positive. Search returns an error wrapping
+// ErrSearchUnavailable if the library has no search index.
+// Search has a Context variant, as the methods of SongService do.
+type SearchService interface {
+	Search(query string, limit int) (*SearchResults, error)
+
+	SearchContext(ctx context.Context, query string, limit int) (*SearchResults, error)
+}
@@ -1,5 +1,7 @@
 package library
 
+import "context"
+
 // Song represents a song resource object.
 type Song struct {
 	Type       string         `json:"type,omitempty"`
@@ -9,22 +11,52 @@ type Song struct {
 
 // SongAttributes represents information about the song resource object.
 type SongAttributes struct {
-	FilePath    string `json:"filePath,omitempty"`
-	FileBase    string `json:"fileBase,omitempty"`
-	FileDir     string `json:"fileDir,omitempty"`
-	ArtistName  string `json:"artistName,omitempty"`
-	ArtistSort  string `json:"artistSort,omitempty"`
-	Name        string `json:"name,omitempty"`
-	GenreName   string `json:"genreName,omitempty"`
-	ReleaseDate string `json:"releaseDate,omitempty"`
-	TrackNumber string `json:"trackNumber,omitempty"`
-	Lyrics      string `json:"lyrics,omitempty"`
-	Comments    string `json:"comments,omitempty"`
+	FilePath         string  `json:"filePath,omitempty"`
+	FileBase         string  `json:"fileBase,omitempty"`
+	FileDir          string  `json:"fileDir,omitempty"`
+	ArtistName       string  `json:"artistName,omitempty"`
+	ArtistSort       string  `json:"artistSort,omitempty"`
+	Name             string  `json:"name,omitempty"`
+	GenreName        string  `json:"genreName,omitempty"`
+	ReleaseDate      string  `json:"releaseDate,omitempty"`
+	TrackNumber      string  `json:"trackNumber,omitempty"`
+	TrackTotal       string  `json:"trackTotal,omitempty"`
+	DiscNumber       string  `json:"discNumber,omitempty"`
+	DiscTotal        string  `json:"discTotal,omitempty"`
+	DurationInMillis int     `json:"durationInMillis,omitempty"`
+	Composer         string  `json:"composer,omitempty"`
+	ComposerSort     string  `json:"composerSort,omitempty"`
+	Conductor        string  `json:"conductor,omitempty"`
+	Sort             string  `json:"sort,omitempty"`
+	Lyrics           string  `json:"lyrics,omitempty"`
+	Comments         string  `json:"comments,omitempty"`
+	DateAdded        string  `json:"dateAdded,omitempty"`
+	PlayCount        int     `json:"playCount,omitempty"`
+	SkipCount        int     `json:"skipCount,omitempty"`
+	LastPlayed       string  `json:"lastPlayed,omitempty"`
+	Rating           float64 `json:"rating,omitempty"`
+	Loved            bool    `json:"loved,omitempty"`
 }
 
 // SongService manages interactions with the song data source.
+// FilterSongs reads the page of songs that a filter selects, and Songs and
+// SongsPage read those selected by parameters, as parsed by ParseSongFilter.
+// Each method has a Context variant whose queries are cancelled along with
+// the given context and which acts for the user acting in the context, if any.
 type SongService interface {
 	Song(ID string) (*Song, error)
 	Songs(params map[string]string) ([]*Song, error)
+	SongsPage(params map[string]string) ([]*Song, *Page, error)
+	FilterSongs(filter *SongFilter) ([]*Song, *Page, error)
 	CreateSong(attributes *SongAttributes) error
+	UpdateSong(ID string, attributes *SongAttributes) error
+	DeleteSong(ID string) error
+
+	SongContext(ctx context.Context, ID string) (*Song, error)
+	SongsContext(ctx context.Context, params map[string]string) ([]*Song, error)
+	SongsPageContext(ctx context.Context, params map[string]string) ([]*Song, *Page, error)
+	FilterSongsContext(ctx context.Context, filter *SongFilter) ([]*Song, *Page, error)
+	CreateSongContext(ctx context.Context, attributes *SongAttributes) error
+	UpdateSongContext(ctx context.Context, ID string, attributes *SongAttributes) error
+	DeleteSongContext(ctx context.Context, ID string) error
 }
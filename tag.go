@@ -0,0 +1,33 @@
+package library
+
+import "context"
+
+// Tag represents a tag resource object, a free-form label attached to songs,
+// albums and artists.
+type Tag struct {
+	Type       string        `json:"type,omitempty"`
+	ID         string        `json:"id,omitempty"`
+	Attributes TagAttributes `json:"attributes,omitempty"`
+}
+
+// TagAttributes represents information about the tag resource object. Count
+// is the number of resources the tag is attached to.
+type TagAttributes struct {
+	Name  string `json:"name,omitempty"`
+	Count int    `json:"count,omitempty"`
+}
+
+// TagService manages the tags attached to songs, albums and artists, which are
+// identified by their resource type and ID. Tag names are case-insensitive.
+// Each method has a Context variant, as those of SongService.
+type TagService interface {
+	Tags() ([]*Tag, error)
+	ResourceTags(resourceType string, ID string) ([]*Tag, error)
+	AddTag(resourceType string, ID string, name string) error
+	RemoveTag(resourceType string, ID string, name string) error
+
+	TagsContext(ctx context.Context) ([]*Tag, error)
+	ResourceTagsContext(ctx context.Context, resourceType string, ID string) ([]*Tag, error)
+	AddTagContext(ctx context.Context, resourceType string, ID string, name string) error
+	RemoveTagContext(ctx context.Context, resourceType string, ID string, name string) error
+}
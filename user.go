@@ -0,0 +1,49 @@
+package library
+
+import "context"
+
+// User represents a user resource object. Playlists, plays and ratings belong
+// to the user who made them.
+type User struct {
+	Type       string         `json:"type,omitempty"`
+	ID         string         `json:"id,omitempty"`
+	Attributes UserAttributes `json:"attributes,omitempty"`
+}
+
+// UserAttributes represents information about the user resource object.
+type UserAttributes struct {
+	Name        string `json:"name,omitempty"`
+	DateCreated string `json:"dateCreated,omitempty"`
+}
+
+// UserService manages interactions with the user data source.
+// Each method has a Context variant, as those of SongService.
+type UserService interface {
+	User(ID string) (*User, error)
+	Users() ([]*User, error)
+	CreateUser(attributes *UserAttributes) (*User, error)
+	UpdateUser(ID string, attributes *UserAttributes) error
+	DeleteUser(ID string) error
+
+	UserContext(ctx context.Context, ID string) (*User, error)
+	UsersContext(ctx context.Context) ([]*User, error)
+	CreateUserContext(ctx context.Context, attributes *UserAttributes) (*User, error)
+	UpdateUserContext(ctx context.Context, ID string, attributes *UserAttributes) error
+	DeleteUserContext(ctx context.Context, ID string) error
+}
+
+// userKey is the context key of the acting user.
+type userKey struct{}
+
+// ContextWithUser returns a copy of the given context in which the user with
+// the given ID is acting.
+func ContextWithUser(ctx context.Context, ID string) context.Context {
+	return context.WithValue(ctx, userKey{}, ID)
+}
+
+// UserFromContext returns the ID of the user acting in the given context, or
+// an empty string if no user is.
+func UserFromContext(ctx context.Context) string {
+	ID, _ := ctx.Value(userKey{}).(string)
+	return ID
+}